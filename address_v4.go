@@ -2,6 +2,11 @@ package patricia
 
 import (
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"strconv"
 )
 
 const _leftmost32Bit = uint32(1 << 31)
@@ -29,6 +34,118 @@ func NewIPv4AddressFromBytes(address []byte, length uint) IPv4Address {
 	}
 }
 
+// IPv4AddressFromAddr creates a full 32 bit address from the input netip.Addr
+// - IPv4-mapped IPv6 addresses are unmapped
+func IPv4AddressFromAddr(addr netip.Addr) (IPv4Address, error) {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return IPv4Address{}, fmt.Errorf("not an IPv4 address: %s", addr)
+	}
+	bytes := addr.As4()
+	return NewIPv4Address(binary.BigEndian.Uint32(bytes[:]), 32), nil
+}
+
+// IPv4AddressFromPrefix creates an address from the input netip.Prefix
+// - IPv4-mapped IPv6 prefixes of at least /96 are unmapped, with their length reduced by 96
+// - host bits are kept, so the conversion is lossless
+func IPv4AddressFromPrefix(prefix netip.Prefix) (IPv4Address, error) {
+	if !prefix.IsValid() {
+		return IPv4Address{}, fmt.Errorf("invalid prefix: %s", prefix)
+	}
+	addr := prefix.Addr()
+	length := prefix.Bits()
+	if addr.Is4In6() {
+		if length < 96 {
+			return IPv4Address{}, fmt.Errorf("IPv4-mapped prefix is shorter than /96: %s", prefix)
+		}
+		addr = addr.Unmap()
+		length -= 96
+	}
+	if !addr.Is4() {
+		return IPv4Address{}, fmt.Errorf("not an IPv4 prefix: %s", prefix)
+	}
+	bytes := addr.As4()
+	return NewIPv4Address(binary.BigEndian.Uint32(bytes[:]), uint(length)), nil
+}
+
+// Addr returns the address as a netip.Addr, ignoring its length
+func (i IPv4Address) Addr() netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(i.Address >> 24), byte(i.Address >> 16), byte(i.Address >> 8), byte(i.Address)})
+}
+
+// Prefix returns the address and length as a netip.Prefix
+// - host bits are kept - the returned prefix is invalid if the length is over 32
+func (i IPv4Address) Prefix() netip.Prefix {
+	return netip.PrefixFrom(i.Addr(), int(i.Length))
+}
+
+// String returns the address in CIDR notation, such as 192.168.0.0/24
+func (i IPv4Address) String() string {
+	return string(i.appendText(make([]byte, 0, 18)))
+}
+
+// AppendText appends the address in CIDR notation to b, returning the extended buffer
+func (i IPv4Address) AppendText(b []byte) ([]byte, error) {
+	if i.Length > 32 {
+		return b, fmt.Errorf("invalid IPv4 prefix length: %d", i.Length)
+	}
+	return i.appendText(b), nil
+}
+
+func (i IPv4Address) appendText(b []byte) []byte {
+	b = i.Addr().AppendTo(b)
+	b = append(b, '/')
+	return strconv.AppendUint(b, uint64(i.Length), 10)
+}
+
+// MarshalText returns the address in CIDR notation
+func (i IPv4Address) MarshalText() ([]byte, error) {
+	return i.AppendText(make([]byte, 0, 18))
+}
+
+// UnmarshalText parses an address or CIDR, as ParseIP does, but keeps any host bits set beyond the length
+// - a missing length defaults to 32
+// - so text from MarshalText, such as 10.1.2.3/8, reads back as the same address
+func (i *IPv4Address) UnmarshalText(text []byte) error {
+	parsed, err := parseIPUnmasked(text)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsV4 {
+		return fmt.Errorf("not an IPv4 address: %q", text)
+	}
+	*i = parsed.V4
+	return nil
+}
+
+// MarshalJSON returns the address in CIDR notation as a JSON string
+func (i IPv4Address) MarshalJSON() ([]byte, error) {
+	text, err := i.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON parses an address or CIDR from a JSON string
+// - null leaves the address unchanged
+func (i *IPv4Address) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return i.UnmarshalText([]byte(text))
+}
+
+// masked returns the address with the host bits beyond its length cleared
+func (i IPv4Address) masked() IPv4Address {
+	i.Address &= _leftMasks32[i.Length]
+	return i
+}
+
 // ShiftLeft shifts the address to the left
 func (i *IPv4Address) ShiftLeft(shiftCount uint) {
 	i.Address <<= shiftCount
@@ -39,3 +156,9 @@ func (i *IPv4Address) ShiftLeft(shiftCount uint) {
 func (i *IPv4Address) IsLeftBitSet() bool {
 	return i.Address >= _leftmost32Bit
 }
+
+// CommonPrefixLength returns how many leading bits the two addresses have in common, up to the shorter of their lengths
+func (i IPv4Address) CommonPrefixLength(other IPv4Address) uint {
+	common := uint(bits.LeadingZeros32(i.Address ^ other.Address))
+	return min(common, i.Length, other.Length)
+}
@@ -1,6 +1,9 @@
 package patricia
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,3 +15,114 @@ func TestNewIPv4Address(t *testing.T) {
 	assert.Equal(t, uint32(0x01234567), sut.Address)
 	assert.Equal(t, uint(7), sut.Length)
 }
+
+func TestCommonPrefixLengthV4(t *testing.T) {
+	assert.Equal(t, uint(24), NewIPv4Address(0x0a010203, 32).CommonPrefixLength(NewIPv4Address(0x0a0102ff, 32)))
+	assert.Equal(t, uint(16), NewIPv4Address(0x0a010203, 16).CommonPrefixLength(NewIPv4Address(0x0a0102ff, 32)))
+	assert.Equal(t, uint(32), NewIPv4Address(0x0a010203, 32).CommonPrefixLength(NewIPv4Address(0x0a010203, 32)))
+	assert.Equal(t, uint(0), NewIPv4Address(0x0a010203, 32).CommonPrefixLength(NewIPv4Address(0x8a010203, 32)))
+	assert.Equal(t, uint(0), NewIPv4Address(0x0a010203, 0).CommonPrefixLength(NewIPv4Address(0x0a010203, 32)))
+}
+
+func TestIPv4AddressNetip(t *testing.T) {
+	address, err := IPv4AddressFromPrefix(netip.MustParsePrefix("10.1.2.3/16"))
+	assert.NoError(t, err)
+	assert.Equal(t, NewIPv4Address(0x0a010203, 16), address)
+	assert.Equal(t, netip.MustParsePrefix("10.1.2.3/16"), address.Prefix())
+	assert.Equal(t, netip.MustParseAddr("10.1.2.3"), address.Addr())
+
+	address, err = IPv4AddressFromPrefix(netip.MustParsePrefix("::ffff:10.1.2.3/120"))
+	assert.NoError(t, err)
+	assert.Equal(t, NewIPv4Address(0x0a010203, 24), address)
+
+	address, err = IPv4AddressFromAddr(netip.MustParseAddr("10.1.2.3"))
+	assert.NoError(t, err)
+	assert.Equal(t, NewIPv4Address(0x0a010203, 32), address)
+	address, err = IPv4AddressFromAddr(netip.MustParseAddr("::ffff:10.1.2.3"))
+	assert.NoError(t, err)
+	assert.Equal(t, NewIPv4Address(0x0a010203, 32), address)
+
+	for _, prefix := range []netip.Prefix{{}, netip.MustParsePrefix("::ffff:0.0.0.0/95"), netip.MustParsePrefix("2001:db8::/32")} {
+		_, err = IPv4AddressFromPrefix(prefix)
+		assert.Error(t, err, "%s", prefix)
+	}
+	for _, addr := range []netip.Addr{{}, netip.MustParseAddr("2001:db8::1")} {
+		_, err = IPv4AddressFromAddr(addr)
+		assert.Error(t, err, "%s", addr)
+	}
+
+	assert.False(t, NewIPv4Address(0, 33).Prefix().IsValid())
+
+	// round trips
+	for _, s := range []string{"0.0.0.0/0", "255.255.255.255/32", "128.0.0.0/1", "192.168.7.9/21"} {
+		address, err = IPv4AddressFromPrefix(netip.MustParsePrefix(s))
+		assert.NoError(t, err)
+		assert.Equal(t, s, address.Prefix().String())
+	}
+
+	prefix := netip.MustParsePrefix("10.1.2.3/16")
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		address, _ := IPv4AddressFromPrefix(prefix)
+		prefix = address.Prefix()
+	}))
+}
+
+func TestIPv4AddressText(t *testing.T) {
+	assert.Equal(t, "192.168.1.0/24", NewIPv4Address(0xc0a80100, 24).String())
+	assert.Equal(t, "0.0.0.0/0", IPv4Address{}.String())
+	assert.Equal(t, "10.1.2.3/32", fmt.Sprintf("%v", NewIPv4Address(0x0a010203, 32)))
+
+	buf, err := NewIPv4Address(0x0a010203, 32).AppendText([]byte("ip="))
+	assert.NoError(t, err)
+	assert.Equal(t, "ip=10.1.2.3/32", string(buf))
+	_, err = NewIPv4Address(0, 33).AppendText(nil)
+	assert.Error(t, err)
+	_, err = NewIPv4Address(0, 33).MarshalText()
+	assert.Error(t, err)
+
+	// round trips through ParseIPFromString
+	for _, s := range []string{"0.0.0.0/0", "10.0.0.0/8", "192.168.1.0/24", "255.255.255.255/32", "1.2.3.4"} {
+		expected, _, err := ParseIPFromString(s)
+		assert.NoError(t, err)
+
+		text, err := expected.MarshalText()
+		assert.NoError(t, err)
+		var address IPv4Address
+		assert.NoError(t, address.UnmarshalText(text))
+		assert.Equal(t, *expected, address)
+
+		reparsed, _, err := ParseIPFromString(expected.String())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, reparsed)
+	}
+
+	var address IPv4Address
+	assert.Error(t, address.UnmarshalText([]byte("2001:db8::/32")))
+	assert.Error(t, address.UnmarshalText([]byte("nope")))
+
+	type config struct {
+		Network  IPv4Address
+		Optional *IPv4Address
+		Networks []IPv4Address
+	}
+	data, err := json.Marshal(config{Network: NewIPv4Address(0x0a000000, 8), Networks: []IPv4Address{NewIPv4Address(0xc0a80000, 16)}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Network":"10.0.0.0/8","Optional":null,"Networks":["192.168.0.0/16"]}`, string(data))
+
+	var decoded config
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, NewIPv4Address(0x0a000000, 8), decoded.Network)
+	assert.Nil(t, decoded.Optional)
+	assert.Equal(t, []IPv4Address{NewIPv4Address(0xc0a80000, 16)}, decoded.Networks)
+
+	// host bits survive the round trip
+	withHost := NewIPv4Address(0x0a010203, 8)
+	data, err = json.Marshal(config{Network: withHost})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"Network":"10.1.2.3/8"`)
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, withHost, decoded.Network)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"Network":8}`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"Network":"::1"}`), &decoded))
+}
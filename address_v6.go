@@ -2,6 +2,11 @@ package patricia
 
 import (
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"strconv"
 )
 
 const _leftmost64Bit = uint64(1 << 63)
@@ -29,6 +34,138 @@ func NewIPv6Address(address []byte, length uint) IPv6Address {
 	}
 }
 
+// IPv6AddressFromAddr creates a full 128 bit address from the input netip.Addr
+// - IPv4 addresses are converted to their IPv4-mapped form, ::ffff:a.b.c.d
+// - the zone, if any, is dropped
+func IPv6AddressFromAddr(addr netip.Addr) (IPv6Address, error) {
+	if !addr.IsValid() {
+		return IPv6Address{}, fmt.Errorf("invalid address: %s", addr)
+	}
+	bytes := addr.As16()
+	return NewIPv6Address(bytes[:], 128), nil
+}
+
+// IPv6AddressFromPrefix creates an address from the input netip.Prefix
+// - IPv4 prefixes are converted to their IPv4-mapped form, with their length increased by 96
+// - host bits are kept, so the conversion is lossless
+func IPv6AddressFromPrefix(prefix netip.Prefix) (IPv6Address, error) {
+	if !prefix.IsValid() {
+		return IPv6Address{}, fmt.Errorf("invalid prefix: %s", prefix)
+	}
+	length := prefix.Bits()
+	if prefix.Addr().Is4() {
+		length += 96
+	}
+	bytes := prefix.Addr().As16()
+	return NewIPv6Address(bytes[:], uint(length)), nil
+}
+
+// Addr returns the address as a netip.Addr, ignoring its length
+// - IPv4-mapped addresses stay IPv6 - use Unmap on the result to convert them
+func (ip IPv6Address) Addr() netip.Addr {
+	var bytes [16]byte
+	binary.BigEndian.PutUint64(bytes[:], ip.Left)
+	binary.BigEndian.PutUint64(bytes[8:], ip.Right)
+	return netip.AddrFrom16(bytes)
+}
+
+// Prefix returns the address and length as a netip.Prefix
+// - host bits are kept - the returned prefix is invalid if the length is over 128
+func (ip IPv6Address) Prefix() netip.Prefix {
+	return netip.PrefixFrom(ip.Addr(), int(ip.Length))
+}
+
+// String returns the address in CIDR notation, compressed as described in RFC 5952, such as 2001:db8::/32
+func (ip IPv6Address) String() string {
+	return string(ip.appendText(make([]byte, 0, 43)))
+}
+
+// AppendText appends the address in CIDR notation, compressed as described in RFC 5952, to b, returning the extended buffer
+func (ip IPv6Address) AppendText(b []byte) ([]byte, error) {
+	if ip.Length > 128 {
+		return b, fmt.Errorf("invalid IPv6 prefix length: %d", ip.Length)
+	}
+	return ip.appendText(b), nil
+}
+
+func (ip IPv6Address) appendText(b []byte) []byte {
+	b = ip.Addr().AppendTo(b)
+	b = append(b, '/')
+	return strconv.AppendUint(b, uint64(ip.Length), 10)
+}
+
+// MarshalText returns the address in CIDR notation, compressed as described in RFC 5952
+func (ip IPv6Address) MarshalText() ([]byte, error) {
+	return ip.AppendText(make([]byte, 0, 43))
+}
+
+// UnmarshalText parses an address or CIDR, as ParseIP does, but keeps any host bits set beyond the length
+// - a missing length defaults to 128
+// - so text from MarshalText, such as 2001:db8::1/32, reads back as the same address
+func (ip *IPv6Address) UnmarshalText(text []byte) error {
+	parsed, err := parseIPUnmasked(text)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsV6 {
+		return fmt.Errorf("not an IPv6 address: %q", text)
+	}
+	*ip = parsed.V6
+	return nil
+}
+
+// MarshalJSON returns the address in CIDR notation as a JSON string
+func (ip IPv6Address) MarshalJSON() ([]byte, error) {
+	text, err := ip.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON parses an address or CIDR from a JSON string
+// - null leaves the address unchanged
+func (ip *IPv6Address) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return ip.UnmarshalText([]byte(text))
+}
+
+// Unmap returns the IPv4 address or prefix within an IPv4-mapped address or prefix, such as ::ffff:198.51.100.7
+// - returns false if the address isn't within ::ffff:0:0/96, or is shorter than /96
+func (ip IPv6Address) Unmap() (IPv4Address, bool) {
+	if ip.Left != 0 || ip.Right>>32 != 0xffff || ip.Length < 96 || ip.Length > 128 {
+		return IPv4Address{}, false
+	}
+	return NewIPv4Address(uint32(ip.Right), ip.Length-96), true
+}
+
+// UnmapCompatible returns the IPv4 address or prefix within a deprecated IPv4-compatible address or prefix, such as ::198.51.100.7
+// - returns false if the address isn't within ::/96, or is shorter than /96
+// - the unspecified and loopback addresses, :: and ::1, aren't IPv4-compatible
+func (ip IPv6Address) UnmapCompatible() (IPv4Address, bool) {
+	if ip.Left != 0 || ip.Right>>32 != 0 || ip.Length < 96 || ip.Length > 128 || (ip.Length == 128 && ip.Right <= 1) {
+		return IPv4Address{}, false
+	}
+	return NewIPv4Address(uint32(ip.Right), ip.Length-96), true
+}
+
+// masked returns the address with the host bits beyond its length cleared
+func (ip IPv6Address) masked() IPv6Address {
+	if ip.Length <= 64 {
+		ip.Left &= _leftMasks64[ip.Length]
+		ip.Right = 0
+	} else {
+		ip.Right &= _leftMasks64[ip.Length-64]
+	}
+	return ip
+}
+
 // ShiftLeft shifts the bits |bitCount| bits left
 func (ip *IPv6Address) ShiftLeft(bitCount uint) {
 	ip.Left, ip.Right, ip.Length = ShiftLeftIPv6(ip.Left, ip.Right, ip.Length, bitCount)
@@ -67,3 +204,12 @@ func ShiftRightIPv6(left uint64, right uint64, bitCount uint) (uint64, uint64) {
 func (ip *IPv6Address) IsLeftBitSet() bool {
 	return ip.Left >= _leftmost64Bit
 }
+
+// CommonPrefixLength returns how many leading bits the two addresses have in common, up to the shorter of their lengths
+func (ip IPv6Address) CommonPrefixLength(other IPv6Address) uint {
+	common := uint(bits.LeadingZeros64(ip.Left ^ other.Left))
+	if common == 64 {
+		common += uint(bits.LeadingZeros64(ip.Right ^ other.Right))
+	}
+	return min(common, ip.Length, other.Length)
+}
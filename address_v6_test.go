@@ -1,6 +1,9 @@
 package patricia
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -79,3 +82,137 @@ func TestShiftRightIPv6(t *testing.T) {
 	assert.Equal(t, uint64(0x0), newLeft)
 	assert.Equal(t, uint64(0x81018202830), newRight)
 }
+
+func TestCommonPrefixLengthV6(t *testing.T) {
+	a := IPv6Address{Left: 0x20010db800000000, Right: 0x1, Length: 128}
+	b := IPv6Address{Left: 0x20010db800000000, Right: 0x2, Length: 128}
+	assert.Equal(t, uint(126), a.CommonPrefixLength(b))
+	assert.Equal(t, uint(128), a.CommonPrefixLength(a))
+
+	b.Length = 64
+	assert.Equal(t, uint(64), a.CommonPrefixLength(b))
+
+	b = IPv6Address{Left: 0x20010db900000000, Right: 0x1, Length: 128}
+	assert.Equal(t, uint(31), a.CommonPrefixLength(b))
+}
+
+func TestIPv6AddressNetip(t *testing.T) {
+	address, err := IPv6AddressFromPrefix(netip.MustParsePrefix("2001:db8::1/32"))
+	assert.NoError(t, err)
+	assert.Equal(t, IPv6Address{Left: 0x20010db800000000, Right: 0x1, Length: 32}, address)
+	assert.Equal(t, netip.MustParsePrefix("2001:db8::1/32"), address.Prefix())
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), address.Addr())
+
+	// IPv4 is mapped, and mapped addresses stay IPv6
+	address, err = IPv6AddressFromPrefix(netip.MustParsePrefix("10.1.2.3/24"))
+	assert.NoError(t, err)
+	assert.Equal(t, IPv6Address{Left: 0, Right: 0xffff0a010203, Length: 120}, address)
+	assert.Equal(t, netip.MustParsePrefix("::ffff:10.1.2.3/120"), address.Prefix())
+	address, err = IPv6AddressFromAddr(netip.MustParseAddr("10.1.2.3"))
+	assert.NoError(t, err)
+	assert.Equal(t, IPv6Address{Left: 0, Right: 0xffff0a010203, Length: 128}, address)
+	assert.Equal(t, netip.MustParseAddr("10.1.2.3"), address.Addr().Unmap())
+
+	address, err = IPv6AddressFromAddr(netip.MustParseAddr("fe80::1%eth0"))
+	assert.NoError(t, err)
+	assert.Equal(t, IPv6Address{Left: 0xfe80000000000000, Right: 0x1, Length: 128}, address)
+
+	_, err = IPv6AddressFromPrefix(netip.Prefix{})
+	assert.Error(t, err)
+	_, err = IPv6AddressFromAddr(netip.Addr{})
+	assert.Error(t, err)
+	assert.False(t, IPv6Address{Length: 129}.Prefix().IsValid())
+
+	// round trips
+	for _, s := range []string{"::/0", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128", "8000::/1", "2001:db8:1234::5/67"} {
+		address, err = IPv6AddressFromPrefix(netip.MustParsePrefix(s))
+		assert.NoError(t, err)
+		assert.Equal(t, s, address.Prefix().String())
+	}
+
+	prefix := netip.MustParsePrefix("2001:db8::1/32")
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		address, _ := IPv6AddressFromPrefix(prefix)
+		prefix = address.Prefix()
+	}))
+}
+
+func TestIPv6AddressText(t *testing.T) {
+	assert.Equal(t, "2001:db8::/32", IPv6Address{Left: 0x20010db800000000, Length: 32}.String())
+	assert.Equal(t, "::/0", IPv6Address{}.String())
+	assert.Equal(t, "2001:db8::1:0:0:1/128", IPv6Address{Left: 0x20010db800000000, Right: 0x0001000000000001, Length: 128}.String())
+	assert.Equal(t, "2001:0:0:1::1/128", IPv6Address{Left: 0x2001000000000001, Right: 0x1, Length: 128}.String())
+	assert.Equal(t, "2001:db8:0:1:1:1:1:1/128", IPv6Address{Left: 0x20010db800000001, Right: 0x0001000100010001, Length: 128}.String())
+	assert.Equal(t, "fe80::abcd/128", fmt.Sprintf("%v", IPv6Address{Left: 0xfe80000000000000, Right: 0xabcd, Length: 128}))
+
+	buf, err := IPv6Address{Right: 1, Length: 128}.AppendText([]byte("ip="))
+	assert.NoError(t, err)
+	assert.Equal(t, "ip=::1/128", string(buf))
+	_, err = IPv6Address{Length: 129}.AppendText(nil)
+	assert.Error(t, err)
+	_, err = IPv6Address{Length: 129}.MarshalJSON()
+	assert.Error(t, err)
+
+	// round trips through ParseIPFromString
+	for _, s := range []string{"::/0", "2001:db8::/32", "2001:db8:0:1::/64", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128", "::1"} {
+		_, expected, err := ParseIPFromString(s)
+		assert.NoError(t, err)
+
+		text, err := expected.MarshalText()
+		assert.NoError(t, err)
+		var address IPv6Address
+		assert.NoError(t, address.UnmarshalText(text))
+		assert.Equal(t, *expected, address)
+
+		_, reparsed, err := ParseIPFromString(expected.String())
+		assert.NoError(t, err)
+		assert.Equal(t, expected, reparsed)
+	}
+
+	var address IPv6Address
+	assert.Error(t, address.UnmarshalText([]byte("10.0.0.0/8")))
+	assert.Error(t, address.UnmarshalText([]byte("nope")))
+
+	data, err := json.Marshal(map[string]IPv6Address{"net": {Left: 0x20010db800000000, Length: 32}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"net":"2001:db8::/32"}`, string(data))
+	var decoded map[string]IPv6Address
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, IPv6Address{Left: 0x20010db800000000, Length: 32}, decoded["net"])
+
+	// host bits survive the round trip
+	withHost := IPv6Address{Left: 0x20010db800000000, Right: 1, Length: 32}
+	data, err = json.Marshal(map[string]IPv6Address{"net": withHost})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"net":"2001:db8::1/32"}`, string(data))
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, withHost, decoded["net"])
+
+	assert.Error(t, json.Unmarshal([]byte(`{"net":"10.0.0.0/8"}`), &decoded))
+}
+
+func TestIPv6AddressUnmap(t *testing.T) {
+	v4, ok := IPv6Address{Right: 0xffffc6336407, Length: 128}.Unmap()
+	assert.True(t, ok)
+	assert.Equal(t, NewIPv4Address(0xc6336407, 32), v4)
+	v4, ok = IPv6Address{Right: 0xffff00000000, Length: 96}.Unmap()
+	assert.True(t, ok)
+	assert.Equal(t, NewIPv4Address(0, 0), v4)
+
+	_, ok = IPv6Address{Right: 0xffff00000000, Length: 95}.Unmap()
+	assert.False(t, ok)
+	_, ok = IPv6Address{Right: 0xc6336407, Length: 128}.Unmap()
+	assert.False(t, ok)
+	_, ok = IPv6Address{Left: 1, Right: 0xffffc6336407, Length: 128}.Unmap()
+	assert.False(t, ok)
+
+	v4, ok = IPv6Address{Right: 0xc6336407, Length: 128}.UnmapCompatible()
+	assert.True(t, ok)
+	assert.Equal(t, NewIPv4Address(0xc6336407, 32), v4)
+	_, ok = IPv6Address{Right: 1, Length: 128}.UnmapCompatible()
+	assert.False(t, ok)
+	_, ok = IPv6Address{Length: 128}.UnmapCompatible()
+	assert.False(t, ok)
+	_, ok = IPv6Address{Right: 0xffffc6336407, Length: 128}.UnmapCompatible()
+	assert.False(t, ok)
+}
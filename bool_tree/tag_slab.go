@@ -0,0 +1,83 @@
+package bool_tree
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+)
+
+// maxTagSlots is how long a tree's tag slab can grow, as blocks are addressed by 32-bit offsets
+// - a variable, so tests can fill a slab without allocating one this big
+var maxTagSlots = uint64(^uint32(0))
+
+// tagSlab keeps the tags of all of a tree's nodes in one slice, so the garbage collector has a single object to
+// skip, rather than one per node
+// - each node's tags are kept together in a block of the slice, which it records in its tagBlock
+// - blocks are sized in powers of two, so a node's tags can grow without being moved each time
+// - blocks no longer used are kept on free lists, by size, to be reused by other nodes
+type tagSlab struct {
+	slots     []storedTag
+	free      [32][]tagBlock // free blocks, by the floor of log2 of their capacity
+	freeSlots int            // total capacity of the free blocks
+}
+
+// tagBlock is where a node's tags are kept in the tree's tag slab
+// - a node without tags has an empty block
+type tagBlock struct {
+	offset   uint32
+	capacity uint32
+}
+
+// tags returns the first count tags of the block, pointing into the slab
+func (s *tagSlab) tags(block tagBlock, count int) []storedTag {
+	return s.slots[block.offset : int(block.offset)+count : int(block.offset)+count]
+}
+
+// alloc returns a block with room for at least minCapacity tags, reusing a free one if there is one
+// - returns an error if the slab can't grow to fit it, past maxTagSlots
+func (s *tagSlab) alloc(minCapacity int) (tagBlock, error) {
+	if uint64(minCapacity) > 1<<31 {
+		return tagBlock{}, fmt.Errorf("tag slab is full: can't add a block of %d tags", minCapacity)
+	}
+	capacity := uint32(1) << bits.Len32(uint32(minCapacity-1))
+	class := bits.Len32(capacity) - 1
+
+	// blocks in the class all have at least the capacity, as it's a power of two
+	if freeCount := len(s.free[class]); freeCount > 0 {
+		block := s.free[class][freeCount-1]
+		s.free[class] = s.free[class][:freeCount-1]
+		s.freeSlots -= int(block.capacity)
+		return block, nil
+	}
+
+	offset := len(s.slots)
+	if uint64(offset)+uint64(capacity) > maxTagSlots {
+		return tagBlock{}, fmt.Errorf("tag slab is full: can't add a block of %d tags to %d slots", capacity, offset)
+	}
+	s.slots = slices.Grow(s.slots, int(capacity))[:offset+int(capacity)]
+	clear(s.slots[offset:])
+	return tagBlock{offset: uint32(offset), capacity: capacity}, nil
+}
+
+// release puts the block on the free list, to be reused
+func (s *tagSlab) release(block tagBlock) {
+	if block.capacity == 0 {
+		return
+	}
+	// clear the tags, so any they reference can be collected
+	clear(s.slots[block.offset : block.offset+block.capacity])
+	class := bits.Len32(block.capacity) - 1
+	s.free[class] = append(s.free[class], block)
+	s.freeSlots += int(block.capacity)
+}
+
+// clone returns a copy of the slab, for a cloned tree
+func (s *tagSlab) clone() tagSlab {
+	ret := tagSlab{slots: slices.Clone(s.slots), freeSlots: s.freeSlots}
+	for class, free := range s.free {
+		if len(free) > 0 {
+			ret.free[class] = slices.Clone(free)
+		}
+	}
+	return ret
+}
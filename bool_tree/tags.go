@@ -0,0 +1,29 @@
+package bool_tree
+
+// storedTag is how tags are kept in the tree: as themselves, for payload types without pointers
+type storedTag = bool
+
+// tagStore converts tags to and from how they're kept in the tree
+// - payload types with pointers, which the garbage collector would have to scan, replace this file with their own storage
+type tagStore struct{}
+
+// store returns the tag as it's kept in the tree
+// - returns an error if there's no room left to keep it
+func (s *tagStore) store(tag bool) (storedTag, error) {
+	return tag, nil
+}
+
+// load returns the tag kept in the tree
+func (s *tagStore) load(stored storedTag) bool {
+	return stored
+}
+
+// clone returns a copy of the store, for a cloned tree
+func (s *tagStore) clone() tagStore {
+	return tagStore{}
+}
+
+// allocatedBytes estimates the memory held by the store, beyond the tree's tag slab
+func (s *tagStore) allocatedBytes() int {
+	return 0
+}
@@ -0,0 +1,382 @@
+package bool_tree
+
+import (
+	"iter"
+
+	"github.com/kentik/patricia"
+)
+
+// FrozenTreeV4 is an immutable IPv4 tree, laid out for fast lookups
+// - nodes are numbered in depth-first order, so lookups touch nearby memory
+// - tags are stored in one contiguous slice, with each node holding the offset and count of its own
+// - tag slices returned by its methods point into the tree, and must not be modified
+type FrozenTreeV4 struct {
+	nodes []frozenTreeV4Node // root is always at [1] - [0] is unused
+	tags  []bool
+}
+
+type frozenTreeV4Node struct {
+	treeNodeV4
+	tagOffset int // index of the node's first tag
+}
+
+// Freeze returns an immutable copy of the tree, laid out for fast lookups
+func (t *TreeV4) Freeze() *FrozenTreeV4 {
+	order := t.nodeOrder()
+	newIndexes := make([]uint, len(t.nodes)) // index 0 stays 0, for 'not set'
+	for i, nodeIndex := range order {
+		newIndexes[nodeIndex] = uint(i + 1)
+	}
+
+	ret := &FrozenTreeV4{
+		nodes: make([]frozenTreeV4Node, len(order)+1),
+		tags:  make([]bool, 0, len(t.tags.slots)),
+	}
+	for i, nodeIndex := range order {
+		node := t.nodes[nodeIndex]
+		node.Left = newIndexes[node.Left]
+		node.Right = newIndexes[node.Right]
+		ret.nodes[i+1] = frozenTreeV4Node{treeNodeV4: node, tagOffset: len(ret.tags)}
+
+		for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+			ret.tags = append(ret.tags, t.tagStorage.load(stored))
+		}
+	}
+	return ret
+}
+
+// tagsForNode returns the node's tags, pointing into the tree's tag slice
+func (t *FrozenTreeV4) tagsForNode(nodeIndex uint) []bool {
+	node := &t.nodes[nodeIndex]
+	return t.tags[node.tagOffset : node.tagOffset+node.TagCount : node.tagOffset+node.TagCount]
+}
+
+// FindTags finds all matching tags, the same as (*TreeV4).FindTags
+func (t *FrozenTreeV4) FindTags(address patricia.IPv4Address) ([]bool, error) {
+	return t.FindTagsAppend(make([]bool, 0), address), nil
+}
+
+// FindTagsWithFilter finds all matching tags that passes the filter function, the same as (*TreeV4).FindTagsWithFilter
+func (t *FrozenTreeV4) FindTagsWithFilter(address patricia.IPv4Address, filterFunc FilterFunc) ([]bool, error) {
+	return t.FindTagsWithFilterAppend(make([]bool, 0), address, filterFunc), nil
+}
+
+// FindTagsAppend appends all matching tags to dst, the same as (*TreeV4).FindTagsAppend
+func (t *FrozenTreeV4) FindTagsAppend(dst []bool, address patricia.IPv4Address) []bool {
+	root := &t.nodes[1]
+	if root.TagCount > 0 {
+		dst = append(dst, t.tagsForNode(1)...)
+	}
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		return dst
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return dst
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			return dst
+		}
+
+		// matched the full node - get its tags, then chop off the bits we've already matched and continue
+		if node.TagCount > 0 {
+			dst = append(dst, t.tags[node.tagOffset:node.tagOffset+node.TagCount]...)
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return dst
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindTagsWithFilterAppend appends all matching tags that pass the filter function to dst, the same as
+// (*TreeV4).FindTagsWithFilterAppend
+func (t *FrozenTreeV4) FindTagsWithFilterAppend(dst []bool, address patricia.IPv4Address, filterFunc FilterFunc) []bool {
+	if filterFunc == nil {
+		return t.FindTagsAppend(dst, address)
+	}
+
+	t.VisitTags(address, func(tag bool) bool {
+		if filterFunc(tag) {
+			dst = append(dst, tag)
+		}
+		return true
+	})
+	return dst
+}
+
+// VisitTags calls visitFunc with each matching tag, the same as (*TreeV4).VisitTags
+func (t *FrozenTreeV4) VisitTags(address patricia.IPv4Address, visitFunc func(tag bool) bool) {
+	nodeIndex := uint(1)
+	for nodeIndex != 0 {
+		node := &t.nodes[nodeIndex]
+		if nodeIndex != 1 {
+			matchCount := node.MatchCount(address)
+			if matchCount < node.prefixLength {
+				// didn't match the entire node - we're done
+				return
+			}
+			address.ShiftLeft(matchCount)
+		}
+		for _, tag := range t.tags[node.tagOffset : node.tagOffset+node.TagCount] {
+			if !visitFunc(tag) {
+				return
+			}
+		}
+		if address.Length == 0 {
+			// exact match - we're done
+			return
+		}
+
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindDeepestTag finds a tag at the deepest level in the tree, the same as (*TreeV4).FindDeepestTag
+func (t *FrozenTreeV4) FindDeepestTag(address patricia.IPv4Address) (bool, bool, error) {
+	root := &t.nodes[1]
+	var found bool
+	var ret bool
+
+	if root.TagCount > 0 {
+		ret = t.tags[root.tagOffset]
+		found = true
+	}
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		return found, ret, nil
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return found, ret, nil
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			return found, ret, nil
+		}
+
+		// matched the full node - get its tags, then chop off the bits we've already matched and continue
+		if node.TagCount > 0 {
+			ret = t.tags[node.tagOffset]
+			found = true
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return found, ret, nil
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindDeepestMatch finds the deepest tagged prefix in the tree that contains the input address, the same as
+// (*TreeV4).FindDeepestMatch
+func (t *FrozenTreeV4) FindDeepestMatch(address patricia.IPv4Address) (patricia.IPv4Address, []bool, bool) {
+	var matchIndex uint
+	var matchAddress patricia.IPv4Address
+	var nodeAddress patricia.IPv4Address
+
+	nodeIndex := uint(1)
+	for nodeIndex != 0 {
+		node := &t.nodes[nodeIndex]
+		if nodeIndex != 1 {
+			matchCount := node.MatchCount(address)
+			if matchCount < node.prefixLength {
+				// didn't match the entire node - we're done
+				break
+			}
+			nodeAddress = node.AppendPrefix(nodeAddress)
+			address.ShiftLeft(matchCount)
+		}
+		if node.TagCount > 0 {
+			matchIndex = nodeIndex
+			matchAddress = nodeAddress
+		}
+		if address.Length == 0 {
+			// exact match - we're done
+			break
+		}
+
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+
+	if matchIndex == 0 {
+		return matchAddress, nil, false
+	}
+	return matchAddress, t.tagsForNode(matchIndex), true
+}
+
+// GetExact returns the tags stored at exactly the input address, the same as (*TreeV4).GetExact
+func (t *FrozenTreeV4) GetExact(address patricia.IPv4Address) ([]bool, bool) {
+	nodeIndex := t.findExactNode(address)
+	if nodeIndex == 0 || t.nodes[nodeIndex].TagCount == 0 {
+		return nil, false
+	}
+	return t.tagsForNode(nodeIndex), true
+}
+
+// HasExact returns whether the input address itself has tags, the same as (*TreeV4).HasExact
+func (t *FrozenTreeV4) HasExact(address patricia.IPv4Address) bool {
+	nodeIndex := t.findExactNode(address)
+	return nodeIndex != 0 && t.nodes[nodeIndex].TagCount > 0
+}
+
+// Walk calls visitFunc with the full prefix and tags of each tagged node in the tree, the same as (*TreeV4).Walk
+func (t *FrozenTreeV4) Walk(visitFunc func(address patricia.IPv4Address, tags []bool) bool) {
+	t.walk(1, patricia.IPv4Address{}, visitFunc)
+}
+
+// All returns an iterator over the full prefix and tags of each tagged node in the tree, the same as (*TreeV4).All
+func (t *FrozenTreeV4) All() iter.Seq2[patricia.IPv4Address, []bool] {
+	return func(yield func(patricia.IPv4Address, []bool) bool) {
+		t.Walk(yield)
+	}
+}
+
+// WalkSubtree calls visitFunc with the full prefix and tags of each tagged node contained within the input address,
+// the same as (*TreeV4).WalkSubtree
+func (t *FrozenTreeV4) WalkSubtree(address patricia.IPv4Address, visitFunc func(address patricia.IPv4Address, tags []bool) bool) {
+	// find the highest node within the address, keeping track of its full prefix
+	nodeIndex := uint(1)
+	var nodeAddress patricia.IPv4Address
+	for nodeIndex != 0 && address.Length > 0 {
+		node := &t.nodes[nodeIndex]
+		if nodeIndex != 1 {
+			matchCount := node.MatchCount(address)
+			if matchCount == address.Length {
+				// the rest of the address matched - this node, and everything under it, is within the address
+				t.walk(nodeIndex, node.AppendPrefix(nodeAddress), visitFunc)
+				return
+			}
+			if matchCount < node.prefixLength {
+				return
+			}
+			nodeAddress = node.AppendPrefix(nodeAddress)
+			address.ShiftLeft(matchCount)
+		}
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+	if nodeIndex != 0 {
+		t.walk(nodeIndex, nodeAddress, visitFunc)
+	}
+}
+
+// FindTagsUnder finds every tagged prefix contained within the input address, the same as (*TreeV4).FindTagsUnder
+func (t *FrozenTreeV4) FindTagsUnder(address patricia.IPv4Address) ([]patricia.IPv4Address, [][]bool, error) {
+	retAddresses := make([]patricia.IPv4Address, 0)
+	retTags := make([][]bool, 0)
+	t.WalkSubtree(address, func(address patricia.IPv4Address, tags []bool) bool {
+		retAddresses = append(retAddresses, address)
+		retTags = append(retTags, tags)
+		return true
+	})
+	return retAddresses, retTags, nil
+}
+
+// find the node whose full prefix is exactly the input address, returning its index, or 0 if there isn't one
+func (t *FrozenTreeV4) findExactNode(address patricia.IPv4Address) uint {
+	nodeIndex := uint(1)
+	for nodeIndex != 0 && address.Length > 0 {
+		node := &t.nodes[nodeIndex]
+		if nodeIndex != 1 {
+			matchCount := node.MatchCount(address)
+			if matchCount < node.prefixLength {
+				return 0
+			}
+			if matchCount == address.Length {
+				return nodeIndex
+			}
+			address.ShiftLeft(matchCount)
+		}
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+	return nodeIndex
+}
+
+// walk the subtree at startIndex, whose full prefix is startAddress, calling visitFunc for each node with tags
+func (t *FrozenTreeV4) walk(startIndex uint, startAddress patricia.IPv4Address, visitFunc func(address patricia.IPv4Address, tags []bool) bool) {
+	type stackEntry struct {
+		nodeIndex uint
+		address   patricia.IPv4Address
+	}
+
+	stack := make([]stackEntry, 1, 64)
+	stack[0] = stackEntry{nodeIndex: startIndex, address: startAddress}
+	for len(stack) > 0 {
+		entry := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node := &t.nodes[entry.nodeIndex]
+		if node.TagCount > 0 && !visitFunc(entry.address, t.tagsForNode(entry.nodeIndex)) {
+			return
+		}
+
+		// push right first, so left is visited first
+		if node.Right != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Right, address: t.nodes[node.Right].AppendPrefix(entry.address)})
+		}
+		if node.Left != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Left, address: t.nodes[node.Left].AppendPrefix(entry.address)})
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package bool_tree
+
+import (
+	"github.com/kentik/patricia"
+)
+
+// Ranges are added to the tree as the fewest prefixes that cover them, from patricia.IPv4AddressRange.Prefixes.
+// Each range runs from the first address of start to the last address of end.
+// Range changes aren't atomic: the prefixes are changed one at a time, and if one of them fails, the prefixes
+// changed before it stay changed, and the returned count only covers them. To apply a range all or nothing, make
+// the change in SyncTreeV4.Update, which drops the whole update on an error.
+
+// AddRange adds a tag to each prefix covering the range
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at each prefix
+// - returns how many prefixes' tag counts were increased, up to the prefix that failed if there's an error
+func (t *TreeV4) AddRange(start patricia.IPv4Address, end patricia.IPv4Address, tag bool, matchFunc MatchesFunc) (int, error) {
+	return t.addRange(start, end, tag, matchFunc, false)
+}
+
+// SetRange sets the single value for each prefix covering the range
+// - returns how many prefixes' tag counts were increased, up to the prefix that failed if there's an error
+func (t *TreeV4) SetRange(start patricia.IPv4Address, end patricia.IPv4Address, tag bool) (int, error) {
+	return t.addRange(start, end, tag, nil, true)
+}
+
+func (t *TreeV4) addRange(start patricia.IPv4Address, end patricia.IPv4Address, tag bool, matchFunc MatchesFunc, replaceFirst bool) (int, error) {
+	addressRange, err := patricia.NewIPv4AddressRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, prefix := range addressRange.Prefixes() {
+		countIncreased, _, err := t.add(prefix, tag, matchFunc, replaceFirst)
+		if err != nil {
+			return count, err
+		}
+		if countIncreased {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteRange deletes the tags matching matchVal from each prefix covering the range, as added by AddRange
+// - tags on prefixes within or around the range, that aren't part of its cover, are kept
+// - returns how many tags are removed, up to the prefix that failed if there's an error
+func (t *TreeV4) DeleteRange(start patricia.IPv4Address, end patricia.IPv4Address, matchFunc MatchesFunc, matchVal bool) (int, error) {
+	addressRange, err := patricia.NewIPv4AddressRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, prefix := range addressRange.Prefixes() {
+		deleted, err := t.Delete(prefix, matchFunc, matchVal)
+		count += deleted
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
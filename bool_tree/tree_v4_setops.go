@@ -0,0 +1,115 @@
+package bool_tree
+
+import (
+	"github.com/kentik/patricia"
+)
+
+// Set operations treat each tree as the set of addresses covered by its tagged prefixes, whatever the tags are.
+// They work structurally on the prefixes, rather than the addresses, and return a new tree holding the fewest
+// prefixes that cover the result, each tagged with the input tag.
+
+// Union returns a tree covering the addresses covered by either tree
+func (t *TreeV4) Union(other *TreeV4, tag bool) *TreeV4 {
+	return t.setOperation(other, tag, func(inThis bool, inOther bool) bool {
+		return inThis || inOther
+	})
+}
+
+// Intersect returns a tree covering the addresses covered by both trees
+func (t *TreeV4) Intersect(other *TreeV4, tag bool) *TreeV4 {
+	return t.setOperation(other, tag, func(inThis bool, inOther bool) bool {
+		return inThis && inOther
+	})
+}
+
+// Difference returns a tree covering the addresses covered by this tree, but not the other
+func (t *TreeV4) Difference(other *TreeV4, tag bool) *TreeV4 {
+	return t.setOperation(other, tag, func(inThis bool, inOther bool) bool {
+		return inThis && !inOther
+	})
+}
+
+// Complement returns a tree covering the addresses not covered by this tree
+func (t *TreeV4) Complement(tag bool) *TreeV4 {
+	return t.setOperation(NewTreeV4(), tag, func(inThis bool, inOther bool) bool {
+		return !inThis
+	})
+}
+
+// setOperation builds the tree covering the addresses for which op returns true
+func (t *TreeV4) setOperation(other *TreeV4, tag bool, op func(inThis bool, inOther bool) bool) *TreeV4 {
+	ret := NewTreeV4()
+	root := patricia.IPv4Address{}
+	if ret.addSetOperation(root, t.coveringPrefixes(), other.coveringPrefixes(), tag, op) {
+		ret.Add(root, tag, nil)
+	}
+	return ret
+}
+
+// coveringPrefixes returns the tagged prefixes that aren't within another tagged prefix, in order
+func (t *TreeV4) coveringPrefixes() []patricia.IPv4Address {
+	ret := make([]patricia.IPv4Address, 0)
+	t.walk(1, patricia.IPv4Address{}, func(nodeIndex uint, address patricia.IPv4Address) bool {
+		if len(ret) > 0 {
+			last := ret[len(ret)-1]
+			if last.CommonPrefixLength(address) == last.Length {
+				// within the last covering prefix
+				return true
+			}
+		}
+		ret = append(ret, address)
+		return true
+	})
+	return ret
+}
+
+// addSetOperation adds the prefixes within prefix for which op returns true, given the ordered, disjoint prefixes of
+// each set within it
+// - returns true, without adding anything, if op is true for the whole prefix, so the caller can add a shorter one
+func (t *TreeV4) addSetOperation(prefix patricia.IPv4Address, this []patricia.IPv4Address, other []patricia.IPv4Address, tag bool, op func(inThis bool, inOther bool) bool) bool {
+	thisFull := len(this) == 1 && this[0].Length == prefix.Length
+	otherFull := len(other) == 1 && other[0].Length == prefix.Length
+	thisPartial := len(this) > 0 && !thisFull
+	otherPartial := len(other) > 0 && !otherFull
+
+	// done if neither set is split within the prefix, or the result doesn't depend on the split one
+	if !thisPartial && !otherPartial {
+		return op(thisFull, otherFull)
+	}
+	if !thisPartial && op(thisFull, false) == op(thisFull, true) {
+		return op(thisFull, false)
+	}
+	if !otherPartial && op(false, otherFull) == op(true, otherFull) {
+		return op(false, otherFull)
+	}
+
+	// split both sets between the two halves of the prefix - a set covering the whole prefix covers both halves
+	left := t.childPrefix(prefix, false)
+	right := t.childPrefix(prefix, true)
+	thisLeft, thisRight := t.splitPrefixes(this, thisFull, left, right)
+	otherLeft, otherRight := t.splitPrefixes(other, otherFull, left, right)
+	leftFull := t.addSetOperation(left, thisLeft, otherLeft, tag, op)
+	rightFull := t.addSetOperation(right, thisRight, otherRight, tag, op)
+	if leftFull && rightFull {
+		return true
+	}
+	if leftFull {
+		t.Add(left, tag, nil)
+	}
+	if rightFull {
+		t.Add(right, tag, nil)
+	}
+	return false
+}
+
+// splitPrefixes splits the ordered prefixes within a prefix between its left and right halves
+func (t *TreeV4) splitPrefixes(prefixes []patricia.IPv4Address, full bool, left patricia.IPv4Address, right patricia.IPv4Address) ([]patricia.IPv4Address, []patricia.IPv4Address) {
+	if full {
+		return []patricia.IPv4Address{left}, []patricia.IPv4Address{right}
+	}
+	split := 0
+	for split < len(prefixes) && !t.prefixBit(prefixes[split], left.Length-1) {
+		split++
+	}
+	return prefixes[:split], prefixes[split:]
+}
@@ -0,0 +1,153 @@
+package bool_tree
+
+import (
+	"iter"
+
+	"github.com/kentik/patricia"
+)
+
+// Walk calls visitFunc with the full prefix and tags of each tagged node in the tree
+// - prefixes are visited in order: parents before children, lower addresses before higher ones
+// - visitFunc returns false to stop the walk early
+// - the tree must not be modified during the walk
+func (t *TreeV4) Walk(visitFunc func(address patricia.IPv4Address, tags []bool) bool) {
+	t.walk(1, patricia.IPv4Address{}, func(nodeIndex uint, address patricia.IPv4Address) bool {
+		return visitFunc(address, t.tagsForNode(nodeIndex))
+	})
+}
+
+// All returns an iterator over the full prefix and tags of each tagged node in the tree, in the same order as Walk
+func (t *TreeV4) All() iter.Seq2[patricia.IPv4Address, []bool] {
+	return func(yield func(patricia.IPv4Address, []bool) bool) {
+		t.Walk(yield)
+	}
+}
+
+// walk the subtree at startIndex, whose full prefix is startAddress, calling visitFunc for each node with tags
+// - traverses with an explicit stack rather than recursion, rebuilding each node's full prefix from its parent's
+// - returns false if visitFunc stopped the walk
+func (t *TreeV4) walk(startIndex uint, startAddress patricia.IPv4Address, visitFunc func(nodeIndex uint, address patricia.IPv4Address) bool) bool {
+	type stackEntry struct {
+		nodeIndex uint
+		address   patricia.IPv4Address
+	}
+
+	stack := make([]stackEntry, 1, 64)
+	stack[0] = stackEntry{nodeIndex: startIndex, address: startAddress}
+	for len(stack) > 0 {
+		entry := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if t.nodes[entry.nodeIndex].TagCount > 0 {
+			if !visitFunc(entry.nodeIndex, entry.address) {
+				return false
+			}
+		}
+
+		// push right first, so left is visited first
+		node := &t.nodes[entry.nodeIndex]
+		if node.Right != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Right, address: t.nodes[node.Right].AppendPrefix(entry.address)})
+		}
+		if node.Left != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Left, address: t.nodes[node.Left].AppendPrefix(entry.address)})
+		}
+	}
+	return true
+}
+
+// WalkSubtree calls visitFunc with the full prefix and tags of each tagged node contained within the input address,
+// including the address itself, in the same order as Walk
+// - only the subtree under the input address is traversed
+// - visitFunc returns false to stop the walk early
+func (t *TreeV4) WalkSubtree(address patricia.IPv4Address, visitFunc func(address patricia.IPv4Address, tags []bool) bool) {
+	nodeIndex, nodeAddress, found := t.findSubtree(address)
+	if !found {
+		return
+	}
+	t.walk(nodeIndex, nodeAddress, func(nodeIndex uint, address patricia.IPv4Address) bool {
+		return visitFunc(address, t.tagsForNode(nodeIndex))
+	})
+}
+
+// FindTagsUnder finds every tagged prefix contained within the input address, including the address itself
+// - returns the full prefixes, and the tags for each of them at the same index
+func (t *TreeV4) FindTagsUnder(address patricia.IPv4Address) ([]patricia.IPv4Address, [][]bool, error) {
+	retAddresses := make([]patricia.IPv4Address, 0)
+	retTags := make([][]bool, 0)
+	t.WalkSubtree(address, func(address patricia.IPv4Address, tags []bool) bool {
+		retAddresses = append(retAddresses, address)
+		retTags = append(retTags, tags)
+		return true
+	})
+	return retAddresses, retTags, nil
+}
+
+// find the highest node whose full prefix is contained within the input address
+// - returns the node's index and full prefix, and whether there is such a node
+func (t *TreeV4) findSubtree(address patricia.IPv4Address) (uint, patricia.IPv4Address, bool) {
+	root := &t.nodes[1]
+	nodeAddress := patricia.IPv4Address{}
+
+	if address.Length == 0 {
+		// everything is under the root
+		return 1, nodeAddress, true
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return 0, nodeAddress, false
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount == address.Length {
+			// the rest of the address matched - this node, and everything under it, is within the address
+			return nodeIndex, node.AppendPrefix(nodeAddress), true
+		}
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - nothing in the tree is within the address
+			return 0, nodeAddress, false
+		}
+
+		// matched the full node, but there's still more address - keep traversing
+		nodeAddress = node.AppendPrefix(nodeAddress)
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// nodeOrder returns the index of every node reachable from the root, in depth-first order: parents before children,
+// left before right
+func (t *TreeV4) nodeOrder() []uint {
+	ret := make([]uint, 0, len(t.nodes)-len(t.availableIndexes))
+	stack := make([]uint, 1, 64)
+	stack[0] = 1
+	for len(stack) > 0 {
+		nodeIndex := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		ret = append(ret, nodeIndex)
+
+		// push right first, so left is visited first
+		node := &t.nodes[nodeIndex]
+		if node.Right != 0 {
+			stack = append(stack, node.Right)
+		}
+		if node.Left != 0 {
+			stack = append(stack, node.Left)
+		}
+	}
+	return ret
+}
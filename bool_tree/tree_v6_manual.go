@@ -24,6 +24,60 @@ func (t *TreeV6) newNode(address patricia.IPv6Address, prefixLength uint) uint {
 
 func (t *TreeV6) print() {
 	for i := range t.nodes {
-		fmt.Printf("%d: \tleft: %d, right: %d, prefix: %#032b %#032b (%d), tags: (%d): %s\n", i, int(t.nodes[i].Left), int(t.nodes[i].Right), int(t.nodes[i].prefixLeft), int(t.nodes[i].prefixRight), int(t.nodes[i].prefixLength), t.nodes[i].TagCount, t.tagsForNode(uint(i)))
+		fmt.Printf("%d: \tleft: %d, right: %d, prefix: %#032b %#032b (%d), tags: (%d): %v\n", i, int(t.nodes[i].Left), int(t.nodes[i].Right), int(t.nodes[i].prefixLeft), int(t.nodes[i].prefixRight), int(t.nodes[i].prefixLength), t.nodes[i].TagCount, t.tagsForNode(uint(i)))
 	}
 }
+
+// addressFamily returns the address family written to, and expected in, the binary serialization header
+func (t *TreeV6) addressFamily() uint8 {
+	return 6
+}
+
+// addressFamily returns the address family expected in the mapped tree header
+func (t *MappedTreeV6) addressFamily() uint8 {
+	return 6
+}
+
+// FindTagsEmbedded finds all of the tags on the address's path, followed by the tags on the path of the IPv4 address
+// embedded in it, from v4Tree
+// - embedded selects the transition mechanisms (6to4, Teredo, NAT64) to extract the IPv4 address from
+func (t *TreeV6) FindTagsEmbedded(address patricia.IPv6Address, embedded patricia.EmbeddedIPv4, v4Tree *TreeV4) ([]bool, error) {
+	ret := t.FindTagsAppend(make([]bool, 0), address)
+	if v4, ok := embedded.Extract(address); ok {
+		ret = v4Tree.FindTagsAppend(ret, v4)
+	}
+	return ret, nil
+}
+
+// FindDeepestTagEmbedded finds the tag at the deepest level on the path of the IPv4 address embedded in the address,
+// from v4Tree, falling back to the deepest tag on the address's own path
+// - embedded selects the transition mechanisms (6to4, Teredo, NAT64) to extract the IPv4 address from
+func (t *TreeV6) FindDeepestTagEmbedded(address patricia.IPv6Address, embedded patricia.EmbeddedIPv4, v4Tree *TreeV4) (bool, bool, error) {
+	if v4, ok := embedded.Extract(address); ok {
+		if found, tag, err := v4Tree.FindDeepestTag(v4); found || err != nil {
+			return found, tag, err
+		}
+	}
+	return t.FindDeepestTag(address)
+}
+
+// prefixBit returns whether the bit at the 0-based position, from the left, is set in the address
+func (t *TreeV6) prefixBit(address patricia.IPv6Address, position uint) bool {
+	if position < 64 {
+		return address.Left&(uint64(1)<<(63-position)) != 0
+	}
+	return address.Right&(uint64(1)<<(127-position)) != 0
+}
+
+// childPrefix returns the left or right half of the prefix, one bit longer
+func (t *TreeV6) childPrefix(prefix patricia.IPv6Address, right bool) patricia.IPv6Address {
+	if right {
+		if prefix.Length < 64 {
+			prefix.Left |= uint64(1) << (63 - prefix.Length)
+		} else {
+			prefix.Right |= uint64(1) << (127 - prefix.Length)
+		}
+	}
+	prefix.Length++
+	return prefix
+}
@@ -0,0 +1,337 @@
+package byte_tree
+
+import (
+	"iter"
+	"net/netip"
+
+	"github.com/kentik/patricia"
+)
+
+// Tree is a dual-stack tree, routing each address to an IPv4 or IPv6 tree by its family
+// - addresses of every form are read by the tree's parser, which decides where IPv4-mapped addresses go:
+// - with patricia.MappedKeep, the default, they're added to and looked up in the IPv6 tree
+// - with patricia.MappedUnmap, they're added to and looked up in the IPv4 tree
+// - with patricia.MappedBoth, they're added to the IPv4 tree, and looked up in both trees
+type Tree struct {
+	v4       *TreeV4
+	v6       *TreeV6
+	parser   patricia.Parser
+	embedded patricia.EmbeddedIPv4
+}
+
+// NewTree returns a new, empty dual-stack tree
+func NewTree() *Tree {
+	return &Tree{
+		v4: NewTreeV4(),
+		v6: NewTreeV6(),
+	}
+}
+
+// V4 returns the tree holding IPv4 addresses
+func (t *Tree) V4() *TreeV4 {
+	return t.v4
+}
+
+// V6 returns the tree holding IPv6 addresses
+func (t *Tree) V6() *TreeV6 {
+	return t.v6
+}
+
+// SetParser sets the parser used to read addresses, including how it handles IPv4-mapped addresses
+// - changing the IPv4-mapped policy doesn't move addresses that are already in the tree
+func (t *Tree) SetParser(parser patricia.Parser) {
+	t.parser = parser
+}
+
+// SetEmbeddedIPv4 turns on lookups of the IPv4 addresses embedded in IPv6 addresses by the selected transition mechanisms
+// - FindTags* then also returns the tags of the embedded IPv4 address, after the IPv6 address's tags
+// - FindDeepestTag* then returns the embedded IPv4 address's deepest tag if it has one, and the IPv6 address's otherwise
+// - the zero value turns it off
+func (t *Tree) SetEmbeddedIPv4(embedded patricia.EmbeddedIPv4) {
+	t.embedded = embedded
+}
+
+// AddString parses the address or CIDR, and adds a tag to the tree of its family
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at this node
+// - returns whether the tag count at this address was increased, and how many tags at this address
+func (t *Tree) AddString(address string, tag byte, matchFunc MatchesFunc) (bool, int, error) {
+	parsed, err := t.parser.Parse(address)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.add(parsed, tag, matchFunc)
+}
+
+// SetString parses the address or CIDR, and sets the single value for its node in the tree of its family
+// - returns whether the tag count at this address was increased, and how many tags at this address
+func (t *Tree) SetString(address string, tag byte) (bool, int, error) {
+	parsed, err := t.parser.Parse(address)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.set(parsed, tag)
+}
+
+// DeleteString parses the address or CIDR, and deletes its tags matching matchVal. Returns how many tags are removed
+func (t *Tree) DeleteString(address string, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	parsed, err := t.parser.Parse(address)
+	if err != nil {
+		return 0, err
+	}
+	return t.delete(parsed, matchFunc, matchVal)
+}
+
+// FindTagsString parses the address or CIDR, and finds all of the tags on its path
+func (t *Tree) FindTagsString(address string) ([]byte, error) {
+	parsed, err := t.parser.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	return t.findTags(parsed)
+}
+
+// FindDeepestTagString parses the address or CIDR, and finds the tag at the deepest level on its path
+func (t *Tree) FindDeepestTagString(address string) (bool, byte, error) {
+	parsed, err := t.parser.Parse(address)
+	if err != nil {
+		var ret byte
+		return false, ret, err
+	}
+	found, tag := t.findDeepestTag(parsed)
+	return found, tag, nil
+}
+
+// AddRangeString parses the address range, and adds a tag to each prefix covering it in the tree of its family
+// - accepts the forms of patricia.Parser.ParseRange, such as 10.0.0.5-10.0.3.200 and 10.1.*.*
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at each prefix
+// - returns how many prefixes' tag counts were increased - like TreeV4.AddRange, this isn't atomic
+func (t *Tree) AddRangeString(addressRange string, tag byte, matchFunc MatchesFunc) (int, error) {
+	parsed, err := t.parser.ParseRange(addressRange)
+	if err != nil {
+		return 0, err
+	}
+	if parsed.IsV4 {
+		return t.v4.AddRange(parsed.V4.First, parsed.V4.Last, tag, matchFunc)
+	}
+	return t.v6.AddRange(parsed.V6.First, parsed.V6.Last, tag, matchFunc)
+}
+
+// SetRangeString parses the address range, and sets the single value for each prefix covering it in the tree of its family
+// - returns how many prefixes' tag counts were increased - like TreeV4.SetRange, this isn't atomic
+func (t *Tree) SetRangeString(addressRange string, tag byte) (int, error) {
+	parsed, err := t.parser.ParseRange(addressRange)
+	if err != nil {
+		return 0, err
+	}
+	if parsed.IsV4 {
+		return t.v4.SetRange(parsed.V4.First, parsed.V4.Last, tag)
+	}
+	return t.v6.SetRange(parsed.V6.First, parsed.V6.Last, tag)
+}
+
+// DeleteRangeString parses the address range, and deletes the tags matching matchVal from each prefix covering it.
+// Returns how many tags are removed - like TreeV4.DeleteRange, this isn't atomic
+func (t *Tree) DeleteRangeString(addressRange string, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	parsed, err := t.parser.ParseRange(addressRange)
+	if err != nil {
+		return 0, err
+	}
+	if parsed.IsV4 {
+		return t.v4.DeleteRange(parsed.V4.First, parsed.V4.Last, matchFunc, matchVal)
+	}
+	return t.v6.DeleteRange(parsed.V6.First, parsed.V6.Last, matchFunc, matchVal)
+}
+
+// AddPrefix adds a tag to the tree of the prefix's family
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at this node
+// - returns whether the tag count at this address was increased, and how many tags at this address
+func (t *Tree) AddPrefix(prefix netip.Prefix, tag byte, matchFunc MatchesFunc) (bool, int, error) {
+	parsed, err := t.parser.ParsePrefix(prefix)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.add(parsed, tag, matchFunc)
+}
+
+// SetPrefix sets the single value for the prefix's node in the tree of its family
+// - returns whether the tag count at this address was increased, and how many tags at this address
+func (t *Tree) SetPrefix(prefix netip.Prefix, tag byte) (bool, int, error) {
+	parsed, err := t.parser.ParsePrefix(prefix)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.set(parsed, tag)
+}
+
+// DeletePrefix deletes the prefix's tags matching matchVal. Returns how many tags are removed
+func (t *Tree) DeletePrefix(prefix netip.Prefix, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	parsed, err := t.parser.ParsePrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+	return t.delete(parsed, matchFunc, matchVal)
+}
+
+// FindTagsPrefix finds all of the tags on the prefix's path
+func (t *Tree) FindTagsPrefix(prefix netip.Prefix) ([]byte, error) {
+	parsed, err := t.parser.ParsePrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return t.findTags(parsed)
+}
+
+// FindTagsAddr finds all of the tags on the address's path
+func (t *Tree) FindTagsAddr(addr netip.Addr) ([]byte, error) {
+	parsed, err := t.parser.ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.findTags(parsed)
+}
+
+// FindTagsAddrAppend appends all of the tags on the address's path to dst, returning the extended slice
+// - doesn't allocate if dst has enough capacity
+func (t *Tree) FindTagsAddrAppend(dst []byte, addr netip.Addr) ([]byte, error) {
+	parsed, err := t.parser.ParseAddr(addr)
+	if err != nil {
+		return dst, err
+	}
+	return t.findTagsAppend(dst, parsed), nil
+}
+
+// FindDeepestTagPrefix finds the tag at the deepest level on the prefix's path
+func (t *Tree) FindDeepestTagPrefix(prefix netip.Prefix) (bool, byte, error) {
+	parsed, err := t.parser.ParsePrefix(prefix)
+	if err != nil {
+		var ret byte
+		return false, ret, err
+	}
+	found, tag := t.findDeepestTag(parsed)
+	return found, tag, nil
+}
+
+// FindDeepestTagAddr finds the tag at the deepest level on the address's path
+func (t *Tree) FindDeepestTagAddr(addr netip.Addr) (bool, byte, error) {
+	parsed, err := t.parser.ParseAddr(addr)
+	if err != nil {
+		var ret byte
+		return false, ret, err
+	}
+	found, tag := t.findDeepestTag(parsed)
+	return found, tag, nil
+}
+
+// add to the IPv4 tree if the address is IPv4 - whether or not it's also IPv6
+func (t *Tree) add(parsed patricia.ParsedIP, tag byte, matchFunc MatchesFunc) (bool, int, error) {
+	if parsed.IsV4 {
+		return t.v4.Add(parsed.V4, tag, matchFunc)
+	}
+	return t.v6.Add(parsed.V6, tag, matchFunc)
+}
+
+func (t *Tree) set(parsed patricia.ParsedIP, tag byte) (bool, int, error) {
+	if parsed.IsV4 {
+		return t.v4.Set(parsed.V4, tag)
+	}
+	return t.v6.Set(parsed.V6, tag)
+}
+
+func (t *Tree) delete(parsed patricia.ParsedIP, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	if parsed.IsV4 {
+		return t.v4.Delete(parsed.V4, matchFunc, matchVal)
+	}
+	return t.v6.Delete(parsed.V6, matchFunc, matchVal)
+}
+
+func (t *Tree) findTags(parsed patricia.ParsedIP) ([]byte, error) {
+	return t.findTagsAppend(make([]byte, 0), parsed), nil
+}
+
+// findTagsAppend looks up both families if the address is both IPv4 and IPv6, with the IPv4 tags first,
+// then the embedded IPv4 address, if any
+func (t *Tree) findTagsAppend(dst []byte, parsed patricia.ParsedIP) []byte {
+	if parsed.IsV4 {
+		dst = t.v4.FindTagsAppend(dst, parsed.V4)
+	}
+	if parsed.IsV6 {
+		dst = t.v6.FindTagsAppend(dst, parsed.V6)
+	}
+	if embedded, ok := t.embeddedIPv4(parsed); ok {
+		dst = t.v4.FindTagsAppend(dst, embedded)
+	}
+	return dst
+}
+
+// findDeepestTag looks up both families if the address is both IPv4 and IPv6, returning the tag at the longest prefix
+// - an IPv4 prefix is as long as its IPv4-mapped IPv6 prefix, and wins a tie
+// - a tag of the embedded IPv4 address, if any, wins over the IPv6 address's
+func (t *Tree) findDeepestTag(parsed patricia.ParsedIP) (bool, byte) {
+	var ret byte
+	if !parsed.IsV6 {
+		found, tag, _ := t.v4.FindDeepestTag(parsed.V4)
+		return found, tag
+	}
+	if !parsed.IsV4 {
+		if embedded, ok := t.embeddedIPv4(parsed); ok {
+			if found, tag, _ := t.v4.FindDeepestTag(embedded); found {
+				return found, tag
+			}
+		}
+		found, tag, _ := t.v6.FindDeepestTag(parsed.V6)
+		return found, tag
+	}
+
+	v4Match, v4Tags, v4Found := t.v4.FindDeepestMatch(parsed.V4)
+	v6Match, v6Tags, v6Found := t.v6.FindDeepestMatch(parsed.V6)
+	if v4Found && (!v6Found || v4Match.Length+96 >= v6Match.Length) {
+		return true, v4Tags[0]
+	}
+	if v6Found {
+		return true, v6Tags[0]
+	}
+	return false, ret
+}
+
+// embeddedIPv4 returns the IPv4 address embedded in an IPv6-only address, if embedded lookups are on
+func (t *Tree) embeddedIPv4(parsed patricia.ParsedIP) (patricia.IPv4Address, bool) {
+	if parsed.IsV4 || !t.embedded.Enabled() {
+		return patricia.IPv4Address{}, false
+	}
+	return t.embedded.Extract(parsed.V6)
+}
+
+// CountTags returns the number of tags in both trees
+func (t *Tree) CountTags() int {
+	return t.v4.tagCount + t.v6.tagCount
+}
+
+// CountNodes returns the number of nodes in both trees, including their roots
+func (t *Tree) CountNodes() int {
+	return t.v4.nodeCount() + t.v6.nodeCount()
+}
+
+// Walk calls visitFunc with the prefix and tags of each tagged node, IPv4 prefixes first, then IPv6
+// - within each family, prefixes are visited in the same order as TreeV4.Walk
+// - visitFunc returns false to stop the walk early
+// - the tree must not be modified during the walk
+func (t *Tree) Walk(visitFunc func(prefix netip.Prefix, tags []byte) bool) {
+	stopped := false
+	t.v4.Walk(func(address patricia.IPv4Address, tags []byte) bool {
+		stopped = !visitFunc(address.Prefix(), tags)
+		return !stopped
+	})
+	if stopped {
+		return
+	}
+	t.v6.Walk(func(address patricia.IPv6Address, tags []byte) bool {
+		return visitFunc(address.Prefix(), tags)
+	})
+}
+
+// All returns an iterator over the prefix and tags of each tagged node, in the same order as Walk
+func (t *Tree) All() iter.Seq2[netip.Prefix, []byte] {
+	return func(yield func(netip.Prefix, []byte) bool) {
+		t.Walk(yield)
+	}
+}
@@ -1,11 +1,19 @@
 package byte_tree
 
 import (
+	"encoding/binary"
+	"fmt"
 	"math/bits"
 
 	"github.com/kentik/patricia"
 )
 
+// size of a node's binary encoding: left, right, prefixLeft, prefixRight, prefix length, tag count
+const _treeNodeV6BinarySize = 4 + 4 + 8 + 8 + 1 + 4
+
+// the longest prefix a node can have
+const _treeNodeV6MaxPrefixLength = 128
+
 const _leftmost64Bit = uint64(1 << 63)
 
 type treeNodeV6 struct {
@@ -16,6 +24,7 @@ type treeNodeV6 struct {
 	prefixRight  uint64
 	prefixLength uint
 	TagCount     int
+	tags         tagBlock // where the tags are in the tree's tag slab
 }
 
 func (n *treeNodeV6) MatchCount(address patricia.IPv6Address) uint {
@@ -48,3 +57,34 @@ func (n *treeNodeV6) IsLeftBitSet() bool {
 func (n *treeNodeV6) MergeFromNodes(left *treeNodeV6, right *treeNodeV6) {
 	n.prefixLeft, n.prefixRight, n.prefixLength = patricia.MergePrefixes64(left.prefixLeft, left.prefixRight, left.prefixLength, right.prefixLeft, right.prefixRight, right.prefixLength)
 }
+
+// AppendPrefix returns the input address (the full prefix of this node's parent), extended by this node's prefix
+func (n *treeNodeV6) AppendPrefix(address patricia.IPv6Address) patricia.IPv6Address {
+	address.Left, address.Right, address.Length = patricia.MergePrefixes64(address.Left, address.Right, address.Length, n.prefixLeft, n.prefixRight, n.prefixLength)
+	return address
+}
+
+// EncodeBinary appends the node's fixed-width binary encoding to b
+func (n *treeNodeV6) EncodeBinary(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(n.Left))
+	b = binary.LittleEndian.AppendUint32(b, uint32(n.Right))
+	b = binary.LittleEndian.AppendUint64(b, n.prefixLeft)
+	b = binary.LittleEndian.AppendUint64(b, n.prefixRight)
+	b = append(b, uint8(n.prefixLength))
+	b = binary.LittleEndian.AppendUint32(b, uint32(n.TagCount))
+	return b
+}
+
+// DecodeBinary sets the node from its fixed-width binary encoding
+func (n *treeNodeV6) DecodeBinary(b []byte) error {
+	n.Left = uint(binary.LittleEndian.Uint32(b))
+	n.Right = uint(binary.LittleEndian.Uint32(b[4:]))
+	n.prefixLeft = binary.LittleEndian.Uint64(b[8:])
+	n.prefixRight = binary.LittleEndian.Uint64(b[16:])
+	n.prefixLength = uint(b[24])
+	n.TagCount = int(binary.LittleEndian.Uint32(b[25:]))
+	if n.prefixLength > 128 {
+		return fmt.Errorf("invalid node prefix length: %d", n.prefixLength)
+	}
+	return nil
+}
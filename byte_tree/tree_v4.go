@@ -10,7 +10,12 @@ import (
 type TreeV4 struct {
 	nodes            []treeNodeV4 // root is always at [1] - [0] is unused
 	availableIndexes []uint       // a place to store node indexes that we deleted, and are available
-	tags             map[uint64]byte
+	tags             tagSlab
+	tagStorage       tagStore
+
+	// kept up to date by add and Delete, for Stats
+	tagCount      int
+	prefixLengths [_treeNodeV4MaxPrefixLength + 1]int // tagged nodes, by the length of their full prefix
 }
 
 // NewTreeV4 returns a new Tree
@@ -18,7 +23,6 @@ func NewTreeV4() *TreeV4 {
 	return &TreeV4{
 		nodes:            make([]treeNodeV4, 2, 2), // index 0 is skipped, 1 is root
 		availableIndexes: make([]uint, 0),
-		tags:             make(map[uint64]byte),
 	}
 }
 
@@ -28,7 +32,10 @@ func (t *TreeV4) Clone() *TreeV4 {
 	ret := &TreeV4{
 		nodes:            make([]treeNodeV4, len(t.nodes), cap(t.nodes)),
 		availableIndexes: make([]uint, len(t.availableIndexes), cap(t.availableIndexes)),
-		tags:             make(map[uint64]byte),
+		tags:             t.tags.clone(),
+		tagStorage:       t.tagStorage.clone(),
+		tagCount:         t.tagCount,
+		prefixLengths:    t.prefixLengths,
 	}
 
 	for i := range t.nodes {
@@ -37,99 +44,124 @@ func (t *TreeV4) Clone() *TreeV4 {
 	for i := range t.availableIndexes {
 		ret.availableIndexes[i] = t.availableIndexes[i]
 	}
-	for k, v := range t.tags {
-		ret.tags[k] = v
-	}
 	return ret
 }
 
 // add a tag to the node at the input index, storing it in the first position if 'replaceFirst' is true
 // - if matchFunc is non-nil, will enforce uniqueness at this node
 // - returns whether the tag count was increased
-func (t *TreeV4) addTag(tag byte, nodeIndex uint, matchFunc MatchesFunc, replaceFirst bool) bool {
-	ret := true
-	if replaceFirst {
-		if t.nodes[nodeIndex].TagCount == 0 {
-			t.nodes[nodeIndex].TagCount = 1
-		} else {
-			ret = false
+// - returns an error, leaving the node as it was, if there's no room left to keep the tag
+func (t *TreeV4) addTag(tag byte, nodeIndex uint, matchFunc MatchesFunc, replaceFirst bool) (bool, error) {
+	node := &t.nodes[nodeIndex]
+	if replaceFirst && node.TagCount > 0 {
+		stored, err := t.tagStorage.store(tag)
+		if err != nil {
+			return false, err
 		}
-		t.tags[(uint64(nodeIndex) << 32)] = tag
-	} else {
-		key := (uint64(nodeIndex) << 32)
-		tagCount := t.nodes[nodeIndex].TagCount
-		if matchFunc != nil {
-			// need to check if this value already exists
-			for i := 0; i < tagCount; i++ {
-				if matchFunc(t.tags[key+uint64(i)], tag) {
-					return false
-				}
+		t.tags.slots[node.tags.offset] = stored
+		return false, nil
+	}
+
+	if matchFunc != nil && !replaceFirst {
+		// need to check if this value already exists
+		for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+			if matchFunc(t.tagStorage.load(stored), tag) {
+				return false, nil
 			}
 		}
-		t.tags[key+(uint64(tagCount))] = tag
-		t.nodes[nodeIndex].TagCount++
+	}
 
+	stored, err := t.tagStorage.store(tag)
+	if err != nil {
+		return false, err
 	}
-	return ret
+	if node.TagCount == int(node.tags.capacity) {
+		// out of room - move the tags to a block twice the size
+		block, err := t.tags.alloc(node.TagCount + 1)
+		if err != nil {
+			return false, err
+		}
+		copy(t.tags.slots[block.offset:], t.tags.tags(node.tags, node.TagCount))
+		t.tags.release(node.tags)
+		node.tags = block
+	}
+	t.tags.slots[int(node.tags.offset)+node.TagCount] = stored
+	node.TagCount++
+	return true, nil
 }
 
 func (t *TreeV4) tagsForNode(nodeIndex uint) []byte {
-	// TODO: clean up the typing in here, between uint, uint64
-	tagCount := t.nodes[nodeIndex].TagCount
-	ret := make([]byte, tagCount)
-	key := uint64(nodeIndex) << 32
-	for i := 0; i < tagCount; i++ {
-		ret[i] = t.tags[key+uint64(i)]
+	node := &t.nodes[nodeIndex]
+	ret := make([]byte, node.TagCount)
+	for i, stored := range t.tags.tags(node.tags, node.TagCount) {
+		ret[i] = t.tagStorage.load(stored)
 	}
 	return ret
 }
 
+// appendTagsForNode appends the node's tags to ret, returning the extended slice
+func (t *TreeV4) appendTagsForNode(ret []byte, nodeIndex uint) []byte {
+	node := &t.nodes[nodeIndex]
+	for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+		ret = append(ret, t.tagStorage.load(stored))
+	}
+	return ret
+}
+
+// visitTagsForNode calls visitFunc with each of the node's tags, returning false if visitFunc did
+func (t *TreeV4) visitTagsForNode(nodeIndex uint, visitFunc func(tag byte) bool) bool {
+	node := &t.nodes[nodeIndex]
+	for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+		if !visitFunc(t.tagStorage.load(stored)) {
+			return false
+		}
+	}
+	return true
+}
+
+// moveTags moves the tags of one node to another, which must have none
+// - the other node takes over the block, so the tags aren't copied, and nothing needs to be allocated
 func (t *TreeV4) moveTags(fromIndex uint, toIndex uint) {
-	tagCount := t.nodes[fromIndex].TagCount
-	fromKey := uint64(fromIndex) << 32
-	toKey := uint64(toIndex) << 32
-	for i := 0; i < tagCount; i++ {
-		t.tags[toKey+uint64(i)] = t.tags[fromKey+uint64(i)]
-		delete(t.tags, fromKey+uint64(i))
-	}
-	t.nodes[toIndex].TagCount += t.nodes[fromIndex].TagCount
-	t.nodes[fromIndex].TagCount = 0
+	from := &t.nodes[fromIndex]
+	to := &t.nodes[toIndex]
+	to.tags = from.tags
+	to.TagCount = from.TagCount
+	from.tags = tagBlock{}
+	from.TagCount = 0
 }
 
 func (t *TreeV4) firstTagForNode(nodeIndex uint) byte {
-	return t.tags[(uint64(nodeIndex) << 32)]
+	return t.tagStorage.load(t.tags.slots[t.nodes[nodeIndex].tags.offset])
 }
 
 // delete tags at the input node, returning how many were deleted, and how many are left
+// - the tags that are kept are moved down in place, and the node's block is freed if none are left
 func (t *TreeV4) deleteTag(nodeIndex uint, matchTag byte, matchFunc MatchesFunc) (int, int) {
-	// TODO: this could be done much more efficiently
-
-	// get tags
-	tags := t.tagsForNode(nodeIndex)
-
-	// delete tags
-	for i := 0; i < t.nodes[nodeIndex].TagCount; i++ {
-		delete(t.tags, (uint64(nodeIndex)<<32)+uint64(i))
-	}
-	t.nodes[nodeIndex].TagCount = 0
-
-	// put them back
-	deleteCount := 0
+	node := &t.nodes[nodeIndex]
+	tags := t.tags.tags(node.tags, node.TagCount)
 	keepCount := 0
-	for _, tag := range tags {
-		if matchFunc(tag, matchTag) {
-			deleteCount++
-		} else {
+	for _, stored := range tags {
+		if !matchFunc(t.tagStorage.load(stored), matchTag) {
 			// doesn't match - get to keep it
-			t.addTag(tag, nodeIndex, matchFunc, false)
+			tags[keepCount] = stored
 			keepCount++
 		}
 	}
+	deleteCount := node.TagCount - keepCount
+
+	node.TagCount = keepCount
+	if keepCount == 0 {
+		t.tags.release(node.tags)
+		node.tags = tagBlock{}
+	} else {
+		clear(tags[keepCount:])
+	}
 	return deleteCount, keepCount
 }
 
 // Set the single value for a node - overwrites what's there
 // Returns whether the tag count at this address was increased, and how many tags at this address
+// - returns an error, leaving the tree as it was, if there's no room left to keep the tag
 func (t *TreeV4) Set(address patricia.IPv4Address, tag byte) (bool, int, error) {
 	return t.add(address, tag, nil, true)
 }
@@ -137,6 +169,7 @@ func (t *TreeV4) Set(address patricia.IPv4Address, tag byte) (bool, int, error)
 // Add adds a tag to the tree
 // - if matchFunc is non-nil, it will be used to ensure uniqueness at this node
 // - returns whether the tag count at this address was increased, and how many tags at this address
+// - returns an error, leaving the tree as it was, if there's no room left to keep the tag
 func (t *TreeV4) Add(address patricia.IPv4Address, tag byte, matchFunc MatchesFunc) (bool, int, error) {
 	return t.add(address, tag, matchFunc, false)
 }
@@ -145,6 +178,21 @@ func (t *TreeV4) Add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 // - overwrites the first value in the list if 'replaceFirst' is true
 // - returns whether the tag count was increased, and the number of tags at this address
 func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFunc, replaceFirst bool) (bool, int, error) {
+	prefixLength := address.Length
+	countIncreased, tagCount, err := t.insert(address, tag, matchFunc, replaceFirst)
+	if countIncreased {
+		t.tagCount++
+		if tagCount == 1 {
+			t.countPrefix(prefixLength, 1)
+		}
+	}
+	return countIncreased, tagCount, err
+}
+
+// insert adds the tag to the tree, without updating the counters kept for Stats
+// - new nodes are only linked into the tree once the tag has been added to them, so if that fails, they're just made
+// available again
+func (t *TreeV4) insert(address patricia.IPv4Address, tag byte, matchFunc MatchesFunc, replaceFirst bool) (bool, int, error) {
 	// make sure we have more than enough capacity before we start adding to the tree, which invalidates pointers into the array
 	if (len(t.availableIndexes) + cap(t.nodes)) < (len(t.nodes) + 10) {
 		temp := make([]treeNodeV4, len(t.nodes), (cap(t.nodes)+1)*2)
@@ -156,8 +204,8 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 
 	// handle root tags
 	if address.Length == 0 {
-		countIncreased := t.addTag(tag, 1, matchFunc, replaceFirst)
-		return countIncreased, t.nodes[1].TagCount, nil
+		countIncreased, err := t.addTag(tag, 1, matchFunc, replaceFirst)
+		return countIncreased, t.nodes[1].TagCount, err
 	}
 
 	// root node doesn't have any prefix, so find the starting point
@@ -166,7 +214,11 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 	if !address.IsLeftBitSet() {
 		if root.Left == 0 {
 			newNodeIndex := t.newNode(address, address.Length)
-			countIncreased := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			if err != nil {
+				t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+				return false, 0, err
+			}
 			root.Left = newNodeIndex
 			return countIncreased, t.nodes[newNodeIndex].TagCount, nil
 		}
@@ -174,7 +226,11 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 	} else {
 		if root.Right == 0 {
 			newNodeIndex := t.newNode(address, address.Length)
-			countIncreased := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			if err != nil {
+				t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+				return false, 0, err
+			}
 			root.Right = newNodeIndex
 			return countIncreased, t.nodes[newNodeIndex].TagCount, nil
 		}
@@ -200,14 +256,18 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 
 			if matchCount == node.prefixLength {
 				// the whole prefix matched - we're done!
-				countIncreased := t.addTag(tag, nodeIndex, matchFunc, replaceFirst)
-				return countIncreased, t.nodes[nodeIndex].TagCount, nil
+				countIncreased, err := t.addTag(tag, nodeIndex, matchFunc, replaceFirst)
+				return countIncreased, t.nodes[nodeIndex].TagCount, err
 			}
 
 			// the input address is shorter than the match found - need to create a new, intermediate parent
 			newNodeIndex := t.newNode(address, address.Length)
 			newNode := &t.nodes[newNodeIndex]
-			countIncreased := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			if err != nil {
+				t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+				return false, 0, err
+			}
 
 			// the existing node loses those matching bits, and becomes a child of the new node
 
@@ -242,7 +302,11 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 				if node.Left == 0 {
 					// nowhere else to go - create a new node here
 					newNodeIndex := t.newNode(address, address.Length)
-					countIncreased := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+					countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+					if err != nil {
+						t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+						return false, 0, err
+					}
 					node.Left = newNodeIndex
 					return countIncreased, t.nodes[newNodeIndex].TagCount, nil
 				}
@@ -257,7 +321,11 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 			if node.Right == 0 {
 				// nowhere else to go - create a new node here
 				newNodeIndex := t.newNode(address, address.Length)
-				countIncreased := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+				countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+				if err != nil {
+					t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+					return false, 0, err
+				}
 				node.Right = newNodeIndex
 				return countIncreased, t.nodes[newNodeIndex].TagCount, nil
 			}
@@ -276,7 +344,11 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 		address.ShiftLeft(matchCount)
 
 		newNodeIndex := t.newNode(address, address.Length)
-		countIncreased := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+		countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+		if err != nil {
+			t.availableIndexes = append(t.availableIndexes, newCommonParentNodeIndex, newNodeIndex)
+			return false, 0, err
+		}
 
 		// see where the existing node fits - left or right
 		node.ShiftPrefix(matchCount)
@@ -303,6 +375,8 @@ func (t *TreeV4) add(address patricia.IPv4Address, tag byte, matchFunc MatchesFu
 
 // Delete a tag from the tree if it matches matchVal, as determined by matchFunc. Returns how many tags are removed
 func (t *TreeV4) Delete(address patricia.IPv4Address, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	prefixLength := address.Length
+
 	// traverse the tree, finding the node and its parent
 	root := &t.nodes[1]
 	var parentIndex uint
@@ -364,6 +438,10 @@ func (t *TreeV4) Delete(address patricia.IPv4Address, matchFunc MatchesFunc, mat
 
 	// delete matching tags
 	deleteCount, remainingTagCount := t.deleteTag(targetNodeIndex, matchVal, matchFunc)
+	t.tagCount -= deleteCount
+	if deleteCount > 0 && remainingTagCount == 0 {
+		t.countPrefix(prefixLength, -1)
+	}
 	if remainingTagCount > 0 {
 		// target node still has tags - we're not deleting it
 		return deleteCount, nil
@@ -447,25 +525,28 @@ func (t *TreeV4) Delete(address patricia.IPv4Address, matchFunc MatchesFunc, mat
 
 // FindTagsWithFilter finds all matching tags that passes the filter function
 func (t *TreeV4) FindTagsWithFilter(address patricia.IPv4Address, filterFunc FilterFunc) ([]byte, error) {
-	root := &t.nodes[1]
 	if filterFunc == nil {
 		return t.FindTags(address)
 	}
+	return t.FindTagsWithFilterAppend(make([]byte, 0), address, filterFunc), nil
+}
 
-	var matchCount uint
-	ret := make([]byte, 0)
+// FindTags finds all matching tags that passes the filter function
+func (t *TreeV4) FindTags(address patricia.IPv4Address) ([]byte, error) {
+	return t.FindTagsAppend(make([]byte, 0), address), nil
+}
 
+// FindTagsAppend appends all matching tags to dst, returning the extended slice
+// - doesn't allocate, as long as dst has the capacity for the tags found
+func (t *TreeV4) FindTagsAppend(dst []byte, address patricia.IPv4Address) []byte {
+	root := &t.nodes[1]
 	if root.TagCount > 0 {
-		for _, tag := range t.tagsForNode(1) {
-			if filterFunc(tag) {
-				ret = append(ret, tag)
-			}
-		}
+		dst = t.appendTagsForNode(dst, 1)
 	}
 
 	if address.Length == 0 {
 		// caller just looking for root tags
-		return ret, nil
+		return dst
 	}
 
 	var nodeIndex uint
@@ -476,32 +557,26 @@ func (t *TreeV4) FindTagsWithFilter(address patricia.IPv4Address, filterFunc Fil
 	}
 
 	// traverse the tree
-	count := 0
 	for {
-		count++
 		if nodeIndex == 0 {
-			return ret, nil
+			return dst
 		}
 		node := &t.nodes[nodeIndex]
 
-		matchCount = node.MatchCount(address)
+		matchCount := node.MatchCount(address)
 		if matchCount < node.prefixLength {
 			// didn't match the entire node - we're done
-			return ret, nil
+			return dst
 		}
 
 		// matched the full node - get its tags, then chop off the bits we've already matched and continue
 		if node.TagCount > 0 {
-			for _, tag := range t.tagsForNode(nodeIndex) {
-				if filterFunc(tag) {
-					ret = append(ret, tag)
-				}
-			}
+			dst = t.appendTagsForNode(dst, nodeIndex)
 		}
 
 		if matchCount == address.Length {
 			// exact match - we're done
-			return ret, nil
+			return dst
 		}
 
 		// there's still more address - keep traversing
@@ -514,19 +589,33 @@ func (t *TreeV4) FindTagsWithFilter(address patricia.IPv4Address, filterFunc Fil
 	}
 }
 
-// FindTags finds all matching tags that passes the filter function
-func (t *TreeV4) FindTags(address patricia.IPv4Address) ([]byte, error) {
-	var matchCount uint
-	root := &t.nodes[1]
-	ret := make([]byte, 0)
+// FindTagsWithFilterAppend appends all matching tags that pass the filter function to dst, returning the extended slice
+// - doesn't allocate, as long as dst has the capacity for the tags found
+func (t *TreeV4) FindTagsWithFilterAppend(dst []byte, address patricia.IPv4Address, filterFunc FilterFunc) []byte {
+	if filterFunc == nil {
+		return t.FindTagsAppend(dst, address)
+	}
 
-	if root.TagCount > 0 {
-		ret = append(ret, t.tagsForNode(1)...)
+	t.VisitTags(address, func(tag byte) bool {
+		if filterFunc(tag) {
+			dst = append(dst, tag)
+		}
+		return true
+	})
+	return dst
+}
+
+// VisitTags calls visitFunc with each matching tag, in the same order as FindTags, without allocating
+// - visitFunc returns false to stop early
+func (t *TreeV4) VisitTags(address patricia.IPv4Address, visitFunc func(tag byte) bool) {
+	root := &t.nodes[1]
+	if !t.visitTagsForNode(1, visitFunc) {
+		return
 	}
 
 	if address.Length == 0 {
 		// caller just looking for root tags
-		return ret, nil
+		return
 	}
 
 	var nodeIndex uint
@@ -537,28 +626,26 @@ func (t *TreeV4) FindTags(address patricia.IPv4Address) ([]byte, error) {
 	}
 
 	// traverse the tree
-	count := 0
 	for {
-		count++
 		if nodeIndex == 0 {
-			return ret, nil
+			return
 		}
 		node := &t.nodes[nodeIndex]
 
-		matchCount = node.MatchCount(address)
+		matchCount := node.MatchCount(address)
 		if matchCount < node.prefixLength {
 			// didn't match the entire node - we're done
-			return ret, nil
+			return
 		}
 
-		// matched the full node - get its tags, then chop off the bits we've already matched and continue
-		if node.TagCount > 0 {
-			ret = append(ret, t.tagsForNode(nodeIndex)...)
+		// matched the full node - visit its tags, then chop off the bits we've already matched and continue
+		if !t.visitTagsForNode(nodeIndex, visitFunc) {
+			return
 		}
 
 		if matchCount == address.Length {
 			// exact match - we're done
-			return ret, nil
+			return
 		}
 
 		// there's still more address - keep traversing
@@ -629,6 +716,122 @@ func (t *TreeV4) FindDeepestTag(address patricia.IPv4Address) (bool, byte, error
 	}
 }
 
+// FindDeepestMatch finds the deepest tagged prefix in the tree that contains the input address, representing the closest match
+// - returns the full matched prefix, all of the tags at that prefix, and whether a match was found
+func (t *TreeV4) FindDeepestMatch(address patricia.IPv4Address) (patricia.IPv4Address, []byte, bool) {
+	root := &t.nodes[1]
+	var matchIndex uint
+	var matchAddress patricia.IPv4Address
+	var nodeAddress patricia.IPv4Address
+
+	if root.TagCount > 0 {
+		matchIndex = 1
+	}
+
+	var nodeIndex uint
+	if address.Length > 0 {
+		if !address.IsLeftBitSet() {
+			nodeIndex = root.Left
+		} else {
+			nodeIndex = root.Right
+		}
+	}
+
+	// traverse the tree
+	for nodeIndex != 0 {
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			break
+		}
+
+		// matched the full node - remember it if it has tags, then chop off the bits we've already matched and continue
+		nodeAddress = node.AppendPrefix(nodeAddress)
+		if node.TagCount > 0 {
+			matchIndex = nodeIndex
+			matchAddress = nodeAddress
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			break
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+
+	if matchIndex == 0 {
+		return matchAddress, nil, false
+	}
+	return matchAddress, t.tagsForNode(matchIndex), true
+}
+
+// GetExact returns the tags stored at exactly the input address, ignoring the tags of any prefixes that cover it
+// - returns false if the address itself has no tags
+func (t *TreeV4) GetExact(address patricia.IPv4Address) ([]byte, bool) {
+	nodeIndex := t.findExactNode(address)
+	if nodeIndex == 0 || t.nodes[nodeIndex].TagCount == 0 {
+		return nil, false
+	}
+	return t.tagsForNode(nodeIndex), true
+}
+
+// HasExact returns whether the input address itself has tags, ignoring the tags of any prefixes that cover it
+func (t *TreeV4) HasExact(address patricia.IPv4Address) bool {
+	nodeIndex := t.findExactNode(address)
+	return nodeIndex != 0 && t.nodes[nodeIndex].TagCount > 0
+}
+
+// find the node whose full prefix is exactly the input address, returning its index, or 0 if there isn't one
+func (t *TreeV4) findExactNode(address patricia.IPv4Address) uint {
+	root := &t.nodes[1]
+	if address.Length == 0 {
+		return 1
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return 0
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - there's no exact match
+			return 0
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return nodeIndex
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
 func (t *TreeV4) countNodes(nodeIndex uint) int {
 	nodeCount := 1
 
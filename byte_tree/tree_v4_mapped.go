@@ -0,0 +1,285 @@
+package byte_tree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/kentik/patricia"
+)
+
+// size of a node's record in a mapped tree: its binary encoding, followed by the offset of its first tag
+const _treeNodeV4MappedSize = _treeNodeV4BinarySize + 4
+
+// MappedTreeV4 is a read-only IPv4 tree, queried directly from the memory-mappable form written by WriteMappedTo
+// - nodes and tags are never copied onto the Go heap: the pages of a mapped file are shared between processes
+// - the garbage collector has nothing to scan
+type MappedTreeV4 struct {
+	mappedTree
+}
+
+// OpenMappedTreeV4 memory-maps the file at path, written by (*TreeV4).WriteMappedTo
+// - the tree must be closed once it's no longer needed
+func OpenMappedTreeV4(path string) (*MappedTreeV4, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := NewMappedTreeV4(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	ret.unmap = unmap
+	return ret, nil
+}
+
+// NewMappedTreeV4 returns a read-only tree backed by data, written by (*TreeV4).WriteMappedTo
+// - data isn't copied, must be 8-byte aligned, and must not be modified while the tree is in use
+// - the nodes are validated once, here, but payloads other than strings are read back as they were written: their
+// bytes are trusted, so data must only come from WriteMappedTo
+func NewMappedTreeV4(data []byte) (*MappedTreeV4, error) {
+	ret := &MappedTreeV4{}
+	if err := ret.init(data, ret.addressFamily(), _treeNodeV4MappedSize); err != nil {
+		return nil, err
+	}
+	if err := ret.validateNodes(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// WriteMappedTo writes the tree in the read-only, memory-mappable form queried by MappedTreeV4
+// - nodes are renumbered in depth-first order, so lookups touch as few pages as possible
+// - string payloads are deduplicated into a string table; other payload types can't contain pointers
+// - returns an error, having written nothing, if the string table would pass 4 GiB
+func (t *TreeV4) WriteMappedTo(w io.Writer) (int64, error) {
+	tags, err := newMappedTagWriter(len(t.tags.slots))
+	if err != nil {
+		return 0, err
+	}
+
+	order := t.nodeOrder()
+	newIndexes := make([]uint32, len(t.nodes)) // index 0 stays 0, for 'not set'
+	for i, nodeIndex := range order {
+		newIndexes[nodeIndex] = uint32(i + 1)
+	}
+
+	// node 0 is unused, and the root is at 1, just like TreeV4
+	nodes := make([]byte, _treeNodeV4MappedSize, (len(order)+1)*_treeNodeV4MappedSize)
+	for _, nodeIndex := range order {
+		node := t.nodes[nodeIndex]
+		node.Left = uint(newIndexes[node.Left])
+		node.Right = uint(newIndexes[node.Right])
+		nodes = node.EncodeBinary(nodes)
+		nodes = binary.LittleEndian.AppendUint32(nodes, tags.count)
+
+		for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+			if err := tags.add(t.tagStorage.load(stored)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return writeMapped(w, t.addressFamily(), uint32(len(order)+1), nodes, tags)
+}
+
+// node decodes the node at the input index, returning it and the offset of its first tag
+func (t *MappedTreeV4) node(nodeIndex uint) (treeNodeV4, uint32, error) {
+	var node treeNodeV4
+	record, err := t.nodeRecord(nodeIndex, _treeNodeV4MappedSize)
+	if err != nil {
+		return node, 0, err
+	}
+	if err := node.DecodeBinary(record); err != nil {
+		return node, 0, err
+	}
+	return node, binary.LittleEndian.Uint32(record[_treeNodeV4BinarySize:]), nil
+}
+
+// validateNodes checks that the nodes are laid out the way WriteMappedTo writes them, so lookups can't loop forever, or
+// read past the tags
+// - nodes are numbered in depth-first order, left first, from the root at 1, so each is reached exactly once
+// - nodes other than the root must have a prefix, and no node's full prefix can be longer than an address
+// - each node's tags must follow those of the node before it
+func (t *MappedTreeV4) validateNodes() error {
+	type stackEntry struct {
+		nodeIndex    uint
+		prefixLength uint
+	}
+	nextIndex := uint(1)
+	nextTag := uint64(0)
+	stack := make([]stackEntry, 1, 64)
+	stack[0] = stackEntry{nodeIndex: 1}
+	for len(stack) > 0 {
+		entry := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if entry.nodeIndex != nextIndex {
+			return fmt.Errorf("invalid mapped tree: found node %d where node %d was expected", entry.nodeIndex, nextIndex)
+		}
+		nextIndex++
+
+		node, tagOffset, err := t.node(entry.nodeIndex)
+		if err != nil {
+			return err
+		}
+		if (entry.nodeIndex == 1) != (node.prefixLength == 0) {
+			return fmt.Errorf("invalid mapped tree: node %d has a %d bit prefix", entry.nodeIndex, node.prefixLength)
+		}
+		prefixLength := entry.prefixLength + node.prefixLength
+		if prefixLength > _treeNodeV4MaxPrefixLength {
+			return fmt.Errorf("invalid mapped tree: node %d has a %d bit full prefix", entry.nodeIndex, prefixLength)
+		}
+		if uint64(tagOffset) != nextTag {
+			return fmt.Errorf("invalid mapped tree: node %d's tags start at %d, expected %d", entry.nodeIndex, tagOffset, nextTag)
+		}
+		nextTag += uint64(node.TagCount)
+
+		// push right first, so left is visited first
+		if node.Right != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Right, prefixLength: prefixLength})
+		}
+		if node.Left != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Left, prefixLength: prefixLength})
+		}
+	}
+
+	if nextIndex != uint(t.nodeCount) {
+		return fmt.Errorf("invalid mapped tree: %d of the %d nodes are reachable", nextIndex-1, t.nodeCount-1)
+	}
+	if nextTag != uint64(t.tagCount) {
+		return fmt.Errorf("invalid mapped tree: nodes have %d tags, expected %d", nextTag, t.tagCount)
+	}
+	return nil
+}
+
+// FindTags finds all matching tags, the same as (*TreeV4).FindTags
+// - returns an error if the mapped data is invalid
+func (t *MappedTreeV4) FindTags(address patricia.IPv4Address) ([]byte, error) {
+	ret := make([]byte, 0)
+	root, tagOffset, err := t.node(1)
+	if err != nil {
+		return ret, err
+	}
+	if ret, err = t.appendTags(ret, tagOffset, root.TagCount); err != nil {
+		return ret, err
+	}
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		return ret, nil
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree - each node matches at least one more bit, so there can't be more nodes than bits, even if
+	// the data has changed since it was validated
+	for depth := 1; ; depth++ {
+		if nodeIndex == 0 {
+			return ret, nil
+		}
+		if depth > _treeNodeV4MaxPrefixLength {
+			return ret, fmt.Errorf("invalid mapped tree: more than %d nodes deep", _treeNodeV4MaxPrefixLength)
+		}
+		node, tagOffset, err := t.node(nodeIndex)
+		if err != nil {
+			return ret, err
+		}
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			return ret, nil
+		}
+
+		// matched the full node - get its tags, then chop off the bits we've already matched and continue
+		if ret, err = t.appendTags(ret, tagOffset, node.TagCount); err != nil {
+			return ret, err
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return ret, nil
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindDeepestTag finds a tag at the deepest level in the tree, the same as (*TreeV4).FindDeepestTag
+// - returns an error if the mapped data is invalid
+func (t *MappedTreeV4) FindDeepestTag(address patricia.IPv4Address) (bool, byte, error) {
+	var ret byte
+	var found bool
+	var deepestOffset uint32
+
+	root, tagOffset, err := t.node(1)
+	if err != nil {
+		return false, ret, err
+	}
+	if root.TagCount > 0 {
+		deepestOffset = tagOffset
+		found = true
+	}
+
+	var nodeIndex uint
+	if address.Length > 0 {
+		if !address.IsLeftBitSet() {
+			nodeIndex = root.Left
+		} else {
+			nodeIndex = root.Right
+		}
+	}
+
+	// traverse the tree - bounded the same as FindTags
+	for depth := 1; nodeIndex != 0; depth++ {
+		if depth > _treeNodeV4MaxPrefixLength {
+			return false, ret, fmt.Errorf("invalid mapped tree: more than %d nodes deep", _treeNodeV4MaxPrefixLength)
+		}
+		node, tagOffset, err := t.node(nodeIndex)
+		if err != nil {
+			return false, ret, err
+		}
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			break
+		}
+
+		// matched the full node - remember its first tag, then chop off the bits we've already matched and continue
+		if node.TagCount > 0 {
+			deepestOffset = tagOffset
+			found = true
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			break
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+
+	if !found {
+		return false, ret, nil
+	}
+	ret, err = t.tag(deepestOffset)
+	return err == nil, ret, err
+}
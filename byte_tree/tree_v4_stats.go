@@ -0,0 +1,90 @@
+package byte_tree
+
+// Stats returns the size of the tree, for monitoring
+// - counts are kept up to date as the tree changes, so this doesn't depend on the size of the tree
+func (t *TreeV4) Stats() TreeStats {
+	ret := TreeStats{
+		Nodes:             t.nodeCount(),
+		Tags:              t.tagCount,
+		FreeNodes:         len(t.availableIndexes),
+		NodeArrayLength:   len(t.nodes),
+		NodeArrayCapacity: cap(t.nodes),
+		FreeTagSlots:      t.tags.freeSlots,
+		PrefixLengths:     make([]int, len(t.prefixLengths)),
+		Bytes:             t.allocatedBytes(),
+	}
+	for length, count := range t.prefixLengths {
+		ret.PrefixLengths[length] = count
+		ret.TaggedNodes += count
+	}
+	return ret
+}
+
+// DepthStats returns how deep the tree's tagged nodes are
+// - takes a walk of the nodes, without recursion, so is best kept out of frequent monitoring
+func (t *TreeV4) DepthStats() DepthStats {
+	var ret DepthStats
+	totalDepth := 0
+	taggedNodes := 0
+	t.walkDepths(func(node *treeNodeV4, depth int, prefixLength uint) {
+		if node.TagCount > 0 {
+			ret.MaxDepth = max(ret.MaxDepth, depth)
+			totalDepth += depth
+			taggedNodes++
+		}
+	})
+	if taggedNodes > 0 {
+		ret.AverageDepth = float64(totalDepth) / float64(taggedNodes)
+	}
+	return ret
+}
+
+// nodeCount returns the number of nodes in the tree, including the root
+func (t *TreeV4) nodeCount() int {
+	return len(t.nodes) - 1 - len(t.availableIndexes)
+}
+
+// countPrefix adds delta to the number of tagged nodes with the prefix length
+// - invalid lengths are counted as the longest, so adding and deleting them stays balanced
+func (t *TreeV4) countPrefix(prefixLength uint, delta int) {
+	t.prefixLengths[min(prefixLength, _treeNodeV4MaxPrefixLength)] += delta
+}
+
+// resetCounters recounts the tags and tagged prefix lengths kept for Stats, from the nodes
+func (t *TreeV4) resetCounters() {
+	t.tagCount = 0
+	t.prefixLengths = [_treeNodeV4MaxPrefixLength + 1]int{}
+	t.walkDepths(func(node *treeNodeV4, depth int, prefixLength uint) {
+		if node.TagCount > 0 {
+			t.tagCount += node.TagCount
+			t.countPrefix(prefixLength, 1)
+		}
+	})
+}
+
+// walkDepths calls visitFunc with every node reachable from the root, along with its depth below the root,
+// and the length of its full prefix
+// - uses its own stack, rather than recursion, so deep trees can't overflow the goroutine's
+func (t *TreeV4) walkDepths(visitFunc func(node *treeNodeV4, depth int, prefixLength uint)) {
+	type stackEntry struct {
+		nodeIndex    uint
+		depth        int
+		prefixLength uint
+	}
+	stack := make([]stackEntry, 1, 64)
+	stack[0] = stackEntry{nodeIndex: 1}
+	for len(stack) > 0 {
+		entry := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := &t.nodes[entry.nodeIndex]
+		prefixLength := entry.prefixLength + node.prefixLength
+		visitFunc(node, entry.depth, prefixLength)
+
+		if node.Right != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Right, depth: entry.depth + 1, prefixLength: prefixLength})
+		}
+		if node.Left != 0 {
+			stack = append(stack, stackEntry{nodeIndex: node.Left, depth: entry.depth + 1, prefixLength: prefixLength})
+		}
+	}
+}
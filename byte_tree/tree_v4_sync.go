@@ -0,0 +1,151 @@
+package byte_tree
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/kentik/patricia"
+)
+
+// SyncTreeV4 is an IPv4 tree that's safe for concurrent use
+// - readers query the currently published tree without locking
+// - writers apply their changes to a clone of the current tree, then publish it atomically
+// - readers never see a partially-applied change
+// - each write clones the whole tree, so batch changes with Update
+type SyncTreeV4 struct {
+	tree      atomic.Pointer[TreeV4]
+	writeLock sync.Mutex // serializes writers
+}
+
+// NewSyncTreeV4 returns a new, empty, concurrency-safe tree
+func NewSyncTreeV4() *SyncTreeV4 {
+	return NewSyncTreeV4From(NewTreeV4())
+}
+
+// NewSyncTreeV4From returns a concurrency-safe tree, publishing the input tree
+// - the input tree must not be modified afterwards
+func NewSyncTreeV4From(tree *TreeV4) *SyncTreeV4 {
+	ret := &SyncTreeV4{}
+	ret.tree.Store(tree)
+	return ret
+}
+
+// Load returns the currently published tree, for running several queries against the same version
+// - the returned tree must not be modified
+func (t *SyncTreeV4) Load() *TreeV4 {
+	return t.tree.Load()
+}
+
+// Update applies updateFunc to a clone of the current tree, then publishes the clone
+// - if updateFunc returns an error, nothing is published, and the error is returned
+// - writers are serialized with each other, but never block readers
+func (t *SyncTreeV4) Update(updateFunc func(tree *TreeV4) error) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+
+	clone := t.tree.Load().Clone()
+	if err := updateFunc(clone); err != nil {
+		return err
+	}
+	t.tree.Store(clone)
+	return nil
+}
+
+// Replace publishes the input tree in place of the current one
+// - the input tree must not be modified afterwards
+func (t *SyncTreeV4) Replace(tree *TreeV4) {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	t.tree.Store(tree)
+}
+
+// Set the single value for a node - overwrites what's there, the same as (*TreeV4).Set
+func (t *SyncTreeV4) Set(address patricia.IPv4Address, tag byte) (bool, int, error) {
+	var countIncreased bool
+	var count int
+	err := t.Update(func(tree *TreeV4) error {
+		var err error
+		countIncreased, count, err = tree.Set(address, tag)
+		return err
+	})
+	return countIncreased, count, err
+}
+
+// Add adds a tag to the tree, the same as (*TreeV4).Add
+func (t *SyncTreeV4) Add(address patricia.IPv4Address, tag byte, matchFunc MatchesFunc) (bool, int, error) {
+	var countIncreased bool
+	var count int
+	err := t.Update(func(tree *TreeV4) error {
+		var err error
+		countIncreased, count, err = tree.Add(address, tag, matchFunc)
+		return err
+	})
+	return countIncreased, count, err
+}
+
+// Delete a tag from the tree if it matches matchVal, the same as (*TreeV4).Delete
+func (t *SyncTreeV4) Delete(address patricia.IPv4Address, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	var deleteCount int
+	err := t.Update(func(tree *TreeV4) error {
+		var err error
+		deleteCount, err = tree.Delete(address, matchFunc, matchVal)
+		return err
+	})
+	return deleteCount, err
+}
+
+// Stats returns the size of the currently published tree, the same as (*TreeV4).Stats
+func (t *SyncTreeV4) Stats() TreeStats {
+	return t.tree.Load().Stats()
+}
+
+// DepthStats returns how deep the currently published tree's tagged nodes are, the same as (*TreeV4).DepthStats
+func (t *SyncTreeV4) DepthStats() DepthStats {
+	return t.tree.Load().DepthStats()
+}
+
+// FindTags finds all matching tags, the same as (*TreeV4).FindTags
+func (t *SyncTreeV4) FindTags(address patricia.IPv4Address) ([]byte, error) {
+	return t.tree.Load().FindTags(address)
+}
+
+// FindTagsWithFilter finds all matching tags that passes the filter function, the same as (*TreeV4).FindTagsWithFilter
+func (t *SyncTreeV4) FindTagsWithFilter(address patricia.IPv4Address, filterFunc FilterFunc) ([]byte, error) {
+	return t.tree.Load().FindTagsWithFilter(address, filterFunc)
+}
+
+// FindTagsAppend appends all matching tags to dst, the same as (*TreeV4).FindTagsAppend
+func (t *SyncTreeV4) FindTagsAppend(dst []byte, address patricia.IPv4Address) []byte {
+	return t.tree.Load().FindTagsAppend(dst, address)
+}
+
+// FindTagsWithFilterAppend appends all matching tags that pass the filter function to dst, the same as
+// (*TreeV4).FindTagsWithFilterAppend
+func (t *SyncTreeV4) FindTagsWithFilterAppend(dst []byte, address patricia.IPv4Address, filterFunc FilterFunc) []byte {
+	return t.tree.Load().FindTagsWithFilterAppend(dst, address, filterFunc)
+}
+
+// VisitTags calls visitFunc with each matching tag, the same as (*TreeV4).VisitTags
+func (t *SyncTreeV4) VisitTags(address patricia.IPv4Address, visitFunc func(tag byte) bool) {
+	t.tree.Load().VisitTags(address, visitFunc)
+}
+
+// FindDeepestTag finds a tag at the deepest level in the tree, the same as (*TreeV4).FindDeepestTag
+func (t *SyncTreeV4) FindDeepestTag(address patricia.IPv4Address) (bool, byte, error) {
+	return t.tree.Load().FindDeepestTag(address)
+}
+
+// FindDeepestMatch finds the deepest tagged prefix that contains the input address, the same as (*TreeV4).FindDeepestMatch
+func (t *SyncTreeV4) FindDeepestMatch(address patricia.IPv4Address) (patricia.IPv4Address, []byte, bool) {
+	return t.tree.Load().FindDeepestMatch(address)
+}
+
+// GetExact returns the tags stored at exactly the input address, the same as (*TreeV4).GetExact
+func (t *SyncTreeV4) GetExact(address patricia.IPv4Address) ([]byte, bool) {
+	return t.tree.Load().GetExact(address)
+}
+
+// HasExact returns whether the input address itself has tags, the same as (*TreeV4).HasExact
+func (t *SyncTreeV4) HasExact(address patricia.IPv4Address) bool {
+	return t.tree.Load().HasExact(address)
+}
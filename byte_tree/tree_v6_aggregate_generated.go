@@ -0,0 +1,97 @@
+package byte_tree
+
+import (
+	"github.com/kentik/patricia"
+)
+
+// aggregateTreeV6Entry is a tagged prefix being aggregated
+type aggregateTreeV6Entry struct {
+	address patricia.IPv6Address
+	tags    []byte
+}
+
+// Aggregate returns a new tree, with sibling and redundant prefixes merged, that gives every address the same effective
+// tags as this tree, where an address's effective tags are those of the longest prefix containing it, as returned by FindDeepestMatch
+// - the result usually has far fewer prefixes, but isn't guaranteed to have the fewest possible
+// - sibling prefixes with equal tags are collapsed into their parent
+// - prefixes with the same tags as their closest tagged ancestor are dropped
+// - equal compares two tags, and tag lists are equal if they have equal tags in the same order - if nil, tags are compared with ==,
+// or with reflect.DeepEqual in the generic package, for payload types that can't be compared with ==
+func (t *TreeV6) Aggregate(equal MatchesFunc) *TreeV6 {
+	if equal == nil {
+		equal = equalTagsFunc()
+	}
+	tagsEqual := func(a []byte, b []byte) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	entries := make([]aggregateTreeV6Entry, 0)
+	t.Walk(func(address patricia.IPv6Address, tags []byte) bool {
+		entries = append(entries, aggregateTreeV6Entry{address: address, tags: tags})
+		return true
+	})
+	entries = t.collapseSiblings(patricia.IPv6Address{}, entries, tagsEqual)
+
+	// drop the prefixes that don't change the tags inherited from their closest ancestor, walking in order
+	ret := NewTreeV6()
+	ancestors := make([]aggregateTreeV6Entry, 0, 32)
+	for _, entry := range entries {
+		for len(ancestors) > 0 {
+			ancestor := ancestors[len(ancestors)-1].address
+			if ancestor.CommonPrefixLength(entry.address) == ancestor.Length {
+				break
+			}
+			ancestors = ancestors[:len(ancestors)-1]
+		}
+		if len(ancestors) > 0 && tagsEqual(ancestors[len(ancestors)-1].tags, entry.tags) {
+			continue
+		}
+		ancestors = append(ancestors, entry)
+		for _, tag := range entry.tags {
+			ret.Add(entry.address, tag, nil)
+		}
+	}
+	return ret
+}
+
+// collapseSiblings returns the entries within prefix, in order, after replacing each pair of sibling prefixes with equal
+// tags by their parent, from the longest prefixes up
+// - the parent's own tags are replaced, since they no longer apply to any address
+func (t *TreeV6) collapseSiblings(prefix patricia.IPv6Address, entries []aggregateTreeV6Entry, tagsEqual func(a []byte, b []byte) bool) []aggregateTreeV6Entry {
+	var own *aggregateTreeV6Entry
+	if len(entries) > 0 && entries[0].address.Length == prefix.Length {
+		own = &entries[0]
+		entries = entries[1:]
+	}
+	if len(entries) == 0 {
+		if own == nil {
+			return entries
+		}
+		return []aggregateTreeV6Entry{*own}
+	}
+
+	split := 0
+	for split < len(entries) && !t.prefixBit(entries[split].address, prefix.Length) {
+		split++
+	}
+	left := t.collapseSiblings(t.childPrefix(prefix, false), entries[:split], tagsEqual)
+	right := t.collapseSiblings(t.childPrefix(prefix, true), entries[split:], tagsEqual)
+
+	ret := make([]aggregateTreeV6Entry, 0, len(left)+len(right)+1)
+	if len(left) > 0 && len(right) > 0 && left[0].address.Length == prefix.Length+1 && right[0].address.Length == prefix.Length+1 && tagsEqual(left[0].tags, right[0].tags) {
+		ret = append(ret, aggregateTreeV6Entry{address: prefix, tags: left[0].tags})
+		left, right = left[1:], right[1:]
+	} else if own != nil {
+		ret = append(ret, *own)
+	}
+	ret = append(ret, left...)
+	return append(ret, right...)
+}
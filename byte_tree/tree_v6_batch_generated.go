@@ -0,0 +1,97 @@
+package byte_tree
+
+import (
+	"github.com/kentik/patricia"
+)
+
+// FindTagsBatch finds the tags for each of the input addresses, calling resultFunc with the address' index and its tags,
+// with the same results as calling FindTags for each
+// - consecutive addresses that share a prefix pick up the traversal where they diverge
+// - sorted or clustered addresses are found faster
+// - the tags slice is reused between calls, and is only valid until resultFunc returns
+func (t *TreeV6) FindTagsBatch(addresses []patricia.IPv6Address, resultFunc func(i int, tags []byte)) {
+	t.findBatch(addresses, true, func(i int, tags []byte, deepestIndex uint) {
+		resultFunc(i, tags)
+	})
+}
+
+// FindDeepestTagBatch finds the deepest tag for each of the input addresses, calling resultFunc with the address' index,
+// whether a tag was found and the tag, with the same results as calling FindDeepestTag for each
+// - consecutive addresses that share a prefix pick up the traversal where they diverge
+// - sorted or clustered addresses are found faster
+func (t *TreeV6) FindDeepestTagBatch(addresses []patricia.IPv6Address, resultFunc func(i int, found bool, tag byte)) {
+	var empty byte
+	t.findBatch(addresses, false, func(i int, tags []byte, deepestIndex uint) {
+		if deepestIndex == 0 {
+			resultFunc(i, false, empty)
+		} else {
+			resultFunc(i, true, t.firstTagForNode(deepestIndex))
+		}
+	})
+}
+
+// findBatch traverses the tree for each address, keeping the path of the previous address, and backtracking only as
+// far as the current address diverges from it
+// - if collectTags is true, resultFunc gets all matching tags; otherwise just the index of the deepest node with tags
+func (t *TreeV6) findBatch(addresses []patricia.IPv6Address, collectTags bool, resultFunc func(i int, tags []byte, deepestIndex uint)) {
+	var tags []byte
+	root := batchPathEntry{nodeIndex: 1}
+	if t.nodes[1].TagCount > 0 {
+		root.deepestIndex = 1
+		if collectTags {
+			tags = t.appendTagsForNode(tags, 1)
+			root.tagCount = len(tags)
+		}
+	}
+	path := make([]batchPathEntry, 1, 64)
+	path[0] = root
+
+	var previous patricia.IPv6Address
+	for i, address := range addresses {
+		// the nodes on the previous path no deeper than the bits both addresses share are matched by this one too
+		common := address.CommonPrefixLength(previous)
+		for path[len(path)-1].depth > common {
+			path = path[:len(path)-1]
+		}
+		entry := path[len(path)-1]
+		tags = tags[:entry.tagCount]
+
+		// carry on from there
+		remaining := address
+		remaining.ShiftLeft(entry.depth)
+		for remaining.Length > 0 {
+			node := &t.nodes[entry.nodeIndex]
+			var nodeIndex uint
+			if !remaining.IsLeftBitSet() {
+				nodeIndex = node.Left
+			} else {
+				nodeIndex = node.Right
+			}
+			if nodeIndex == 0 {
+				break
+			}
+
+			node = &t.nodes[nodeIndex]
+			matchCount := node.MatchCount(remaining)
+			if matchCount < node.prefixLength {
+				// didn't match the entire node - we're done
+				break
+			}
+
+			entry.nodeIndex = nodeIndex
+			entry.depth += matchCount
+			if node.TagCount > 0 {
+				entry.deepestIndex = nodeIndex
+				if collectTags {
+					tags = t.appendTagsForNode(tags, nodeIndex)
+					entry.tagCount = len(tags)
+				}
+			}
+			path = append(path, entry)
+			remaining.ShiftLeft(matchCount)
+		}
+
+		resultFunc(i, tags, entry.deepestIndex)
+		previous = address
+	}
+}
@@ -0,0 +1,115 @@
+package byte_tree
+
+import (
+	"github.com/kentik/patricia"
+)
+
+// Set operations treat each tree as the set of addresses covered by its tagged prefixes, whatever the tags are.
+// They work structurally on the prefixes, rather than the addresses, and return a new tree holding the fewest
+// prefixes that cover the result, each tagged with the input tag.
+
+// Union returns a tree covering the addresses covered by either tree
+func (t *TreeV6) Union(other *TreeV6, tag byte) *TreeV6 {
+	return t.setOperation(other, tag, func(inThis bool, inOther bool) bool {
+		return inThis || inOther
+	})
+}
+
+// Intersect returns a tree covering the addresses covered by both trees
+func (t *TreeV6) Intersect(other *TreeV6, tag byte) *TreeV6 {
+	return t.setOperation(other, tag, func(inThis bool, inOther bool) bool {
+		return inThis && inOther
+	})
+}
+
+// Difference returns a tree covering the addresses covered by this tree, but not the other
+func (t *TreeV6) Difference(other *TreeV6, tag byte) *TreeV6 {
+	return t.setOperation(other, tag, func(inThis bool, inOther bool) bool {
+		return inThis && !inOther
+	})
+}
+
+// Complement returns a tree covering the addresses not covered by this tree
+func (t *TreeV6) Complement(tag byte) *TreeV6 {
+	return t.setOperation(NewTreeV6(), tag, func(inThis bool, inOther bool) bool {
+		return !inThis
+	})
+}
+
+// setOperation builds the tree covering the addresses for which op returns true
+func (t *TreeV6) setOperation(other *TreeV6, tag byte, op func(inThis bool, inOther bool) bool) *TreeV6 {
+	ret := NewTreeV6()
+	root := patricia.IPv6Address{}
+	if ret.addSetOperation(root, t.coveringPrefixes(), other.coveringPrefixes(), tag, op) {
+		ret.Add(root, tag, nil)
+	}
+	return ret
+}
+
+// coveringPrefixes returns the tagged prefixes that aren't within another tagged prefix, in order
+func (t *TreeV6) coveringPrefixes() []patricia.IPv6Address {
+	ret := make([]patricia.IPv6Address, 0)
+	t.walk(1, patricia.IPv6Address{}, func(nodeIndex uint, address patricia.IPv6Address) bool {
+		if len(ret) > 0 {
+			last := ret[len(ret)-1]
+			if last.CommonPrefixLength(address) == last.Length {
+				// within the last covering prefix
+				return true
+			}
+		}
+		ret = append(ret, address)
+		return true
+	})
+	return ret
+}
+
+// addSetOperation adds the prefixes within prefix for which op returns true, given the ordered, disjoint prefixes of
+// each set within it
+// - returns true, without adding anything, if op is true for the whole prefix, so the caller can add a shorter one
+func (t *TreeV6) addSetOperation(prefix patricia.IPv6Address, this []patricia.IPv6Address, other []patricia.IPv6Address, tag byte, op func(inThis bool, inOther bool) bool) bool {
+	thisFull := len(this) == 1 && this[0].Length == prefix.Length
+	otherFull := len(other) == 1 && other[0].Length == prefix.Length
+	thisPartial := len(this) > 0 && !thisFull
+	otherPartial := len(other) > 0 && !otherFull
+
+	// done if neither set is split within the prefix, or the result doesn't depend on the split one
+	if !thisPartial && !otherPartial {
+		return op(thisFull, otherFull)
+	}
+	if !thisPartial && op(thisFull, false) == op(thisFull, true) {
+		return op(thisFull, false)
+	}
+	if !otherPartial && op(false, otherFull) == op(true, otherFull) {
+		return op(false, otherFull)
+	}
+
+	// split both sets between the two halves of the prefix - a set covering the whole prefix covers both halves
+	left := t.childPrefix(prefix, false)
+	right := t.childPrefix(prefix, true)
+	thisLeft, thisRight := t.splitPrefixes(this, thisFull, left, right)
+	otherLeft, otherRight := t.splitPrefixes(other, otherFull, left, right)
+	leftFull := t.addSetOperation(left, thisLeft, otherLeft, tag, op)
+	rightFull := t.addSetOperation(right, thisRight, otherRight, tag, op)
+	if leftFull && rightFull {
+		return true
+	}
+	if leftFull {
+		t.Add(left, tag, nil)
+	}
+	if rightFull {
+		t.Add(right, tag, nil)
+	}
+	return false
+}
+
+// splitPrefixes splits the ordered prefixes within a prefix between its left and right halves
+func (t *TreeV6) splitPrefixes(prefixes []patricia.IPv6Address, full bool, left patricia.IPv6Address, right patricia.IPv6Address) ([]patricia.IPv6Address, []patricia.IPv6Address) {
+	if full {
+		return []patricia.IPv6Address{left}, []patricia.IPv6Address{right}
+	}
+	split := 0
+	for split < len(prefixes) && !t.prefixBit(prefixes[split], left.Length-1) {
+		split++
+	}
+	return prefixes[:split], prefixes[split:]
+}
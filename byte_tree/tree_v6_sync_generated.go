@@ -0,0 +1,151 @@
+package byte_tree
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/kentik/patricia"
+)
+
+// SyncTreeV6 is an IPv4 tree that's safe for concurrent use
+// - readers query the currently published tree without locking
+// - writers apply their changes to a clone of the current tree, then publish it atomically
+// - readers never see a partially-applied change
+// - each write clones the whole tree, so batch changes with Update
+type SyncTreeV6 struct {
+	tree      atomic.Pointer[TreeV6]
+	writeLock sync.Mutex // serializes writers
+}
+
+// NewSyncTreeV6 returns a new, empty, concurrency-safe tree
+func NewSyncTreeV6() *SyncTreeV6 {
+	return NewSyncTreeV6From(NewTreeV6())
+}
+
+// NewSyncTreeV6From returns a concurrency-safe tree, publishing the input tree
+// - the input tree must not be modified afterwards
+func NewSyncTreeV6From(tree *TreeV6) *SyncTreeV6 {
+	ret := &SyncTreeV6{}
+	ret.tree.Store(tree)
+	return ret
+}
+
+// Load returns the currently published tree, for running several queries against the same version
+// - the returned tree must not be modified
+func (t *SyncTreeV6) Load() *TreeV6 {
+	return t.tree.Load()
+}
+
+// Update applies updateFunc to a clone of the current tree, then publishes the clone
+// - if updateFunc returns an error, nothing is published, and the error is returned
+// - writers are serialized with each other, but never block readers
+func (t *SyncTreeV6) Update(updateFunc func(tree *TreeV6) error) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+
+	clone := t.tree.Load().Clone()
+	if err := updateFunc(clone); err != nil {
+		return err
+	}
+	t.tree.Store(clone)
+	return nil
+}
+
+// Replace publishes the input tree in place of the current one
+// - the input tree must not be modified afterwards
+func (t *SyncTreeV6) Replace(tree *TreeV6) {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	t.tree.Store(tree)
+}
+
+// Set the single value for a node - overwrites what's there, the same as (*TreeV6).Set
+func (t *SyncTreeV6) Set(address patricia.IPv6Address, tag byte) (bool, int, error) {
+	var countIncreased bool
+	var count int
+	err := t.Update(func(tree *TreeV6) error {
+		var err error
+		countIncreased, count, err = tree.Set(address, tag)
+		return err
+	})
+	return countIncreased, count, err
+}
+
+// Add adds a tag to the tree, the same as (*TreeV6).Add
+func (t *SyncTreeV6) Add(address patricia.IPv6Address, tag byte, matchFunc MatchesFunc) (bool, int, error) {
+	var countIncreased bool
+	var count int
+	err := t.Update(func(tree *TreeV6) error {
+		var err error
+		countIncreased, count, err = tree.Add(address, tag, matchFunc)
+		return err
+	})
+	return countIncreased, count, err
+}
+
+// Delete a tag from the tree if it matches matchVal, the same as (*TreeV6).Delete
+func (t *SyncTreeV6) Delete(address patricia.IPv6Address, matchFunc MatchesFunc, matchVal byte) (int, error) {
+	var deleteCount int
+	err := t.Update(func(tree *TreeV6) error {
+		var err error
+		deleteCount, err = tree.Delete(address, matchFunc, matchVal)
+		return err
+	})
+	return deleteCount, err
+}
+
+// Stats returns the size of the currently published tree, the same as (*TreeV6).Stats
+func (t *SyncTreeV6) Stats() TreeStats {
+	return t.tree.Load().Stats()
+}
+
+// DepthStats returns how deep the currently published tree's tagged nodes are, the same as (*TreeV6).DepthStats
+func (t *SyncTreeV6) DepthStats() DepthStats {
+	return t.tree.Load().DepthStats()
+}
+
+// FindTags finds all matching tags, the same as (*TreeV6).FindTags
+func (t *SyncTreeV6) FindTags(address patricia.IPv6Address) ([]byte, error) {
+	return t.tree.Load().FindTags(address)
+}
+
+// FindTagsWithFilter finds all matching tags that passes the filter function, the same as (*TreeV6).FindTagsWithFilter
+func (t *SyncTreeV6) FindTagsWithFilter(address patricia.IPv6Address, filterFunc FilterFunc) ([]byte, error) {
+	return t.tree.Load().FindTagsWithFilter(address, filterFunc)
+}
+
+// FindTagsAppend appends all matching tags to dst, the same as (*TreeV6).FindTagsAppend
+func (t *SyncTreeV6) FindTagsAppend(dst []byte, address patricia.IPv6Address) []byte {
+	return t.tree.Load().FindTagsAppend(dst, address)
+}
+
+// FindTagsWithFilterAppend appends all matching tags that pass the filter function to dst, the same as
+// (*TreeV6).FindTagsWithFilterAppend
+func (t *SyncTreeV6) FindTagsWithFilterAppend(dst []byte, address patricia.IPv6Address, filterFunc FilterFunc) []byte {
+	return t.tree.Load().FindTagsWithFilterAppend(dst, address, filterFunc)
+}
+
+// VisitTags calls visitFunc with each matching tag, the same as (*TreeV6).VisitTags
+func (t *SyncTreeV6) VisitTags(address patricia.IPv6Address, visitFunc func(tag byte) bool) {
+	t.tree.Load().VisitTags(address, visitFunc)
+}
+
+// FindDeepestTag finds a tag at the deepest level in the tree, the same as (*TreeV6).FindDeepestTag
+func (t *SyncTreeV6) FindDeepestTag(address patricia.IPv6Address) (bool, byte, error) {
+	return t.tree.Load().FindDeepestTag(address)
+}
+
+// FindDeepestMatch finds the deepest tagged prefix that contains the input address, the same as (*TreeV6).FindDeepestMatch
+func (t *SyncTreeV6) FindDeepestMatch(address patricia.IPv6Address) (patricia.IPv6Address, []byte, bool) {
+	return t.tree.Load().FindDeepestMatch(address)
+}
+
+// GetExact returns the tags stored at exactly the input address, the same as (*TreeV6).GetExact
+func (t *SyncTreeV6) GetExact(address patricia.IPv6Address) ([]byte, bool) {
+	return t.tree.Load().GetExact(address)
+}
+
+// HasExact returns whether the input address itself has tags, the same as (*TreeV6).HasExact
+func (t *SyncTreeV6) HasExact(address patricia.IPv6Address) bool {
+	return t.tree.Load().HasExact(address)
+}
@@ -0,0 +1,318 @@
+// Command patricia-gen generates a tree package for a payload type of your own, for use with go:generate, such as:
+//
+//	//go:generate patricia-gen -type FlowClass -package flowtree -import example.com/flows -output ../flowtree/tree.go
+//
+// The generated package has the same API as the generated trees, such as uint16_tree, built on the generic package.
+// The payload type must be pointer-free - a builtin type, or an array or struct of them - or the garbage collector would
+// have to scan the tree's tags, which is what the trees are designed to avoid. Types with pointers, including strings,
+// are rejected.
+//
+// For comparable payload types, MatchesEqual is generated too, as the MatchesFunc for equal tags.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// config is what to generate
+type config struct {
+	typeName    string // payload type name
+	importPath  string // import path of the package declaring the type - empty for a builtin type, or one in dir's package
+	packageName string // output package name
+	dir         string // directory of the package running go:generate
+	output      string // output file name, which is skipped when reading the package in dir
+}
+
+func main() {
+	cfg := config{dir: "."}
+	flag.StringVar(&cfg.typeName, "type", "", "payload type name (required)")
+	flag.StringVar(&cfg.importPath, "import", "", "import path of the package declaring the type - omit for a builtin type, or one declared in the current directory's package")
+	flag.StringVar(&cfg.packageName, "package", os.Getenv("GOPACKAGE"), "output package name - defaults to the current directory's package")
+	flag.StringVar(&cfg.output, "output", "", "output file - defaults to <type>_patricia.go")
+	flag.Parse()
+
+	if cfg.typeName == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cfg.output == "" {
+		cfg.output = strings.ToLower(cfg.typeName) + "_patricia.go"
+	}
+
+	source, err := generate(cfg, strings.Join(os.Args[1:], " "))
+	if err == nil {
+		err = os.WriteFile(cfg.output, source, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patricia-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// generate returns the formatted source of the tree package
+// - args are recorded in the generated file's header
+func generate(cfg config, args string) ([]byte, error) {
+	typeName, pkg, err := lookupType(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if reason, ok := hasPointers(typeName.Type(), cfg.typeName); ok {
+		return nil, fmt.Errorf("type %s can't be a payload type, as it has pointers: %s", cfg.typeName, reason)
+	}
+
+	data := templateData{
+		Args:        args,
+		PackageName: cfg.packageName,
+		Type:        cfg.typeName,
+		Comparable:  types.Comparable(typeName.Type()),
+	}
+	if data.PackageName == "" {
+		if pkg == nil {
+			return nil, fmt.Errorf("no package to generate: there's no -package, or Go package in %s", cfg.dir)
+		}
+		data.PackageName = pkg.Name()
+	}
+	if cfg.importPath != "" {
+		data.Import = cfg.importPath
+		data.Type = typeName.Pkg().Name() + "." + cfg.typeName
+	} else if typeName.Pkg() != nil && data.PackageName != typeName.Pkg().Name() {
+		return nil, fmt.Errorf("type %s is declared in package %s, so generating package %s needs its -import path", cfg.typeName, typeName.Pkg().Name(), data.PackageName)
+	}
+
+	var buf bytes.Buffer
+	if err := _template.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// lookupType finds the payload type, type-checking the package it's declared in from source
+// - also returns the package in cfg.dir, if there is one, when the type isn't imported
+func lookupType(cfg config) (*types.TypeName, *types.Package, error) {
+	fset := token.NewFileSet()
+	imports := importer.ForCompiler(fset, "source", nil)
+
+	var pkg *types.Package
+	if cfg.importPath != "" {
+		imported, err := imports.Import(cfg.importPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't load package %s: %s", cfg.importPath, err)
+		}
+		pkg = imported
+	} else {
+		pkg = checkDir(fset, imports, cfg.dir, cfg.output)
+	}
+
+	// the package's own types shadow the builtin ones
+	var object types.Object
+	if pkg != nil {
+		object = pkg.Scope().Lookup(cfg.typeName)
+	}
+	if object == nil && cfg.importPath == "" {
+		object = types.Universe.Lookup(cfg.typeName)
+	}
+	typeName, ok := object.(*types.TypeName)
+	if !ok {
+		where := "the builtin types"
+		if pkg != nil {
+			where = "package " + pkg.Path() + " or " + where
+		}
+		return nil, nil, fmt.Errorf("type %s not found in %s", cfg.typeName, where)
+	}
+	if cfg.importPath != "" && !typeName.Exported() {
+		return nil, nil, fmt.Errorf("type %s isn't exported from package %s", cfg.typeName, cfg.importPath)
+	}
+	return typeName, pkg, nil
+}
+
+// checkDir type-checks the package in dir, skipping the output file, which may be stale
+// - returns nil if there isn't a package in dir - errors in the package are ignored, as long as the type can be found
+func checkDir(fset *token.FileSet, imports types.Importer, dir string, output string) *types.Package {
+	buildPkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil
+	}
+
+	files := make([]*ast.File, 0, len(buildPkg.GoFiles))
+	for _, name := range buildPkg.GoFiles {
+		if output != "" && filepath.Base(output) == name && filepath.Clean(filepath.Dir(output)) == filepath.Clean(dir) {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	typesConfig := types.Config{Importer: imports, Error: func(error) {}}
+	pkg, _ := typesConfig.Check(buildPkg.ImportPath, fset, files, nil)
+	return pkg
+}
+
+// hasPointers returns whether values of the type hold any pointers, and where the first one is
+func hasPointers(t types.Type, path string) (string, bool) {
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		switch underlying.Kind() {
+		case types.String, types.UnsafePointer:
+			return fmt.Sprintf("%s has type %s", path, underlying), true
+		}
+		return "", false
+	case *types.Array:
+		if underlying.Len() == 0 {
+			return "", false
+		}
+		return hasPointers(underlying.Elem(), path+"[]")
+	case *types.Struct:
+		for i := 0; i < underlying.NumFields(); i++ {
+			field := underlying.Field(i)
+			if reason, ok := hasPointers(field.Type(), path+"."+field.Name()); ok {
+				return reason, true
+			}
+		}
+		return "", false
+	default:
+		// pointers, slices, maps, channels, functions and interfaces
+		return fmt.Sprintf("%s has type %s", path, types.TypeString(underlying, packageName)), true
+	}
+}
+
+// packageName qualifies types with their package's name, as they're written in code
+func packageName(pkg *types.Package) string {
+	return pkg.Name()
+}
+
+type templateData struct {
+	Args        string
+	PackageName string
+	Import      string // import path of the payload type's package, if it needs importing
+	Type        string // payload type, qualified with its package name if it's imported
+	Comparable  bool
+}
+
+var _template = template.Must(template.New("tree").Parse(`// Code generated by patricia-gen {{.Args}}; DO NOT EDIT.
+
+package {{.PackageName}}
+
+import (
+	"github.com/kentik/patricia/generic"
+{{- if .Import}}
+	"{{.Import}}"
+{{- end}}
+)
+
+// Tree is a dual-stack tree, tagged with {{.Type}}
+type Tree = generic.Tree[{{.Type}}]
+
+// TreeV4 is an IPv4 patricia tree, tagged with {{.Type}}
+type TreeV4 = generic.TreeV4[{{.Type}}]
+
+// TreeV6 is an IPv6 patricia tree, tagged with {{.Type}}
+type TreeV6 = generic.TreeV6[{{.Type}}]
+
+// FrozenTreeV4 is an immutable IPv4 tree, from TreeV4.Freeze
+type FrozenTreeV4 = generic.FrozenTreeV4[{{.Type}}]
+
+// FrozenTreeV6 is an immutable IPv6 tree, from TreeV6.Freeze
+type FrozenTreeV6 = generic.FrozenTreeV6[{{.Type}}]
+
+// MappedTreeV4 is a memory-mapped, read-only IPv4 tree, from TreeV4.WriteMappedTo
+type MappedTreeV4 = generic.MappedTreeV4[{{.Type}}]
+
+// MappedTreeV6 is a memory-mapped, read-only IPv6 tree, from TreeV6.WriteMappedTo
+type MappedTreeV6 = generic.MappedTreeV6[{{.Type}}]
+
+// SyncTreeV4 is a concurrency-safe IPv4 tree
+type SyncTreeV4 = generic.SyncTreeV4[{{.Type}}]
+
+// SyncTreeV6 is a concurrency-safe IPv6 tree
+type SyncTreeV6 = generic.SyncTreeV6[{{.Type}}]
+
+// MatchesFunc is called to check if tag data matches the input value
+type MatchesFunc = generic.MatchesFunc[{{.Type}}]
+
+// FilterFunc is called on each result to see if it belongs in the resulting set
+type FilterFunc = generic.FilterFunc[{{.Type}}]
+
+// NewTree returns a new, empty dual-stack tree
+func NewTree() *Tree {
+	return generic.NewTree[{{.Type}}]()
+}
+
+// NewTreeV4 returns a new, empty IPv4 tree
+func NewTreeV4() *TreeV4 {
+	return generic.NewTreeV4[{{.Type}}]()
+}
+
+// NewTreeV6 returns a new, empty IPv6 tree
+func NewTreeV6() *TreeV6 {
+	return generic.NewTreeV6[{{.Type}}]()
+}
+
+// NewSyncTreeV4 returns a new, empty, concurrency-safe IPv4 tree
+func NewSyncTreeV4() *SyncTreeV4 {
+	return generic.NewSyncTreeV4[{{.Type}}]()
+}
+
+// NewSyncTreeV6 returns a new, empty, concurrency-safe IPv6 tree
+func NewSyncTreeV6() *SyncTreeV6 {
+	return generic.NewSyncTreeV6[{{.Type}}]()
+}
+
+// NewSyncTreeV4From returns a concurrency-safe tree, publishing the input tree
+// - the input tree must not be modified afterwards
+func NewSyncTreeV4From(tree *TreeV4) *SyncTreeV4 {
+	return generic.NewSyncTreeV4From(tree)
+}
+
+// NewSyncTreeV6From returns a concurrency-safe tree, publishing the input tree
+// - the input tree must not be modified afterwards
+func NewSyncTreeV6From(tree *TreeV6) *SyncTreeV6 {
+	return generic.NewSyncTreeV6From(tree)
+}
+
+// OpenMappedTreeV4 memory-maps the file at path, written by (*TreeV4).WriteMappedTo
+// - the tree must be closed once it's no longer needed
+func OpenMappedTreeV4(path string) (*MappedTreeV4, error) {
+	return generic.OpenMappedTreeV4[{{.Type}}](path)
+}
+
+// OpenMappedTreeV6 memory-maps the file at path, written by (*TreeV6).WriteMappedTo
+// - the tree must be closed once it's no longer needed
+func OpenMappedTreeV6(path string) (*MappedTreeV6, error) {
+	return generic.OpenMappedTreeV6[{{.Type}}](path)
+}
+
+// NewMappedTreeV4 returns a read-only tree backed by data, written by (*TreeV4).WriteMappedTo
+// - data isn't copied, must be 8-byte aligned, and must not be modified while the tree is in use
+func NewMappedTreeV4(data []byte) (*MappedTreeV4, error) {
+	return generic.NewMappedTreeV4[{{.Type}}](data)
+}
+
+// NewMappedTreeV6 returns a read-only tree backed by data, written by (*TreeV6).WriteMappedTo
+// - data isn't copied, must be 8-byte aligned, and must not be modified while the tree is in use
+func NewMappedTreeV6(data []byte) (*MappedTreeV6, error) {
+	return generic.NewMappedTreeV6[{{.Type}}](data)
+}
+{{- if .Comparable}}
+
+// MatchesEqual is the MatchesFunc for equal tags
+func MatchesEqual(payload {{.Type}}, val {{.Type}}) bool {
+	return payload == val
+}
+{{- end}}
+`))
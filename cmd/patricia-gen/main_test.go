@@ -0,0 +1,143 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const _testPackage = `package flows
+
+import "unsafe"
+
+type FlowClass struct {
+	ASN     uint32
+	Country [2]byte
+	_       [0]*int
+}
+
+type FlowClasses [4]FlowClass
+type Port uint16
+type Name string
+type Named struct {
+	ASN  uint32
+	Tags []Port
+}
+type Nested struct {
+	Inner [2]struct{ Next *Nested }
+}
+type Raw unsafe.Pointer
+type Matcher func(Port) bool
+type Any interface{}
+type uint8 struct{ Value [1]bool }
+`
+
+func writeTestPackage(t *testing.T) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "flows.go"), []byte(_testPackage), 0644))
+	return dir
+}
+
+func TestHasPointers(t *testing.T) {
+	dir := writeTestPackage(t)
+	tests := []struct {
+		typeName string
+		reason   string // empty for pointer-free
+	}{
+		{"FlowClass", ""},
+		{"FlowClasses", ""},
+		{"Port", ""},
+		{"uint8", ""},
+		{"Name", "Name has type string"},
+		{"Named", "Named.Tags has type []flows.Port"},
+		{"Nested", "Nested.Inner[].Next has type *flows.Nested"},
+		{"Raw", "Raw has type unsafe.Pointer"},
+		{"Matcher", "Matcher has type func(flows.Port) bool"},
+		{"Any", "Any has type interface{}"},
+	}
+	for _, test := range tests {
+		typeName, _, err := lookupType(config{typeName: test.typeName, dir: dir})
+		if !assert.NoError(t, err, test.typeName) {
+			continue
+		}
+		reason, ok := hasPointers(typeName.Type(), test.typeName)
+		assert.Equal(t, test.reason != "", ok, test.typeName)
+		assert.Equal(t, test.reason, reason, test.typeName)
+	}
+}
+
+// typeCheck type-checks generated source, along with the .go files in dir if it's in their package
+func typeCheck(t *testing.T, imports types.Importer, fset *token.FileSet, dir string, source []byte) {
+	t.Helper()
+	file, err := parser.ParseFile(fset, "generated.go", source, parser.ParseComments)
+	if !assert.NoError(t, err) {
+		return
+	}
+	files := []*ast.File{file}
+	if dir != "" {
+		packages, err := parser.ParseDir(fset, dir, nil, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, pkgFile := range packages[file.Name.Name].Files {
+			files = append(files, pkgFile)
+		}
+	}
+	_, err = (&types.Config{Importer: imports}).Check(file.Name.Name, fset, files, nil)
+	assert.NoError(t, err)
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeTestPackage(t)
+	fset := token.NewFileSet()
+	imports := importer.ForCompiler(fset, "source", nil)
+
+	source, err := generate(config{typeName: "FlowClass", dir: dir}, "-type FlowClass")
+	assert.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, parser.ParseComments)
+	assert.NoError(t, err)
+	assert.Equal(t, "flows", file.Name.Name)
+	typeCheck(t, imports, fset, dir, source)
+	assert.True(t, strings.HasPrefix(string(source), "// Code generated by patricia-gen -type FlowClass; DO NOT EDIT.\n"))
+	assert.Contains(t, string(source), "type TreeV4 = generic.TreeV4[FlowClass]\n")
+	assert.Contains(t, string(source), "func MatchesEqual(payload FlowClass, val FlowClass) bool {")
+
+	// builtin types, in a package of their own
+	source, err = generate(config{typeName: "float32", packageName: "float32tree", dir: t.TempDir()}, "")
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), "package float32tree\n")
+	assert.Contains(t, string(source), "return generic.NewTreeV6[float32]()")
+	typeCheck(t, imports, fset, "", source)
+
+	// the package's own types shadow the builtin ones
+	source, err = generate(config{typeName: "uint8", dir: dir}, "")
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), "type TreeV4 = generic.TreeV4[uint8]")
+	typeCheck(t, imports, fset, dir, source)
+
+	// types declared elsewhere need importing
+	source, err = generate(config{typeName: "IPv4Address", importPath: "github.com/kentik/patricia", packageName: "addresstree", dir: dir}, "")
+	assert.NoError(t, err)
+	assert.Contains(t, string(source), "\t\"github.com/kentik/patricia\"\n")
+	assert.Contains(t, string(source), "type TreeV4 = generic.TreeV4[patricia.IPv4Address]")
+	typeCheck(t, imports, fset, "", source)
+
+	_, err = generate(config{typeName: "Name", dir: dir}, "")
+	assert.EqualError(t, err, "type Name can't be a payload type, as it has pointers: Name has type string")
+	_, err = generate(config{typeName: "Missing", dir: dir}, "")
+	assert.Error(t, err)
+	_, err = generate(config{typeName: "Port", packageName: "porttree", dir: dir}, "")
+	assert.Error(t, err)
+	_, err = generate(config{typeName: "string", packageName: "stringtree", dir: dir}, "")
+	assert.Error(t, err)
+	_, err = generate(config{typeName: "masked", importPath: "github.com/kentik/patricia", packageName: "addresstree", dir: dir}, "")
+	assert.Error(t, err)
+}
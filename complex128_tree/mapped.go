@@ -0,0 +1,268 @@
+package complex128_tree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"unsafe"
+)
+
+// memory-mappable trees are laid out as:
+// - header: magic, format version, address family, payload type name
+// - tag layout, byte order, tag size, node count, tag count, string table length
+// - padding to an 8-byte boundary
+// - fixed-width tags: either their in-memory representation, or an offset & length into the string table
+// - string table
+// - fixed-width node records, renumbered in depth-first order, each holding the offset of its first tag
+const (
+	_mappedMagic   = "PATM"
+	_mappedVersion = uint16(1)
+
+	_tagLayoutRaw    = uint8(1) // tags are stored as their in-memory representation
+	_tagLayoutString = uint8(2) // tags are stored as a uint32 offset and uint32 length into the string table
+
+	_byteOrderLittle = uint8(1)
+	_byteOrderBig    = uint8(2)
+)
+
+var _nativeByteOrder = nativeByteOrder()
+
+func nativeByteOrder() uint8 {
+	value := uint16(1)
+	if *(*byte)(unsafe.Pointer(&value)) == 1 {
+		return _byteOrderLittle
+	}
+	return _byteOrderBig
+}
+
+// mappedTagLayout returns how tags are laid out in a mapped tree, and the size of each
+// - returns an error if the payload type has pointers (other than being a string), which can't be mapped
+func mappedTagLayout() (uint8, uintptr, error) {
+	var tag complex128
+	if _, ok := any(&tag).(*string); ok {
+		return _tagLayoutString, 8, nil
+	}
+
+	tagType := reflect.TypeOf(&tag).Elem()
+	if typeHasPointers(tagType) {
+		return 0, 0, fmt.Errorf("payload type %s can't be memory-mapped: it contains pointers", tagType)
+	}
+	return _tagLayoutRaw, tagType.Size(), nil
+}
+
+// typeHasPointers returns whether values of the input type hold any pointers
+func typeHasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return t.Len() > 0 && typeHasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if typeHasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// maxMappedStringBytes is how long a mapped tree's string table can grow, as strings are addressed by 32-bit offsets
+// - a variable, so tests can fill a string table without allocating one this big
+var maxMappedStringBytes = uint64(^uint32(0))
+
+// mappedTagWriter lays out tags for a mapped tree
+type mappedTagWriter struct {
+	layout        uint8
+	size          uintptr
+	count         uint32
+	data          []byte
+	strings       []byte
+	stringOffsets map[string]uint32 // strings are only stored once
+}
+
+func newMappedTagWriter(capacity int) (*mappedTagWriter, error) {
+	layout, size, err := mappedTagLayout()
+	if err != nil {
+		return nil, err
+	}
+	ret := &mappedTagWriter{
+		layout: layout,
+		size:   size,
+		data:   make([]byte, 0, uintptr(capacity)*size),
+	}
+	if layout == _tagLayoutString {
+		ret.stringOffsets = make(map[string]uint32)
+	}
+	return ret, nil
+}
+
+// add appends a tag
+// - returns an error if a new string doesn't fit in the string table
+func (w *mappedTagWriter) add(tag complex128) error {
+	if s, ok := any(&tag).(*string); ok {
+		offset, found := w.stringOffsets[*s]
+		if !found {
+			if uint64(len(w.strings))+uint64(len(*s)) > maxMappedStringBytes {
+				return fmt.Errorf("mapped string table is full: can't add a %d byte string to %d bytes", len(*s), len(w.strings))
+			}
+			offset = uint32(len(w.strings))
+			w.strings = append(w.strings, *s...)
+			w.stringOffsets[*s] = offset
+		}
+		w.data = append(w.data, unsafe.Slice((*byte)(unsafe.Pointer(&offset)), 4)...)
+		length := uint32(len(*s))
+		w.data = append(w.data, unsafe.Slice((*byte)(unsafe.Pointer(&length)), 4)...)
+		w.count++
+		return nil
+	}
+	w.data = append(w.data, unsafe.Slice((*byte)(unsafe.Pointer(&tag)), w.size)...)
+	w.count++
+	return nil
+}
+
+// writeMapped writes a mapped tree, given its node records and tags
+func writeMapped(w io.Writer, addressFamily uint8, nodeCount uint32, nodes []byte, tags *mappedTagWriter) (int64, error) {
+	bw := newBinaryWriter(w)
+	bw.writeHeader(_mappedMagic, _mappedVersion, addressFamily)
+	bw.writeUint8(tags.layout)
+	bw.writeUint8(_nativeByteOrder)
+	bw.writeUint32(uint32(tags.size))
+	bw.writeUint32(nodeCount)
+	bw.writeUint32(tags.count)
+	bw.writeUint64(uint64(len(tags.strings)))
+	bw.write(make([]byte, mappedPadding(bw.count)))
+	bw.write(tags.data)
+	bw.write(tags.strings)
+	bw.write(nodes)
+	return bw.flush()
+}
+
+// mappedPadding returns how many bytes are needed after offset to reach an 8-byte boundary
+func mappedPadding(offset int64) int64 {
+	return (8 - offset%8) % 8
+}
+
+// mappedTree is the part of a mapped tree that doesn't depend on the address family
+type mappedTree struct {
+	data      []byte // the whole mapped tree - nil once closed
+	unmap     func() error
+	nodes     []byte
+	nodeCount uint32
+
+	tagLayout  uint8
+	tagSize    uintptr
+	tagCount   uint32
+	tagData    []byte
+	tagStrings []byte
+}
+
+// init points the tree's sections into data, making sure it was written for this address family and payload type
+func (t *mappedTree) init(data []byte, addressFamily uint8, nodeRecordSize int) error {
+	br := newBinaryReader(bytes.NewReader(data))
+	br.readHeader(_mappedMagic, _mappedVersion, addressFamily)
+	tagLayout := br.readUint8()
+	byteOrder := br.readUint8()
+	tagSize := br.readUint32()
+	nodeCount := br.readUint32()
+	tagCount := br.readUint32()
+	stringsLength := br.readUint64()
+	if br.err != nil {
+		return br.err
+	}
+
+	expectedLayout, expectedSize, err := mappedTagLayout()
+	if err != nil {
+		return err
+	}
+	if tagLayout != expectedLayout || uintptr(tagSize) != expectedSize {
+		return fmt.Errorf("mapped tree has a tag layout of %d with size %d, expected %d with size %d", tagLayout, tagSize, expectedLayout, expectedSize)
+	}
+	if byteOrder != _nativeByteOrder {
+		return fmt.Errorf("mapped tree was written on a machine with a different byte order")
+	}
+	if nodeCount < 2 {
+		return fmt.Errorf("invalid mapped tree: %d nodes", nodeCount)
+	}
+
+	tagOffset := uint64(br.count + mappedPadding(br.count))
+	stringsOffset := tagOffset + uint64(tagCount)*uint64(tagSize)
+	nodesOffset := stringsOffset + stringsLength
+	if nodesOffset+uint64(nodeCount)*uint64(nodeRecordSize) != uint64(len(data)) {
+		return fmt.Errorf("invalid mapped tree: expected %d bytes, found %d", nodesOffset+uint64(nodeCount)*uint64(nodeRecordSize), len(data))
+	}
+	if expectedLayout == _tagLayoutRaw && tagCount > 0 && uintptr(unsafe.Pointer(&data[tagOffset]))%8 != 0 {
+		return fmt.Errorf("mapped tree data must be 8-byte aligned")
+	}
+
+	t.data = data
+	t.nodes = data[nodesOffset:]
+	t.nodeCount = nodeCount
+	t.tagLayout = tagLayout
+	t.tagSize = uintptr(tagSize)
+	t.tagCount = tagCount
+	t.tagData = data[tagOffset:stringsOffset]
+	t.tagStrings = data[stringsOffset:nodesOffset]
+	return nil
+}
+
+// Close releases the tree's memory mapping, if it was opened from a file
+// - the tree, and any of its data, must not be used afterwards
+func (t *mappedTree) Close() error {
+	t.data = nil
+	t.nodes = nil
+	t.tagData = nil
+	t.tagStrings = nil
+	if t.unmap != nil {
+		unmap := t.unmap
+		t.unmap = nil
+		return unmap()
+	}
+	return nil
+}
+
+// nodeRecord returns the record of the input node, or an error if it's outside of the tree
+func (t *mappedTree) nodeRecord(nodeIndex uint, nodeRecordSize int) ([]byte, error) {
+	if nodeIndex >= uint(t.nodeCount) {
+		return nil, fmt.Errorf("invalid mapped tree: node %d outside of the %d nodes", nodeIndex, t.nodeCount)
+	}
+	return t.nodes[nodeIndex*uint(nodeRecordSize):][:nodeRecordSize], nil
+}
+
+// appendTags appends count tags, starting at offset, to ret
+func (t *mappedTree) appendTags(ret []complex128, offset uint32, count int) ([]complex128, error) {
+	for i := 0; i < count; i++ {
+		tag, err := t.tag(offset + uint32(i))
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, tag)
+	}
+	return ret, nil
+}
+
+// tag returns the tag at the input index
+// - strings are copied off of the mapping, so they remain valid after the tree is closed
+func (t *mappedTree) tag(index uint32) (complex128, error) {
+	var tag complex128
+	if index >= t.tagCount {
+		return tag, fmt.Errorf("invalid mapped tree: tag %d outside of the %d tags", index, t.tagCount)
+	}
+
+	record := unsafe.Pointer(&t.tagData[uintptr(index)*t.tagSize])
+	if s, ok := any(&tag).(*string); ok {
+		offset := *(*uint32)(record)
+		length := *(*uint32)(unsafe.Add(record, 4))
+		if uint64(offset)+uint64(length) > uint64(len(t.tagStrings)) {
+			return tag, fmt.Errorf("invalid mapped tree: string %d-%d outside of the %d byte string table", offset, uint64(offset)+uint64(length), len(t.tagStrings))
+		}
+		*s = string(t.tagStrings[offset : offset+length])
+		return tag, nil
+	}
+	return *(*complex128)(record), nil
+}
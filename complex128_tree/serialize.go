@@ -0,0 +1,190 @@
+package complex128_tree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// binary serialization of the trees is laid out as:
+// - header: magic, format version, address family, payload type name
+// - node count, available index count
+// - fixed-width node records, then the available indexes
+// - length-prefixed, gob-encoded list of every tag, in node order
+// - CRC-32C checksum of everything before it
+const (
+	_binaryMagic     = "PATR"
+	_binaryVersion   = uint16(1)
+	_payloadTypeName = "complex128"
+)
+
+var _crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// binaryWriter writes little-endian values, keeping track of the first error, the byte count, and a running checksum
+type binaryWriter struct {
+	w        *bufio.Writer
+	checksum hash.Hash32
+	count    int64
+	err      error
+	scratch  [8]byte
+}
+
+func newBinaryWriter(w io.Writer) *binaryWriter {
+	return &binaryWriter{
+		w:        bufio.NewWriter(w),
+		checksum: crc32.New(_crcTable),
+	}
+}
+
+func (w *binaryWriter) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.count += int64(n)
+	w.checksum.Write(p[:n])
+	w.err = err
+}
+
+func (w *binaryWriter) writeUint8(v uint8) {
+	w.scratch[0] = v
+	w.write(w.scratch[:1])
+}
+
+func (w *binaryWriter) writeUint16(v uint16) {
+	binary.LittleEndian.PutUint16(w.scratch[:], v)
+	w.write(w.scratch[:2])
+}
+
+func (w *binaryWriter) writeUint32(v uint32) {
+	binary.LittleEndian.PutUint32(w.scratch[:], v)
+	w.write(w.scratch[:4])
+}
+
+func (w *binaryWriter) writeUint64(v uint64) {
+	binary.LittleEndian.PutUint64(w.scratch[:], v)
+	w.write(w.scratch[:8])
+}
+
+// writeHeader writes the magic, format version, address family and payload type name
+func (w *binaryWriter) writeHeader(magic string, version uint16, addressFamily uint8) {
+	w.write([]byte(magic))
+	w.writeUint16(version)
+	w.writeUint8(addressFamily)
+	w.writeUint8(uint8(len(_payloadTypeName)))
+	w.write([]byte(_payloadTypeName))
+}
+
+// close writes the checksum and flushes, returning the total byte count and the first error
+func (w *binaryWriter) close() (int64, error) {
+	w.writeUint32(w.checksum.Sum32())
+	return w.flush()
+}
+
+// flush returns the total byte count and the first error
+func (w *binaryWriter) flush() (int64, error) {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	return w.count, w.err
+}
+
+// binaryReader reads little-endian values, keeping track of the first error, the byte count, and a running checksum
+type binaryReader struct {
+	r        io.Reader
+	checksum hash.Hash32
+	count    int64
+	err      error
+	scratch  [256]byte
+}
+
+func newBinaryReader(r io.Reader) *binaryReader {
+	return &binaryReader{
+		r:        r,
+		checksum: crc32.New(_crcTable),
+	}
+}
+
+// read exactly len(p) bytes into p
+func (r *binaryReader) read(p []byte) {
+	if r.err != nil {
+		return
+	}
+	n, err := io.ReadFull(r.r, p)
+	r.count += int64(n)
+	r.checksum.Write(p[:n])
+	if err != nil {
+		r.err = fmt.Errorf("couldn't read tree: %s", err)
+	}
+}
+
+func (r *binaryReader) readUint8() uint8 {
+	r.read(r.scratch[:1])
+	return r.scratch[0]
+}
+
+func (r *binaryReader) readUint16() uint16 {
+	r.read(r.scratch[:2])
+	return binary.LittleEndian.Uint16(r.scratch[:])
+}
+
+func (r *binaryReader) readUint32() uint32 {
+	r.read(r.scratch[:4])
+	return binary.LittleEndian.Uint32(r.scratch[:])
+}
+
+func (r *binaryReader) readUint64() uint64 {
+	r.read(r.scratch[:8])
+	return binary.LittleEndian.Uint64(r.scratch[:])
+}
+
+// readSection reads a section of the input length into w, without allocating the whole length up front
+func (r *binaryReader) readSection(w io.Writer, length uint64) {
+	if r.err != nil {
+		return
+	}
+	n, err := io.CopyN(io.MultiWriter(w, r.checksum), r.r, int64(length))
+	r.count += n
+	if err != nil {
+		r.err = fmt.Errorf("couldn't read tree: %s", err)
+	}
+}
+
+// readHeader reads the header, making sure it was written for this format, version, address family and payload type
+func (r *binaryReader) readHeader(magic string, version uint16, addressFamily uint8) {
+	r.read(r.scratch[:len(magic)])
+	if r.err == nil && string(r.scratch[:len(magic)]) != magic {
+		r.err = fmt.Errorf("not a serialized tree: bad magic %q", r.scratch[:len(magic)])
+		return
+	}
+
+	foundVersion := r.readUint16()
+	if r.err == nil && foundVersion != version {
+		r.err = fmt.Errorf("unsupported tree format version %d, expected %d", foundVersion, version)
+		return
+	}
+
+	family := r.readUint8()
+	if r.err == nil && family != addressFamily {
+		r.err = fmt.Errorf("tree was serialized for IPv%d addresses, expected IPv%d", family, addressFamily)
+		return
+	}
+
+	nameLength := r.readUint8()
+	r.read(r.scratch[:nameLength])
+	if r.err == nil && string(r.scratch[:nameLength]) != _payloadTypeName {
+		r.err = fmt.Errorf("tree was serialized with payload type %q, expected %q", r.scratch[:nameLength], _payloadTypeName)
+	}
+}
+
+// verifyChecksum reads the trailing checksum, making sure it matches what was read
+func (r *binaryReader) verifyChecksum() {
+	expected := r.checksum.Sum32()
+	found := r.readUint32()
+	if r.err == nil && found != expected {
+		r.err = fmt.Errorf("tree checksum mismatch: found %#08x, expected %#08x", found, expected)
+	}
+}
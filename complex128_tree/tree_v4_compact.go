@@ -0,0 +1,75 @@
+package complex128_tree
+
+import (
+	"unsafe"
+)
+
+// Compact rebuilds the tree to reclaim the memory left behind by deleted nodes and tags
+// - nodes are renumbered in depth-first order, in a node array just big enough for them
+// - each node's tags are packed together, in a tag slab just big enough for them
+// - the tags are stored again, so storage shared between them, such as the string arena, only keeps what's still used
+// - the tree grows again as usual, once tags are added
+func (t *TreeV4) Compact() CompactStats {
+	bytesBefore := t.allocatedBytes()
+	ret := CompactStats{
+		NodeCapacityBefore: cap(t.nodes),
+		NodesReclaimed:     len(t.availableIndexes),
+	}
+
+	order := t.nodeOrder()
+	newIndexes := make([]uint, len(t.nodes)) // index 0 stays 0, for 'not set'
+	for i, nodeIndex := range order {
+		newIndexes[nodeIndex] = uint(i + 1)
+	}
+
+	nodes := make([]treeNodeV4, len(order)+1)
+	tagCount := 0
+	for i, nodeIndex := range order {
+		node := t.nodes[nodeIndex]
+		node.Left = newIndexes[node.Left]
+		node.Right = newIndexes[node.Right]
+		nodes[i+1] = node
+		tagCount += node.TagCount
+	}
+
+	slab := tagSlab{slots: make([]storedTag, 0, tagCount)}
+	var store tagStore
+	for i := range nodes {
+		node := &nodes[i]
+		if node.TagCount == 0 {
+			continue
+		}
+		offset := len(slab.slots)
+		for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+			// can't run out of room: the tags left are a subset of those the old storage already holds
+			restored, _ := store.store(t.tagStorage.load(stored))
+			slab.slots = append(slab.slots, restored)
+		}
+		node.tags = tagBlock{offset: uint32(offset), capacity: uint32(node.TagCount)}
+	}
+
+	ret.TagSlotsReclaimed = len(t.tags.slots) - len(slab.slots)
+	t.nodes = nodes
+	t.availableIndexes = make([]uint, 0)
+	t.tags = slab
+	t.tagStorage = store
+
+	ret.Nodes = len(order)
+	ret.NodeCapacityAfter = cap(t.nodes)
+	ret.Tags = tagCount
+	ret.BytesReclaimed = bytesBefore - t.allocatedBytes()
+	return ret
+}
+
+// allocatedBytes estimates the memory held by the tree's node array, free list, tag slab and tag storage
+func (t *TreeV4) allocatedBytes() int {
+	var tag storedTag
+	ret := cap(t.nodes)*int(unsafe.Sizeof(treeNodeV4{})) +
+		cap(t.availableIndexes)*int(unsafe.Sizeof(uint(0))) +
+		cap(t.tags.slots)*int(unsafe.Sizeof(tag)) +
+		t.tagStorage.allocatedBytes()
+	for _, free := range t.tags.free {
+		ret += cap(free) * int(unsafe.Sizeof(tagBlock{}))
+	}
+	return ret
+}
@@ -24,6 +24,30 @@ func (t *TreeV4) newNode(address patricia.IPv4Address, prefixLength uint) uint {
 
 func (t *TreeV4) print() {
 	for i := range t.nodes {
-		fmt.Printf("%d: \tleft: %d, right: %d, prefix: %#032b (%d), tags: (%d): %s\n", i, int(t.nodes[i].Left), int(t.nodes[i].Right), int(t.nodes[i].prefix), int(t.nodes[i].prefixLength), t.nodes[i].TagCount, t.tagsForNode(uint(i)))
+		fmt.Printf("%d: \tleft: %d, right: %d, prefix: %#032b (%d), tags: (%d): %v\n", i, int(t.nodes[i].Left), int(t.nodes[i].Right), int(t.nodes[i].prefix), int(t.nodes[i].prefixLength), t.nodes[i].TagCount, t.tagsForNode(uint(i)))
 	}
 }
+
+// addressFamily returns the address family written to, and expected in, the binary serialization header
+func (t *TreeV4) addressFamily() uint8 {
+	return 4
+}
+
+// addressFamily returns the address family expected in the mapped tree header
+func (t *MappedTreeV4) addressFamily() uint8 {
+	return 4
+}
+
+// prefixBit returns whether the bit at the 0-based position, from the left, is set in the address
+func (t *TreeV4) prefixBit(address patricia.IPv4Address, position uint) bool {
+	return address.Address&(uint32(1)<<(31-position)) != 0
+}
+
+// childPrefix returns the left or right half of the prefix, one bit longer
+func (t *TreeV4) childPrefix(prefix patricia.IPv4Address, right bool) patricia.IPv4Address {
+	if right {
+		prefix.Address |= uint32(1) << (31 - prefix.Length)
+	}
+	prefix.Length++
+	return prefix
+}
@@ -0,0 +1,209 @@
+package complex128_tree
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// MarshalBinary encodes the tree into its versioned binary form, implementing encoding.BinaryMarshaler
+func (t *TreeV4) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := t.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the contents of the tree with the input binary form, implementing encoding.BinaryUnmarshaler
+func (t *TreeV4) UnmarshalBinary(data []byte) error {
+	_, err := t.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo writes the tree's versioned binary form to w, returning the number of bytes written
+func (t *TreeV4) WriteTo(w io.Writer) (int64, error) {
+	// gather the tags in node order, so they can be encoded in one pass
+	tags := make([]complex128, 0, len(t.tags.slots))
+	for i := range t.nodes {
+		for _, stored := range t.tags.tags(t.nodes[i].tags, t.nodes[i].TagCount) {
+			tags = append(tags, t.tagStorage.load(stored))
+		}
+	}
+	var tagBuf bytes.Buffer
+	if err := gob.NewEncoder(&tagBuf).Encode(tags); err != nil {
+		return 0, fmt.Errorf("couldn't encode tags: %s", err)
+	}
+
+	bw := newBinaryWriter(w)
+	bw.writeHeader(_binaryMagic, _binaryVersion, t.addressFamily())
+	bw.writeUint32(uint32(len(t.nodes)))
+	bw.writeUint32(uint32(len(t.availableIndexes)))
+
+	record := make([]byte, 0, _treeNodeV4BinarySize)
+	for i := range t.nodes {
+		bw.write(t.nodes[i].EncodeBinary(record[:0]))
+	}
+	for _, index := range t.availableIndexes {
+		bw.writeUint32(uint32(index))
+	}
+
+	bw.writeUint64(uint64(tagBuf.Len()))
+	bw.write(tagBuf.Bytes())
+	return bw.close()
+}
+
+// ReadFrom replaces the contents of the tree with the versioned binary form read from r, returning the number of bytes read
+// - fails if the data was written by a tree of a different address family or payload type
+// - the tree is left unchanged on error
+func (t *TreeV4) ReadFrom(r io.Reader) (int64, error) {
+	br := newBinaryReader(r)
+	br.readHeader(_binaryMagic, _binaryVersion, t.addressFamily())
+	nodeCount := br.readUint32()
+	availableCount := br.readUint32()
+	if br.err != nil {
+		return br.count, br.err
+	}
+	if nodeCount < 2 || availableCount > nodeCount {
+		return br.count, fmt.Errorf("invalid tree: %d nodes, %d available indexes", nodeCount, availableCount)
+	}
+
+	// grow as the data arrives, rather than trusting the counts for the allocation
+	nodes := make([]treeNodeV4, 0, min(nodeCount, 1<<16))
+	record := make([]byte, _treeNodeV4BinarySize)
+	tagCount := 0
+	for i := uint32(0); i < nodeCount && br.err == nil; i++ {
+		br.read(record)
+		var node treeNodeV4
+		if err := node.DecodeBinary(record); err != nil && br.err == nil {
+			br.err = err
+		}
+		if node.Left >= uint(nodeCount) || node.Right >= uint(nodeCount) {
+			br.err = fmt.Errorf("invalid tree: node %d has a child outside of the %d nodes", i, nodeCount)
+		}
+		tagCount += node.TagCount
+		nodes = append(nodes, node)
+	}
+
+	availableIndexes := make([]uint, 0, min(availableCount, 1<<16))
+	for i := uint32(0); i < availableCount && br.err == nil; i++ {
+		index := br.readUint32()
+		if index < 2 || index >= nodeCount {
+			br.err = fmt.Errorf("invalid tree: available index %d outside of the %d nodes", index, nodeCount)
+		}
+		availableIndexes = append(availableIndexes, uint(index))
+	}
+
+	var tagBuf bytes.Buffer
+	br.readSection(&tagBuf, br.readUint64())
+	br.verifyChecksum()
+	if br.err != nil {
+		return br.count, br.err
+	}
+	if err := validateTreeV4Nodes(nodes, availableIndexes); err != nil {
+		return br.count, err
+	}
+
+	tags := make([]complex128, 0)
+	if err := gob.NewDecoder(&tagBuf).Decode(&tags); err != nil {
+		return br.count, fmt.Errorf("couldn't decode tags: %s", err)
+	}
+	if len(tags) != tagCount {
+		return br.count, fmt.Errorf("invalid tree: nodes have %d tags, found %d", tagCount, len(tags))
+	}
+	if uint64(len(tags)) > maxTagSlots {
+		return br.count, fmt.Errorf("tag slab is full: can't load %d tags", len(tags))
+	}
+
+	// the tags are packed into the slab in node order, with each node's block just big enough
+	slab := tagSlab{slots: make([]storedTag, len(tags))}
+	var store tagStore
+	for i, tag := range tags {
+		stored, err := store.store(tag)
+		if err != nil {
+			return br.count, err
+		}
+		slab.slots[i] = stored
+	}
+	offset := 0
+	for i := range nodes {
+		if nodes[i].TagCount > 0 {
+			nodes[i].tags = tagBlock{offset: uint32(offset), capacity: uint32(nodes[i].TagCount)}
+			offset += nodes[i].TagCount
+		}
+	}
+
+	t.nodes = nodes
+	t.availableIndexes = availableIndexes
+	t.tags = slab
+	t.tagStorage = store
+	t.resetCounters()
+	return br.count, nil
+}
+
+// validateTreeV4Nodes checks that the nodes form a tree under the root, so lookups and changes can't loop forever, or
+// reach a node they don't expect
+// - every node but index 0 must be reachable from the root exactly once, or be an available index, but not both
+// - nodes other than the root must have a prefix, and no node's full prefix can be longer than an address
+// - left children's prefixes must start with a 0 bit, and right children's with a 1 bit, as lookups expect
+// - available indexes, and node 0, which stands for 'not set', must have no tags
+func validateTreeV4Nodes(nodes []treeNodeV4, availableIndexes []uint) error {
+	if nodes[0].TagCount != 0 || nodes[0].Left != 0 || nodes[0].Right != 0 {
+		return fmt.Errorf("invalid tree: node 0 is used")
+	}
+	if nodes[1].prefixLength != 0 {
+		return fmt.Errorf("invalid tree: root has a %d bit prefix", nodes[1].prefixLength)
+	}
+
+	type stackEntry struct {
+		nodeIndex    uint
+		prefixLength uint
+	}
+	seen := make([]bool, len(nodes))
+	seen[1] = true
+	reachable := 0
+	stack := make([]stackEntry, 1, 64)
+	stack[0] = stackEntry{nodeIndex: 1}
+	for len(stack) > 0 {
+		entry := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		reachable++
+
+		node := &nodes[entry.nodeIndex]
+		if entry.nodeIndex != 1 && node.prefixLength == 0 {
+			return fmt.Errorf("invalid tree: node %d has no prefix", entry.nodeIndex)
+		}
+		prefixLength := entry.prefixLength + node.prefixLength
+		if prefixLength > _treeNodeV4MaxPrefixLength {
+			return fmt.Errorf("invalid tree: node %d has a %d bit prefix", entry.nodeIndex, prefixLength)
+		}
+		for i, child := range [2]uint{node.Left, node.Right} {
+			if child == 0 {
+				continue
+			}
+			if seen[child] {
+				return fmt.Errorf("invalid tree: node %d is reached more than once", child)
+			}
+			if nodes[child].prefixLength > 0 && nodes[child].IsLeftBitSet() != (i == 1) {
+				return fmt.Errorf("invalid tree: node %d is on the wrong side of node %d", child, entry.nodeIndex)
+			}
+			seen[child] = true
+			stack = append(stack, stackEntry{nodeIndex: child, prefixLength: prefixLength})
+		}
+	}
+
+	for _, index := range availableIndexes {
+		if seen[index] {
+			return fmt.Errorf("invalid tree: available index %d is already in use", index)
+		}
+		if nodes[index].TagCount != 0 {
+			return fmt.Errorf("invalid tree: available index %d has tags", index)
+		}
+		seen[index] = true
+	}
+	if unaccounted := len(nodes) - 1 - reachable - len(availableIndexes); unaccounted != 0 {
+		return fmt.Errorf("invalid tree: %d nodes are neither reachable nor available", unaccounted)
+	}
+	return nil
+}
@@ -7,3 +7,49 @@ type MatchesFunc func(payload complex128, val complex128) bool
 
 // FilterFunc is called on each result to see if it belongs in the resulting set
 type FilterFunc func(payload complex128) bool
+
+// equalTagsFunc returns what tags are compared with when no MatchesFunc is given: ==
+// - the generic package has its own, for payload types that can't be compared with ==
+func equalTagsFunc() MatchesFunc {
+	return func(payload complex128, val complex128) bool {
+		return payload == val
+	}
+}
+
+// batchPathEntry is a node on the path of the previous address in a batch lookup
+type batchPathEntry struct {
+	nodeIndex    uint
+	depth        uint // length of the node's full prefix
+	tagCount     int  // number of tags collected down to, and including, this node
+	deepestIndex uint // index of the deepest node with tags down to, and including, this node - 0 for none
+}
+
+// CompactStats reports what Compact reclaimed from a tree
+type CompactStats struct {
+	Nodes              int // nodes left in the tree, including the root
+	NodesReclaimed     int // deleted nodes dropped from the node array
+	NodeCapacityBefore int // capacity of the node array before compacting
+	NodeCapacityAfter  int // capacity of the node array after compacting
+	Tags               int // tags left in the tree
+	TagSlotsReclaimed  int // unused slots dropped from the tag slab, whether freed or spare room in a node's block
+	BytesReclaimed     int // estimated memory released
+}
+
+// TreeStats reports the size and shape of a tree, for monitoring
+type TreeStats struct {
+	Nodes             int   // nodes in the tree, including the root
+	TaggedNodes       int   // nodes with at least one tag
+	Tags              int   // tags in the tree
+	FreeNodes         int   // deleted nodes in the node array, waiting to be reused
+	NodeArrayLength   int   // length of the node array, including deleted nodes, and index 0, which is unused
+	NodeArrayCapacity int   // capacity of the node array
+	FreeTagSlots      int   // slots in the tag slab's free blocks, waiting to be reused
+	PrefixLengths     []int // tagged nodes, by the length of their prefix: 0 to 32 for IPv4, 0 to 128 for IPv6
+	Bytes             int   // estimated memory used by the node array, tag slab and tag storage
+}
+
+// DepthStats reports how deep a tree's tagged nodes are
+type DepthStats struct {
+	MaxDepth     int     // most nodes on the path from the root to a tagged node, not counting the root
+	AverageDepth float64 // average nodes on the path from the root to each tagged node, not counting the root
+}
@@ -0,0 +1,85 @@
+package complex64_tree
+
+import (
+	"net/netip"
+
+	"github.com/kentik/patricia"
+)
+
+// AddPrefix adds a tag to the tree at the input prefix
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at this node
+// - returns whether the tag count at this address was increased, and how many tags at this address
+func (t *TreeV4) AddPrefix(prefix netip.Prefix, tag complex64, matchFunc MatchesFunc) (bool, int, error) {
+	address, err := patricia.IPv4AddressFromPrefix(prefix)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.Add(address, tag, matchFunc)
+}
+
+// SetPrefix sets the single value for the node at the input prefix - overwrites what's there
+// Returns whether the tag count at this address was increased, and how many tags at this address
+func (t *TreeV4) SetPrefix(prefix netip.Prefix, tag complex64) (bool, int, error) {
+	address, err := patricia.IPv4AddressFromPrefix(prefix)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.Set(address, tag)
+}
+
+// DeletePrefix deletes the tags at the input prefix matching matchVal. Returns how many tags are removed
+func (t *TreeV4) DeletePrefix(prefix netip.Prefix, matchFunc MatchesFunc, matchVal complex64) (int, error) {
+	address, err := patricia.IPv4AddressFromPrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+	return t.Delete(address, matchFunc, matchVal)
+}
+
+// FindTagsPrefix finds all of the tags on the input prefix's path
+func (t *TreeV4) FindTagsPrefix(prefix netip.Prefix) ([]complex64, error) {
+	address, err := patricia.IPv4AddressFromPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return t.FindTags(address)
+}
+
+// FindTagsAddr finds all of the tags on the input address's path
+func (t *TreeV4) FindTagsAddr(addr netip.Addr) ([]complex64, error) {
+	address, err := patricia.IPv4AddressFromAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.FindTags(address)
+}
+
+// FindTagsAddrAppend appends all of the tags on the input address's path to dst, returning the extended slice
+// - doesn't allocate if dst has enough capacity
+func (t *TreeV4) FindTagsAddrAppend(dst []complex64, addr netip.Addr) ([]complex64, error) {
+	address, err := patricia.IPv4AddressFromAddr(addr)
+	if err != nil {
+		return dst, err
+	}
+	return t.FindTagsAppend(dst, address), nil
+}
+
+// FindDeepestTagPrefix finds the tag at the deepest level on the input prefix's path
+func (t *TreeV4) FindDeepestTagPrefix(prefix netip.Prefix) (bool, complex64, error) {
+	address, err := patricia.IPv4AddressFromPrefix(prefix)
+	if err != nil {
+		var ret complex64
+		return false, ret, err
+	}
+	return t.FindDeepestTag(address)
+}
+
+// FindDeepestTagAddr finds the tag at the deepest level on the input address's path
+func (t *TreeV4) FindDeepestTagAddr(addr netip.Addr) (bool, complex64, error) {
+	address, err := patricia.IPv4AddressFromAddr(addr)
+	if err != nil {
+		var ret complex64
+		return false, ret, err
+	}
+	return t.FindDeepestTag(address)
+}
@@ -0,0 +1,95 @@
+package patricia
+
+// IPv4 addresses embedded in IPv6 addresses by transition mechanisms
+
+// NAT64WellKnownPrefix is the well-known NAT64 prefix, 64:ff9b::/96, from RFC 6052
+var NAT64WellKnownPrefix = IPv6Address{Left: 0x0064ff9b00000000, Right: 0, Length: 96}
+
+// Extract6to4 returns the IPv4 address embedded in a 6to4 address, 2002:AABB:CCDD::/48, from RFC 3056
+// - a prefix shorter than /48 returns the IPv4 prefix it covers
+// - returns false if the address isn't within 2002::/16
+func (ip IPv6Address) Extract6to4() (IPv4Address, bool) {
+	if ip.Left>>48 != 0x2002 || ip.Length < 16 || ip.Length > 128 {
+		return IPv4Address{}, false
+	}
+	return NewIPv4Address(uint32(ip.Left>>16), min(ip.Length-16, 32)).masked(), true
+}
+
+// ExtractTeredo returns the client IPv4 address embedded, obfuscated, in the last 32 bits of a Teredo address, from RFC 4380
+// - a prefix shorter than /128 returns the IPv4 prefix it covers
+// - returns false if the address isn't within 2001::/32, or is shorter than /96
+func (ip IPv6Address) ExtractTeredo() (IPv4Address, bool) {
+	if ip.Left>>32 != 0x20010000 || ip.Length < 96 || ip.Length > 128 {
+		return IPv4Address{}, false
+	}
+	return NewIPv4Address(^uint32(ip.Right), ip.Length-96).masked(), true
+}
+
+// ExtractNAT64 returns the IPv4 address embedded in an address within the NAT64 prefix, with the layouts from RFC 6052
+// - the NAT64 prefix must be a /32, /40, /48, /56, /64 or /96, such as NAT64WellKnownPrefix
+// - bits 64-71 of the address are skipped, and must be zero unless the prefix is a /96
+// - a prefix shorter than the end of the embedded address returns the IPv4 prefix it covers
+// - returns false if the address isn't within the NAT64 prefix
+func (ip IPv6Address) ExtractNAT64(nat64Prefix IPv6Address) (IPv4Address, bool) {
+	prefixLength := nat64Prefix.Length
+	switch prefixLength {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return IPv4Address{}, false
+	}
+	if ip.Length > 128 || ip.CommonPrefixLength(nat64Prefix) < prefixLength {
+		return IPv4Address{}, false
+	}
+
+	if prefixLength == 96 {
+		return NewIPv4Address(uint32(ip.Right), ip.Length-96).masked(), true
+	}
+	if ip.Length > 64 && ip.Right>>56 != 0 {
+		return IPv4Address{}, false
+	}
+
+	// the embedded bits left in the first half, followed by the second half without bits 64-71
+	embedded := (ip.Left << prefixLength) | ((ip.Right << 8) >> (64 - prefixLength))
+	length := uint(0)
+	if ip.Length > 72 {
+		length = min(ip.Length-8-prefixLength, 32)
+	} else if ip.Length > 64 {
+		length = 64 - prefixLength
+	} else {
+		length = ip.Length - prefixLength
+	}
+	return NewIPv4Address(uint32(embedded>>32), length).masked(), true
+}
+
+// EmbeddedIPv4 selects which transition mechanisms to extract embedded IPv4 addresses from
+// - the zero value extracts nothing
+type EmbeddedIPv4 struct {
+	SixToFour     bool          // 2002::/16
+	Teredo        bool          // 2001::/32
+	NAT64Prefixes []IPv6Address // such as NAT64WellKnownPrefix
+}
+
+// Enabled returns whether any mechanism is selected
+func (e EmbeddedIPv4) Enabled() bool {
+	return e.SixToFour || e.Teredo || len(e.NAT64Prefixes) > 0
+}
+
+// Extract returns the IPv4 address embedded in the address by the first selected mechanism it belongs to
+func (e EmbeddedIPv4) Extract(address IPv6Address) (IPv4Address, bool) {
+	if e.SixToFour {
+		if v4, ok := address.Extract6to4(); ok {
+			return v4, true
+		}
+	}
+	if e.Teredo {
+		if v4, ok := address.ExtractTeredo(); ok {
+			return v4, true
+		}
+	}
+	for _, prefix := range e.NAT64Prefixes {
+		if v4, ok := address.ExtractNAT64(prefix); ok {
+			return v4, true
+		}
+	}
+	return IPv4Address{}, false
+}
@@ -0,0 +1,135 @@
+package patricia
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseIPv6(t *testing.T, address string) IPv6Address {
+	parsed, err := ParseIP(address)
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV6, address)
+	return parsed.V6
+}
+
+func TestExtract6to4(t *testing.T) {
+	v4, ok := mustParseIPv6(t, "2002:c000:221::1").Extract6to4()
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.33/32", v4.String())
+
+	v4, ok = mustParseIPv6(t, "2002:c000:221::/48").Extract6to4()
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.33/32", v4.String())
+
+	v4, ok = mustParseIPv6(t, "2002:c000:200::/40").Extract6to4()
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.0/24", v4.String())
+
+	v4, ok = mustParseIPv6(t, "2002::/16").Extract6to4()
+	assert.True(t, ok)
+	assert.Equal(t, "0.0.0.0/0", v4.String())
+
+	_, ok = mustParseIPv6(t, "2003:c000:221::1").Extract6to4()
+	assert.False(t, ok)
+	_, ok = mustParseIPv6(t, "2000::/8").Extract6to4()
+	assert.False(t, ok)
+}
+
+func TestExtractTeredo(t *testing.T) {
+	// from RFC 4380
+	v4, ok := mustParseIPv6(t, "2001:0000:4136:e378:8000:63bf:3fff:fdd2").ExtractTeredo()
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.45/32", v4.String())
+
+	v4, ok = mustParseIPv6(t, "2001:0000:4136:e378:8000:63bf:3fff:fd00/120").ExtractTeredo()
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.0/24", v4.String())
+
+	_, ok = mustParseIPv6(t, "2001:0000:4136:e378::/64").ExtractTeredo()
+	assert.False(t, ok)
+	_, ok = mustParseIPv6(t, "2001:db8:4136:e378:8000:63bf:3fff:fdd2").ExtractTeredo()
+	assert.False(t, ok)
+}
+
+func TestExtractNAT64(t *testing.T) {
+	// the examples from RFC 6052, section 2.4, all embedding 192.0.2.33
+	tests := []struct {
+		prefix  string
+		address string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::/96", "64:ff9b::192.0.2.33"},
+	}
+	for _, test := range tests {
+		prefix := mustParseIPv6(t, test.prefix)
+		address := mustParseIPv6(t, test.address)
+
+		v4, ok := address.ExtractNAT64(prefix)
+		assert.True(t, ok, test.address)
+		assert.Equal(t, "192.0.2.33/32", v4.String(), test.address)
+
+		// the prefix covering the first 24 bits of the IPv4 address
+		address.Length = prefix.Length + 24
+		if prefix.Length <= 64 && address.Length > 64 {
+			address.Length += 8
+		}
+		v4, ok = address.masked().ExtractNAT64(prefix)
+		assert.True(t, ok, test.address)
+		assert.Equal(t, "192.0.2.0/24", v4.String(), test.address)
+
+		// outside of the prefix
+		address.Left ^= 1 << 63
+		_, ok = address.ExtractNAT64(prefix)
+		assert.False(t, ok, test.address)
+	}
+
+	v4, ok := mustParseIPv6(t, "64:ff9b::c633:6407").ExtractNAT64(NAT64WellKnownPrefix)
+	assert.True(t, ok)
+	assert.Equal(t, "198.51.100.7/32", v4.String())
+
+	// bits 64-71 must be zero
+	_, ok = mustParseIPv6(t, "2001:db8:122:344:1c0:2:2100:0").ExtractNAT64(mustParseIPv6(t, "2001:db8:122:344::/64"))
+	assert.False(t, ok)
+
+	// unsupported prefix lengths
+	_, ok = mustParseIPv6(t, "2001:db8::1").ExtractNAT64(mustParseIPv6(t, "2001:db8::/33"))
+	assert.False(t, ok)
+}
+
+func TestEmbeddedIPv4(t *testing.T) {
+	sixToFour := mustParseIPv6(t, "2002:c000:221::1")
+	teredo := mustParseIPv6(t, "2001:0000:4136:e378:8000:63bf:3fff:fdd2")
+	nat64 := mustParseIPv6(t, "64:ff9b::192.0.2.1")
+	native := mustParseIPv6(t, "2001:db8::1")
+
+	var embedded EmbeddedIPv4
+	assert.False(t, embedded.Enabled())
+	for _, address := range []IPv6Address{sixToFour, teredo, nat64, native} {
+		_, ok := embedded.Extract(address)
+		assert.False(t, ok)
+	}
+
+	embedded = EmbeddedIPv4{SixToFour: true, Teredo: true, NAT64Prefixes: []IPv6Address{NAT64WellKnownPrefix}}
+	assert.True(t, embedded.Enabled())
+	v4, ok := embedded.Extract(sixToFour)
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.33/32", v4.String())
+	v4, ok = embedded.Extract(teredo)
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.45/32", v4.String())
+	v4, ok = embedded.Extract(nat64)
+	assert.True(t, ok)
+	assert.Equal(t, "192.0.2.1/32", v4.String())
+	_, ok = embedded.Extract(native)
+	assert.False(t, ok)
+
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		embedded.Extract(nat64)
+	}))
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package float32_tree
+
+import (
+	"os"
+)
+
+// mapFile reads the file at path into memory, on platforms without memory-mapping support
+func mapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,85 @@
+package float32_tree
+
+import (
+	"net/netip"
+
+	"github.com/kentik/patricia"
+)
+
+// AddPrefix adds a tag to the tree at the input prefix
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at this node
+// - returns whether the tag count at this address was increased, and how many tags at this address
+func (t *TreeV6) AddPrefix(prefix netip.Prefix, tag float32, matchFunc MatchesFunc) (bool, int, error) {
+	address, err := patricia.IPv6AddressFromPrefix(prefix)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.Add(address, tag, matchFunc)
+}
+
+// SetPrefix sets the single value for the node at the input prefix - overwrites what's there
+// Returns whether the tag count at this address was increased, and how many tags at this address
+func (t *TreeV6) SetPrefix(prefix netip.Prefix, tag float32) (bool, int, error) {
+	address, err := patricia.IPv6AddressFromPrefix(prefix)
+	if err != nil {
+		return false, 0, err
+	}
+	return t.Set(address, tag)
+}
+
+// DeletePrefix deletes the tags at the input prefix matching matchVal. Returns how many tags are removed
+func (t *TreeV6) DeletePrefix(prefix netip.Prefix, matchFunc MatchesFunc, matchVal float32) (int, error) {
+	address, err := patricia.IPv6AddressFromPrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+	return t.Delete(address, matchFunc, matchVal)
+}
+
+// FindTagsPrefix finds all of the tags on the input prefix's path
+func (t *TreeV6) FindTagsPrefix(prefix netip.Prefix) ([]float32, error) {
+	address, err := patricia.IPv6AddressFromPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return t.FindTags(address)
+}
+
+// FindTagsAddr finds all of the tags on the input address's path
+func (t *TreeV6) FindTagsAddr(addr netip.Addr) ([]float32, error) {
+	address, err := patricia.IPv6AddressFromAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.FindTags(address)
+}
+
+// FindTagsAddrAppend appends all of the tags on the input address's path to dst, returning the extended slice
+// - doesn't allocate if dst has enough capacity
+func (t *TreeV6) FindTagsAddrAppend(dst []float32, addr netip.Addr) ([]float32, error) {
+	address, err := patricia.IPv6AddressFromAddr(addr)
+	if err != nil {
+		return dst, err
+	}
+	return t.FindTagsAppend(dst, address), nil
+}
+
+// FindDeepestTagPrefix finds the tag at the deepest level on the input prefix's path
+func (t *TreeV6) FindDeepestTagPrefix(prefix netip.Prefix) (bool, float32, error) {
+	address, err := patricia.IPv6AddressFromPrefix(prefix)
+	if err != nil {
+		var ret float32
+		return false, ret, err
+	}
+	return t.FindDeepestTag(address)
+}
+
+// FindDeepestTagAddr finds the tag at the deepest level on the input address's path
+func (t *TreeV6) FindDeepestTagAddr(addr netip.Addr) (bool, float32, error) {
+	address, err := patricia.IPv6AddressFromAddr(addr)
+	if err != nil {
+		var ret float32
+		return false, ret, err
+	}
+	return t.FindDeepestTag(address)
+}
@@ -0,0 +1,46 @@
+// Package generic is a tree for any payload type, given as a type parameter, rather than generated for each type
+// - it's generated from the same template as the type-specific trees, and has the same API
+// - like them, it's only left alone by the garbage collector if the payload type has no pointers
+package generic
+
+import (
+	"reflect"
+)
+
+// payloadTypeName returns the name of the payload type, written to, and expected in, the binary serialization header
+func payloadTypeName[T any]() string {
+	return reflect.TypeFor[T]().String()
+}
+
+// equalTagsFunc returns what tags are compared with when no MatchesFunc is given
+// - tags are compared with ==, unless the payload type can't be, such as a slice, or might hold something that can't be,
+// such as an interface, in which case they're compared with reflect.DeepEqual, rather than panicking
+func equalTagsFunc[T any]() MatchesFunc[T] {
+	if strictlyComparable(reflect.TypeFor[T]()) {
+		return func(payload T, val T) bool {
+			return any(payload) == any(val)
+		}
+	}
+	return func(payload T, val T) bool {
+		return reflect.DeepEqual(payload, val)
+	}
+}
+
+// strictlyComparable returns whether values of the type can always be compared with ==, without panicking
+func strictlyComparable(valueType reflect.Type) bool {
+	switch valueType.Kind() {
+	case reflect.Interface:
+		return false
+	case reflect.Array:
+		return strictlyComparable(valueType.Elem())
+	case reflect.Struct:
+		for i := 0; i < valueType.NumField(); i++ {
+			if !strictlyComparable(valueType.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return valueType.Comparable()
+	}
+}
@@ -0,0 +1,155 @@
+package generic
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/kentik/patricia/string_tree"
+	"github.com/kentik/patricia/uint32_tree"
+)
+
+// benchmarks comparing the generic tree with the generated ones, on the template's test tags
+
+type benchmarkTag struct {
+	address patricia.IPv4Address
+	tag     string
+	value   uint32
+}
+
+func loadBenchmarkTags(b *testing.B) []benchmarkTag {
+	file, err := os.Open("../template/test_tags.tsv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+
+	ret := make([]benchmarkTag, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		parsed, err := patricia.ParseIP(parts[0])
+		if err != nil {
+			b.Fatal(err)
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ret = append(ret, benchmarkTag{address: parsed.V4, tag: parts[1], value: uint32(value)})
+	}
+	if err := scanner.Err(); err != nil {
+		b.Fatal(err)
+	}
+	return ret
+}
+
+// benchmarkLookups returns the full addresses looked up by the benchmarks: one within each tagged prefix
+func benchmarkLookups(tags []benchmarkTag) []patricia.IPv4Address {
+	ret := make([]patricia.IPv4Address, 0, len(tags))
+	for i, tag := range tags {
+		ret = append(ret, patricia.NewIPv4Address(tag.address.Address|(uint32(i)&(uint32(0xffffffff)>>tag.address.Length)), 32))
+	}
+	return ret
+}
+
+func BenchmarkBuild(b *testing.B) {
+	tags := loadBenchmarkTags(b)
+	b.Run("generic-uint32", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			tree := NewTreeV4[uint32]()
+			for _, tag := range tags {
+				tree.Add(tag.address, tag.value, nil)
+			}
+		}
+	})
+	b.Run("uint32_tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			tree := uint32_tree.NewTreeV4()
+			for _, tag := range tags {
+				tree.Add(tag.address, tag.value, nil)
+			}
+		}
+	})
+	b.Run("generic-string", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			tree := NewTreeV4[string]()
+			for _, tag := range tags {
+				tree.Add(tag.address, tag.tag, nil)
+			}
+		}
+	})
+	b.Run("string_tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			tree := string_tree.NewTreeV4()
+			for _, tag := range tags {
+				tree.Add(tag.address, tag.tag, nil)
+			}
+		}
+	})
+}
+
+func BenchmarkFindTagsAppend(b *testing.B) {
+	tags := loadBenchmarkTags(b)
+	lookups := benchmarkLookups(tags)
+
+	b.Run("generic-uint32", func(b *testing.B) {
+		tree := NewTreeV4[uint32]()
+		for _, tag := range tags {
+			tree.Add(tag.address, tag.value, nil)
+		}
+		buf := make([]uint32, 0, 64)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			buf = tree.FindTagsAppend(buf[:0], lookups[n%len(lookups)])
+		}
+	})
+	b.Run("uint32_tree", func(b *testing.B) {
+		tree := uint32_tree.NewTreeV4()
+		for _, tag := range tags {
+			tree.Add(tag.address, tag.value, nil)
+		}
+		buf := make([]uint32, 0, 64)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			buf = tree.FindTagsAppend(buf[:0], lookups[n%len(lookups)])
+		}
+	})
+}
+
+func BenchmarkFindDeepestTag(b *testing.B) {
+	tags := loadBenchmarkTags(b)
+	lookups := benchmarkLookups(tags)
+
+	b.Run("generic-uint32", func(b *testing.B) {
+		tree := NewTreeV4[uint32]()
+		for _, tag := range tags {
+			tree.Add(tag.address, tag.value, nil)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			tree.FindDeepestTag(lookups[n%len(lookups)])
+		}
+	})
+	b.Run("uint32_tree", func(b *testing.B) {
+		tree := uint32_tree.NewTreeV4()
+		for _, tag := range tags {
+			tree.Add(tag.address, tag.value, nil)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			tree.FindDeepestTag(lookups[n%len(lookups)])
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package generic
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/kentik/patricia/uint32_tree"
+	"github.com/stretchr/testify/assert"
+)
+
+// flowClass is a pointer-free struct payload, which no generated package has a tree for
+type flowClass struct {
+	ASN     uint32
+	Country [2]byte
+}
+
+func TestTreeV4Struct(t *testing.T) {
+	tree := NewTreeV4[flowClass]()
+	us := flowClass{ASN: 6169, Country: [2]byte{'U', 'S'}}
+	de := flowClass{ASN: 3320, Country: [2]byte{'D', 'E'}}
+
+	parsed, _ := patricia.ParseIP("10.0.0.0/8")
+	tree.Add(parsed.V4, us, nil)
+	parsed, _ = patricia.ParseIP("10.1.0.0/16")
+	tree.Add(parsed.V4, de, nil)
+
+	parsed, _ = patricia.ParseIP("10.1.2.3")
+	tags, err := tree.FindTags(parsed.V4)
+	assert.NoError(t, err)
+	assert.Equal(t, []flowClass{us, de}, tags)
+	found, tag, err := tree.FindDeepestTag(parsed.V4)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, de, tag)
+
+	parsed, _ = patricia.ParseIP("10.1.0.0/16")
+	count, err := tree.Delete(parsed.V4, func(payload flowClass, val flowClass) bool {
+		return payload.ASN == val.ASN
+	}, flowClass{ASN: 3320})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	parsed, _ = patricia.ParseIP("10.1.2.3")
+	tags, _ = tree.FindTags(parsed.V4)
+	assert.Equal(t, []flowClass{us}, tags)
+
+	// aggregation compares with == by default
+	parsed, _ = patricia.ParseIP("10.2.0.0/16")
+	tree.Add(parsed.V4, us, nil)
+	aggregated := tree.Aggregate(nil)
+	assert.Equal(t, 1, aggregated.countTags(1))
+}
+
+func TestAggregateSlices(t *testing.T) {
+	// slices can't be compared with ==, so they're compared with reflect.DeepEqual by default
+	tree := NewTreeV4[[]byte]()
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 9), []byte("a"), nil)
+	tree.Add(patricia.NewIPv4Address(0x0a800000, 9), []byte("a"), nil)
+	tree.Add(patricia.NewIPv4Address(0x0b000000, 8), []byte("b"), nil)
+	aggregated := tree.Aggregate(nil)
+	tags, ok := aggregated.GetExact(patricia.NewIPv4Address(0x0a000000, 8))
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{[]byte("a")}, tags)
+	assert.Equal(t, 2, aggregated.countTags(1))
+
+	// as are structs holding interfaces, which might hold slices
+	type boxed struct{ value any }
+	boxedTree := NewTreeV4[boxed]()
+	boxedTree.Add(patricia.NewIPv4Address(0x0a000000, 9), boxed{[]int{1}}, nil)
+	boxedTree.Add(patricia.NewIPv4Address(0x0a800000, 9), boxed{[]int{1}}, nil)
+	assert.Equal(t, 1, boxedTree.Aggregate(nil).countTags(1))
+
+	assert.True(t, strictlyComparable(reflect.TypeFor[flowClass]()))
+	assert.False(t, strictlyComparable(reflect.TypeFor[[]byte]()))
+	assert.False(t, strictlyComparable(reflect.TypeFor[[2]any]()))
+}
+
+func TestTreeV6(t *testing.T) {
+	tree := NewTreeV6[string]()
+	parsed, _ := patricia.ParseIP("2001:db8::/32")
+	tree.Add(parsed.V6, "documentation", nil)
+	parsed, _ = patricia.ParseIP("2001:db8::1")
+	tags, err := tree.FindTags(parsed.V6)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"documentation"}, tags)
+}
+
+func TestTree(t *testing.T) {
+	tree := NewTree[int]()
+	tree.AddString("192.0.2.0/24", 4, nil)
+	tree.AddString("2001:db8::/32", 6, nil)
+	assert.Equal(t, 2, tree.CountTags())
+
+	found, tag, err := tree.FindDeepestTagString("192.0.2.1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 4, tag)
+	found, tag, err = tree.FindDeepestTagString("2001:db8::1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 6, tag)
+}
+
+// TestMatchesGenerated makes sure the generic tree behaves exactly like the generated one
+func TestMatchesGenerated(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tree := NewTreeV4[uint32]()
+	generated := uint32_tree.NewTreeV4()
+	matchFunc := func(payload uint32, val uint32) bool {
+		return payload == val
+	}
+
+	for i := 0; i < 10000; i++ {
+		length := uint(random.Intn(33))
+		address := patricia.NewIPv4Address(random.Uint32()&0xff0000ff&^(uint32(0xffffffff)>>length), length)
+		if length == 0 {
+			address.Address = 0
+		}
+		tag := uint32(random.Intn(10))
+
+		switch random.Intn(4) {
+		case 0, 1:
+			added, count, _ := tree.Add(address, tag, matchFunc)
+			generatedAdded, generatedCount, _ := generated.Add(address, tag, matchFunc)
+			assert.Equal(t, generatedAdded, added)
+			assert.Equal(t, generatedCount, count)
+		case 2:
+			deleted, _ := tree.Delete(address, matchFunc, tag)
+			generatedDeleted, _ := generated.Delete(address, matchFunc, tag)
+			assert.Equal(t, generatedDeleted, deleted)
+		case 3:
+			tags, _ := tree.FindTags(address)
+			generatedTags, _ := generated.FindTags(address)
+			assert.Equal(t, generatedTags, tags)
+		}
+	}
+
+	// and serializes to the same bytes
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+	generatedData, err := generated.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, generatedData, data)
+
+	loaded := NewTreeV4[uint32]()
+	assert.NoError(t, loaded.UnmarshalBinary(generatedData))
+	assert.Equal(t, tree.countTags(1), loaded.countTags(1))
+
+	// but not to a tree of another payload type
+	assert.Error(t, NewTreeV4[int32]().UnmarshalBinary(data))
+}
@@ -0,0 +1,87 @@
+package generic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/kentik/patricia"
+)
+
+// size of a node's binary encoding: left, right, prefix, prefix length, tag count
+const _treeNodeV4BinarySize = 4 + 4 + 4 + 1 + 4
+
+// the longest prefix a node can have
+const _treeNodeV4MaxPrefixLength = 32
+
+const _leftmost32Bit = uint32(1 << 31)
+
+type treeNodeV4 struct {
+	Left         uint // left node index: 0 for not set
+	Right        uint // right node index: 0 for not set
+	prefix       uint32
+	prefixLength uint
+	TagCount     int
+	tags         tagBlock // where the tags are in the tree's tag slab
+}
+
+// See how many bits match the input address
+func (n *treeNodeV4) MatchCount(address patricia.IPv4Address) uint {
+	var length uint
+	if address.Length > n.prefixLength {
+		length = n.prefixLength
+	} else {
+		length = address.Length
+	}
+
+	matches := uint(bits.LeadingZeros32(n.prefix ^ address.Address))
+	if matches > length {
+		return length
+	}
+	return matches
+}
+
+// ShiftPrefix shifts the prefix by the input shiftCount
+func (n *treeNodeV4) ShiftPrefix(shiftCount uint) {
+	n.prefix <<= shiftCount
+	n.prefixLength -= shiftCount
+}
+
+// IsLeftBitSet returns whether the leftmost bit is set
+func (n *treeNodeV4) IsLeftBitSet() bool {
+	return n.prefix >= _leftmost32Bit
+}
+
+// MergeFromNodes updates the prefix and prefix length from the two input nodes
+func (n *treeNodeV4) MergeFromNodes(left *treeNodeV4, right *treeNodeV4) {
+	n.prefix, n.prefixLength = patricia.MergePrefixes32(left.prefix, left.prefixLength, right.prefix, right.prefixLength)
+}
+
+// AppendPrefix returns the input address (the full prefix of this node's parent), extended by this node's prefix
+func (n *treeNodeV4) AppendPrefix(address patricia.IPv4Address) patricia.IPv4Address {
+	address.Address, address.Length = patricia.MergePrefixes32(address.Address, address.Length, n.prefix, n.prefixLength)
+	return address
+}
+
+// EncodeBinary appends the node's fixed-width binary encoding to b
+func (n *treeNodeV4) EncodeBinary(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(n.Left))
+	b = binary.LittleEndian.AppendUint32(b, uint32(n.Right))
+	b = binary.LittleEndian.AppendUint32(b, n.prefix)
+	b = append(b, uint8(n.prefixLength))
+	b = binary.LittleEndian.AppendUint32(b, uint32(n.TagCount))
+	return b
+}
+
+// DecodeBinary sets the node from its fixed-width binary encoding
+func (n *treeNodeV4) DecodeBinary(b []byte) error {
+	n.Left = uint(binary.LittleEndian.Uint32(b))
+	n.Right = uint(binary.LittleEndian.Uint32(b[4:]))
+	n.prefix = binary.LittleEndian.Uint32(b[8:])
+	n.prefixLength = uint(b[12])
+	n.TagCount = int(binary.LittleEndian.Uint32(b[13:]))
+	if n.prefixLength > 32 {
+		return fmt.Errorf("invalid node prefix length: %d", n.prefixLength)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package generic
+
+import (
+	"fmt"
+
+	"github.com/kentik/patricia"
+)
+
+// this is IPv4 tree code that's not very copy/paste friendly for when we transfer IPv4 code to IPv6
+
+// create a new node in the tree, return its index
+func (t *TreeV4[T]) newNode(address patricia.IPv4Address, prefixLength uint) uint {
+	availCount := len(t.availableIndexes)
+	if availCount > 0 {
+		index := t.availableIndexes[availCount-1]
+		t.availableIndexes = t.availableIndexes[:availCount-1]
+		t.nodes[index] = treeNodeV4{prefix: address.Address, prefixLength: prefixLength}
+		return index
+	}
+
+	t.nodes = append(t.nodes, treeNodeV4{prefix: address.Address, prefixLength: prefixLength})
+	return uint(len(t.nodes) - 1)
+}
+
+func (t *TreeV4[T]) print() {
+	for i := range t.nodes {
+		fmt.Printf("%d: \tleft: %d, right: %d, prefix: %#032b (%d), tags: (%d): %v\n", i, int(t.nodes[i].Left), int(t.nodes[i].Right), int(t.nodes[i].prefix), int(t.nodes[i].prefixLength), t.nodes[i].TagCount, t.tagsForNode(uint(i)))
+	}
+}
+
+// addressFamily returns the address family written to, and expected in, the binary serialization header
+func (t *TreeV4[T]) addressFamily() uint8 {
+	return 4
+}
+
+// addressFamily returns the address family expected in the mapped tree header
+func (t *MappedTreeV4[T]) addressFamily() uint8 {
+	return 4
+}
+
+// prefixBit returns whether the bit at the 0-based position, from the left, is set in the address
+func (t *TreeV4[T]) prefixBit(address patricia.IPv4Address, position uint) bool {
+	return address.Address&(uint32(1)<<(31-position)) != 0
+}
+
+// childPrefix returns the left or right half of the prefix, one bit longer
+func (t *TreeV4[T]) childPrefix(prefix patricia.IPv4Address, right bool) patricia.IPv4Address {
+	if right {
+		prefix.Address |= uint32(1) << (31 - prefix.Length)
+	}
+	prefix.Length++
+	return prefix
+}
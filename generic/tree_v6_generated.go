@@ -0,0 +1,859 @@
+package generic
+
+import (
+	"fmt"
+
+	"github.com/kentik/patricia"
+)
+
+// TreeV6 is an IP Address patricia tree
+type TreeV6[T any] struct {
+	nodes            []treeNodeV6 // root is always at [1] - [0] is unused
+	availableIndexes []uint       // a place to store node indexes that we deleted, and are available
+	tags             tagSlab[T]
+	tagStorage       tagStore[T]
+
+	// kept up to date by add and Delete, for Stats
+	tagCount      int
+	prefixLengths [_treeNodeV6MaxPrefixLength + 1]int // tagged nodes, by the length of their full prefix
+}
+
+// NewTreeV6 returns a new Tree[T]
+func NewTreeV6[T any]() *TreeV6[T] {
+	return &TreeV6[T]{
+		nodes:            make([]treeNodeV6, 2, 2), // index 0 is skipped, 1 is root
+		availableIndexes: make([]uint, 0),
+	}
+}
+
+// Clone creates an identical copy of the tree
+// - Note: the items in the tree are not deep copied
+func (t *TreeV6[T]) Clone() *TreeV6[T] {
+	ret := &TreeV6[T]{
+		nodes:            make([]treeNodeV6, len(t.nodes), cap(t.nodes)),
+		availableIndexes: make([]uint, len(t.availableIndexes), cap(t.availableIndexes)),
+		tags:             t.tags.clone(),
+		tagStorage:       t.tagStorage.clone(),
+		tagCount:         t.tagCount,
+		prefixLengths:    t.prefixLengths,
+	}
+
+	for i := range t.nodes {
+		ret.nodes[i] = t.nodes[i]
+	}
+	for i := range t.availableIndexes {
+		ret.availableIndexes[i] = t.availableIndexes[i]
+	}
+	return ret
+}
+
+// add a tag to the node at the input index, storing it in the first position if 'replaceFirst' is true
+// - if matchFunc is non-nil, will enforce uniqueness at this node
+// - returns whether the tag count was increased
+// - returns an error, leaving the node as it was, if there's no room left to keep the tag
+func (t *TreeV6[T]) addTag(tag T, nodeIndex uint, matchFunc MatchesFunc[T], replaceFirst bool) (bool, error) {
+	node := &t.nodes[nodeIndex]
+	if replaceFirst && node.TagCount > 0 {
+		stored, err := t.tagStorage.store(tag)
+		if err != nil {
+			return false, err
+		}
+		t.tags.slots[node.tags.offset] = stored
+		return false, nil
+	}
+
+	if matchFunc != nil && !replaceFirst {
+		// need to check if this value already exists
+		for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+			if matchFunc(t.tagStorage.load(stored), tag) {
+				return false, nil
+			}
+		}
+	}
+
+	stored, err := t.tagStorage.store(tag)
+	if err != nil {
+		return false, err
+	}
+	if node.TagCount == int(node.tags.capacity) {
+		// out of room - move the tags to a block twice the size
+		block, err := t.tags.alloc(node.TagCount + 1)
+		if err != nil {
+			return false, err
+		}
+		copy(t.tags.slots[block.offset:], t.tags.tags(node.tags, node.TagCount))
+		t.tags.release(node.tags)
+		node.tags = block
+	}
+	t.tags.slots[int(node.tags.offset)+node.TagCount] = stored
+	node.TagCount++
+	return true, nil
+}
+
+func (t *TreeV6[T]) tagsForNode(nodeIndex uint) []T {
+	node := &t.nodes[nodeIndex]
+	ret := make([]T, node.TagCount)
+	for i, stored := range t.tags.tags(node.tags, node.TagCount) {
+		ret[i] = t.tagStorage.load(stored)
+	}
+	return ret
+}
+
+// appendTagsForNode appends the node's tags to ret, returning the extended slice
+func (t *TreeV6[T]) appendTagsForNode(ret []T, nodeIndex uint) []T {
+	node := &t.nodes[nodeIndex]
+	for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+		ret = append(ret, t.tagStorage.load(stored))
+	}
+	return ret
+}
+
+// visitTagsForNode calls visitFunc with each of the node's tags, returning false if visitFunc did
+func (t *TreeV6[T]) visitTagsForNode(nodeIndex uint, visitFunc func(tag T) bool) bool {
+	node := &t.nodes[nodeIndex]
+	for _, stored := range t.tags.tags(node.tags, node.TagCount) {
+		if !visitFunc(t.tagStorage.load(stored)) {
+			return false
+		}
+	}
+	return true
+}
+
+// moveTags moves the tags of one node to another, which must have none
+// - the other node takes over the block, so the tags aren't copied, and nothing needs to be allocated
+func (t *TreeV6[T]) moveTags(fromIndex uint, toIndex uint) {
+	from := &t.nodes[fromIndex]
+	to := &t.nodes[toIndex]
+	to.tags = from.tags
+	to.TagCount = from.TagCount
+	from.tags = tagBlock{}
+	from.TagCount = 0
+}
+
+func (t *TreeV6[T]) firstTagForNode(nodeIndex uint) T {
+	return t.tagStorage.load(t.tags.slots[t.nodes[nodeIndex].tags.offset])
+}
+
+// delete tags at the input node, returning how many were deleted, and how many are left
+// - the tags that are kept are moved down in place, and the node's block is freed if none are left
+func (t *TreeV6[T]) deleteTag(nodeIndex uint, matchTag T, matchFunc MatchesFunc[T]) (int, int) {
+	node := &t.nodes[nodeIndex]
+	tags := t.tags.tags(node.tags, node.TagCount)
+	keepCount := 0
+	for _, stored := range tags {
+		if !matchFunc(t.tagStorage.load(stored), matchTag) {
+			// doesn't match - get to keep it
+			tags[keepCount] = stored
+			keepCount++
+		}
+	}
+	deleteCount := node.TagCount - keepCount
+
+	node.TagCount = keepCount
+	if keepCount == 0 {
+		t.tags.release(node.tags)
+		node.tags = tagBlock{}
+	} else {
+		clear(tags[keepCount:])
+	}
+	return deleteCount, keepCount
+}
+
+// Set the single value for a node - overwrites what's there
+// Returns whether the tag count at this address was increased, and how many tags at this address
+// - returns an error, leaving the tree as it was, if there's no room left to keep the tag
+func (t *TreeV6[T]) Set(address patricia.IPv6Address, tag T) (bool, int, error) {
+	return t.add(address, tag, nil, true)
+}
+
+// Add adds a tag to the tree
+// - if matchFunc is non-nil, it will be used to ensure uniqueness at this node
+// - returns whether the tag count at this address was increased, and how many tags at this address
+// - returns an error, leaving the tree as it was, if there's no room left to keep the tag
+func (t *TreeV6[T]) Add(address patricia.IPv6Address, tag T, matchFunc MatchesFunc[T]) (bool, int, error) {
+	return t.add(address, tag, matchFunc, false)
+}
+
+// add a tag to the tree, optionally as the single value
+// - overwrites the first value in the list if 'replaceFirst' is true
+// - returns whether the tag count was increased, and the number of tags at this address
+func (t *TreeV6[T]) add(address patricia.IPv6Address, tag T, matchFunc MatchesFunc[T], replaceFirst bool) (bool, int, error) {
+	prefixLength := address.Length
+	countIncreased, tagCount, err := t.insert(address, tag, matchFunc, replaceFirst)
+	if countIncreased {
+		t.tagCount++
+		if tagCount == 1 {
+			t.countPrefix(prefixLength, 1)
+		}
+	}
+	return countIncreased, tagCount, err
+}
+
+// insert adds the tag to the tree, without updating the counters kept for Stats
+// - new nodes are only linked into the tree once the tag has been added to them, so if that fails, they're just made
+// available again
+func (t *TreeV6[T]) insert(address patricia.IPv6Address, tag T, matchFunc MatchesFunc[T], replaceFirst bool) (bool, int, error) {
+	// make sure we have more than enough capacity before we start adding to the tree, which invalidates pointers into the array
+	if (len(t.availableIndexes) + cap(t.nodes)) < (len(t.nodes) + 10) {
+		temp := make([]treeNodeV6, len(t.nodes), (cap(t.nodes)+1)*2)
+		copy(temp, t.nodes)
+		t.nodes = temp
+	}
+
+	root := &t.nodes[1]
+
+	// handle root tags
+	if address.Length == 0 {
+		countIncreased, err := t.addTag(tag, 1, matchFunc, replaceFirst)
+		return countIncreased, t.nodes[1].TagCount, err
+	}
+
+	// root node doesn't have any prefix, so find the starting point
+	nodeIndex := uint(0)
+	parent := root
+	if !address.IsLeftBitSet() {
+		if root.Left == 0 {
+			newNodeIndex := t.newNode(address, address.Length)
+			countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			if err != nil {
+				t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+				return false, 0, err
+			}
+			root.Left = newNodeIndex
+			return countIncreased, t.nodes[newNodeIndex].TagCount, nil
+		}
+		nodeIndex = root.Left
+	} else {
+		if root.Right == 0 {
+			newNodeIndex := t.newNode(address, address.Length)
+			countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			if err != nil {
+				t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+				return false, 0, err
+			}
+			root.Right = newNodeIndex
+			return countIncreased, t.nodes[newNodeIndex].TagCount, nil
+		}
+		nodeIndex = root.Right
+	}
+
+	for {
+		if nodeIndex == 0 {
+			panic("Trying to traverse nodeIndex=0")
+		}
+		node := &t.nodes[nodeIndex]
+		if node.prefixLength == 0 {
+			panic("Reached a node with no prefix")
+		}
+
+		matchCount := uint(node.MatchCount(address))
+		if matchCount == 0 {
+			panic(fmt.Sprintf("Should not have traversed to a node with no prefix match - node prefix length: %d; address prefix length: %d", node.prefixLength, address.Length))
+		}
+
+		if matchCount == address.Length {
+			// all the bits in the address matched
+
+			if matchCount == node.prefixLength {
+				// the whole prefix matched - we're done!
+				countIncreased, err := t.addTag(tag, nodeIndex, matchFunc, replaceFirst)
+				return countIncreased, t.nodes[nodeIndex].TagCount, err
+			}
+
+			// the input address is shorter than the match found - need to create a new, intermediate parent
+			newNodeIndex := t.newNode(address, address.Length)
+			newNode := &t.nodes[newNodeIndex]
+			countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+			if err != nil {
+				t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+				return false, 0, err
+			}
+
+			// the existing node loses those matching bits, and becomes a child of the new node
+
+			// shift
+			node.ShiftPrefix(matchCount)
+
+			if !node.IsLeftBitSet() {
+				newNode.Left = nodeIndex
+			} else {
+				newNode.Right = nodeIndex
+			}
+
+			// now give this new node a home
+			if parent.Left == nodeIndex {
+				parent.Left = newNodeIndex
+			} else {
+				if parent.Right != nodeIndex {
+					panic("node isn't left or right parent - should be impossible! (1)")
+				}
+				parent.Right = newNodeIndex
+			}
+			return countIncreased, t.nodes[newNodeIndex].TagCount, nil
+		}
+
+		if matchCount == node.prefixLength {
+			// partial match - we have to keep traversing
+
+			// chop off what's matched so far
+			address.ShiftLeft(matchCount)
+
+			if !address.IsLeftBitSet() {
+				if node.Left == 0 {
+					// nowhere else to go - create a new node here
+					newNodeIndex := t.newNode(address, address.Length)
+					countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+					if err != nil {
+						t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+						return false, 0, err
+					}
+					node.Left = newNodeIndex
+					return countIncreased, t.nodes[newNodeIndex].TagCount, nil
+				}
+
+				// there's a node to the left - traverse it
+				parent = node
+				nodeIndex = node.Left
+				continue
+			}
+
+			// node didn't belong on the left, so it belongs on the right
+			if node.Right == 0 {
+				// nowhere else to go - create a new node here
+				newNodeIndex := t.newNode(address, address.Length)
+				countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+				if err != nil {
+					t.availableIndexes = append(t.availableIndexes, newNodeIndex)
+					return false, 0, err
+				}
+				node.Right = newNodeIndex
+				return countIncreased, t.nodes[newNodeIndex].TagCount, nil
+			}
+
+			// there's a node to the right - traverse it
+			parent = node
+			nodeIndex = node.Right
+			continue
+		}
+
+		// partial match with this node - need to split this node
+		newCommonParentNodeIndex := t.newNode(address, matchCount)
+		newCommonParentNode := &t.nodes[newCommonParentNodeIndex]
+
+		// shift
+		address.ShiftLeft(matchCount)
+
+		newNodeIndex := t.newNode(address, address.Length)
+		countIncreased, err := t.addTag(tag, newNodeIndex, matchFunc, replaceFirst)
+		if err != nil {
+			t.availableIndexes = append(t.availableIndexes, newCommonParentNodeIndex, newNodeIndex)
+			return false, 0, err
+		}
+
+		// see where the existing node fits - left or right
+		node.ShiftPrefix(matchCount)
+		if !node.IsLeftBitSet() {
+			newCommonParentNode.Left = nodeIndex
+			newCommonParentNode.Right = newNodeIndex
+		} else {
+			newCommonParentNode.Right = nodeIndex
+			newCommonParentNode.Left = newNodeIndex
+		}
+
+		// now determine where the new node belongs
+		if parent.Left == nodeIndex {
+			parent.Left = newCommonParentNodeIndex
+		} else {
+			if parent.Right != nodeIndex {
+				panic("node isn't left or right parent - should be impossible! (2)")
+			}
+			parent.Right = newCommonParentNodeIndex
+		}
+		return countIncreased, t.nodes[newNodeIndex].TagCount, nil
+	}
+}
+
+// Delete a tag from the tree if it matches matchVal, as determined by matchFunc. Returns how many tags are removed
+func (t *TreeV6[T]) Delete(address patricia.IPv6Address, matchFunc MatchesFunc[T], matchVal T) (int, error) {
+	prefixLength := address.Length
+
+	// traverse the tree, finding the node and its parent
+	root := &t.nodes[1]
+	var parentIndex uint
+	var parent *treeNodeV6
+	var targetNode *treeNodeV6
+	var targetNodeIndex uint
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		targetNode = root
+		targetNodeIndex = 1
+	} else {
+		nodeIndex := uint(0)
+
+		parentIndex = 1
+		parent = root
+		if !address.IsLeftBitSet() {
+			nodeIndex = root.Left
+		} else {
+			nodeIndex = root.Right
+		}
+
+		// traverse the tree
+		for {
+			if nodeIndex == 0 {
+				return 0, nil
+			}
+
+			node := &t.nodes[nodeIndex]
+			matchCount := node.MatchCount(address)
+			if matchCount < node.prefixLength {
+				// didn't match the entire node - we're done
+				return 0, nil
+			}
+
+			if matchCount == address.Length {
+				// exact match - we're done
+				targetNode = node
+				targetNodeIndex = nodeIndex
+				break
+			}
+
+			// there's still more address - keep traversing
+			parentIndex = nodeIndex
+			parent = node
+			address.ShiftLeft(matchCount)
+			if !address.IsLeftBitSet() {
+				nodeIndex = node.Left
+			} else {
+				nodeIndex = node.Right
+			}
+		}
+	}
+
+	if targetNode == nil || targetNode.TagCount == 0 {
+		// no tags found
+		return 0, nil
+	}
+
+	// delete matching tags
+	deleteCount, remainingTagCount := t.deleteTag(targetNodeIndex, matchVal, matchFunc)
+	t.tagCount -= deleteCount
+	if deleteCount > 0 && remainingTagCount == 0 {
+		t.countPrefix(prefixLength, -1)
+	}
+	if remainingTagCount > 0 {
+		// target node still has tags - we're not deleting it
+		return deleteCount, nil
+	}
+
+	if targetNodeIndex == 1 {
+		// can't delete the root node
+		return deleteCount, nil
+	}
+
+	// compact the tree, if possible
+	if targetNode.Left != 0 && targetNode.Right != 0 {
+		// target has two children - nothing we can do - not deleting the node
+		return deleteCount, nil
+	} else if targetNode.Left != 0 {
+		// target node only has only left child
+		if parent.Left == targetNodeIndex {
+			parent.Left = targetNode.Left
+		} else {
+			parent.Right = targetNode.Left
+		}
+
+		// need to update the child node prefix to include target node's
+		tmpNode := &t.nodes[targetNode.Left]
+		tmpNode.MergeFromNodes(targetNode, tmpNode)
+	} else if targetNode.Right != 0 {
+		// target node has only right child
+		if parent.Left == targetNodeIndex {
+			parent.Left = targetNode.Right
+		} else {
+			parent.Right = targetNode.Right
+		}
+
+		// need to update the child node prefix to include target node's
+		tmpNode := &t.nodes[targetNode.Right]
+		tmpNode.MergeFromNodes(targetNode, tmpNode)
+	} else {
+		// target node has no children - straight-up remove this node
+		if parent.Left == targetNodeIndex {
+			parent.Left = 0
+			if parentIndex > 1 && parent.TagCount == 0 && parent.Right != 0 {
+				// parent isn't root, has no tags, and there's a sibling - merge sibling into parent
+				siblingIndexToDelete := parent.Right
+				tmpNode := &t.nodes[siblingIndexToDelete]
+				parent.MergeFromNodes(parent, tmpNode)
+
+				// move tags
+				t.moveTags(siblingIndexToDelete, parentIndex)
+
+				// parent now gets target's sibling's children
+				parent.Left = t.nodes[siblingIndexToDelete].Left
+				parent.Right = t.nodes[siblingIndexToDelete].Right
+
+				t.availableIndexes = append(t.availableIndexes, siblingIndexToDelete)
+			}
+		} else {
+			parent.Right = 0
+			if parentIndex > 1 && parent.TagCount == 0 && parent.Left != 0 {
+				// parent isn't root, has no tags, and there's a sibling - merge sibling into parent
+				siblingIndexToDelete := parent.Left
+				tmpNode := &t.nodes[siblingIndexToDelete]
+				parent.MergeFromNodes(parent, tmpNode)
+
+				// move tags
+				t.moveTags(siblingIndexToDelete, parentIndex)
+
+				// parent now gets target's sibling's children
+				parent.Right = t.nodes[parent.Left].Right
+				parent.Left = t.nodes[parent.Left].Left
+
+				t.availableIndexes = append(t.availableIndexes, siblingIndexToDelete)
+			}
+		}
+	}
+
+	targetNode.Left = 0
+	targetNode.Right = 0
+	t.availableIndexes = append(t.availableIndexes, targetNodeIndex)
+	return deleteCount, nil
+}
+
+// FindTagsWithFilter finds all matching tags that passes the filter function
+func (t *TreeV6[T]) FindTagsWithFilter(address patricia.IPv6Address, filterFunc FilterFunc[T]) ([]T, error) {
+	if filterFunc == nil {
+		return t.FindTags(address)
+	}
+	return t.FindTagsWithFilterAppend(make([]T, 0), address, filterFunc), nil
+}
+
+// FindTags finds all matching tags that passes the filter function
+func (t *TreeV6[T]) FindTags(address patricia.IPv6Address) ([]T, error) {
+	return t.FindTagsAppend(make([]T, 0), address), nil
+}
+
+// FindTagsAppend appends all matching tags to dst, returning the extended slice
+// - doesn't allocate, as long as dst has the capacity for the tags found
+func (t *TreeV6[T]) FindTagsAppend(dst []T, address patricia.IPv6Address) []T {
+	root := &t.nodes[1]
+	if root.TagCount > 0 {
+		dst = t.appendTagsForNode(dst, 1)
+	}
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		return dst
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return dst
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			return dst
+		}
+
+		// matched the full node - get its tags, then chop off the bits we've already matched and continue
+		if node.TagCount > 0 {
+			dst = t.appendTagsForNode(dst, nodeIndex)
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return dst
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindTagsWithFilterAppend appends all matching tags that pass the filter function to dst, returning the extended slice
+// - doesn't allocate, as long as dst has the capacity for the tags found
+func (t *TreeV6[T]) FindTagsWithFilterAppend(dst []T, address patricia.IPv6Address, filterFunc FilterFunc[T]) []T {
+	if filterFunc == nil {
+		return t.FindTagsAppend(dst, address)
+	}
+
+	t.VisitTags(address, func(tag T) bool {
+		if filterFunc(tag) {
+			dst = append(dst, tag)
+		}
+		return true
+	})
+	return dst
+}
+
+// VisitTags calls visitFunc with each matching tag, in the same order as FindTags, without allocating
+// - visitFunc returns false to stop early
+func (t *TreeV6[T]) VisitTags(address patricia.IPv6Address, visitFunc func(tag T) bool) {
+	root := &t.nodes[1]
+	if !t.visitTagsForNode(1, visitFunc) {
+		return
+	}
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		return
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			return
+		}
+
+		// matched the full node - visit its tags, then chop off the bits we've already matched and continue
+		if !t.visitTagsForNode(nodeIndex, visitFunc) {
+			return
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindDeepestTag finds a tag at the deepest level in the tree, representing the closest match
+// - if that target node has multiple tags, the first in the list is returned
+func (t *TreeV6[T]) FindDeepestTag(address patricia.IPv6Address) (bool, T, error) {
+	root := &t.nodes[1]
+	var found bool
+	var ret T
+
+	if root.TagCount > 0 {
+		ret = t.firstTagForNode(1)
+		found = true
+	}
+
+	if address.Length == 0 {
+		// caller just looking for root tags
+		return found, ret, nil
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return found, ret, nil
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			return found, ret, nil
+		}
+
+		// matched the full node - get its tags, then chop off the bits we've already matched and continue
+		if node.TagCount > 0 {
+			ret = t.firstTagForNode(nodeIndex)
+			found = true
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return found, ret, nil
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+// FindDeepestMatch finds the deepest tagged prefix in the tree that contains the input address, representing the closest match
+// - returns the full matched prefix, all of the tags at that prefix, and whether a match was found
+func (t *TreeV6[T]) FindDeepestMatch(address patricia.IPv6Address) (patricia.IPv6Address, []T, bool) {
+	root := &t.nodes[1]
+	var matchIndex uint
+	var matchAddress patricia.IPv6Address
+	var nodeAddress patricia.IPv6Address
+
+	if root.TagCount > 0 {
+		matchIndex = 1
+	}
+
+	var nodeIndex uint
+	if address.Length > 0 {
+		if !address.IsLeftBitSet() {
+			nodeIndex = root.Left
+		} else {
+			nodeIndex = root.Right
+		}
+	}
+
+	// traverse the tree
+	for nodeIndex != 0 {
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - we're done
+			break
+		}
+
+		// matched the full node - remember it if it has tags, then chop off the bits we've already matched and continue
+		nodeAddress = node.AppendPrefix(nodeAddress)
+		if node.TagCount > 0 {
+			matchIndex = nodeIndex
+			matchAddress = nodeAddress
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			break
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+
+	if matchIndex == 0 {
+		return matchAddress, nil, false
+	}
+	return matchAddress, t.tagsForNode(matchIndex), true
+}
+
+// GetExact returns the tags stored at exactly the input address, ignoring the tags of any prefixes that cover it
+// - returns false if the address itself has no tags
+func (t *TreeV6[T]) GetExact(address patricia.IPv6Address) ([]T, bool) {
+	nodeIndex := t.findExactNode(address)
+	if nodeIndex == 0 || t.nodes[nodeIndex].TagCount == 0 {
+		return nil, false
+	}
+	return t.tagsForNode(nodeIndex), true
+}
+
+// HasExact returns whether the input address itself has tags, ignoring the tags of any prefixes that cover it
+func (t *TreeV6[T]) HasExact(address patricia.IPv6Address) bool {
+	nodeIndex := t.findExactNode(address)
+	return nodeIndex != 0 && t.nodes[nodeIndex].TagCount > 0
+}
+
+// find the node whose full prefix is exactly the input address, returning its index, or 0 if there isn't one
+func (t *TreeV6[T]) findExactNode(address patricia.IPv6Address) uint {
+	root := &t.nodes[1]
+	if address.Length == 0 {
+		return 1
+	}
+
+	var nodeIndex uint
+	if !address.IsLeftBitSet() {
+		nodeIndex = root.Left
+	} else {
+		nodeIndex = root.Right
+	}
+
+	// traverse the tree
+	for {
+		if nodeIndex == 0 {
+			return 0
+		}
+		node := &t.nodes[nodeIndex]
+
+		matchCount := node.MatchCount(address)
+		if matchCount < node.prefixLength {
+			// didn't match the entire node - there's no exact match
+			return 0
+		}
+
+		if matchCount == address.Length {
+			// exact match - we're done
+			return nodeIndex
+		}
+
+		// there's still more address - keep traversing
+		address.ShiftLeft(matchCount)
+		if !address.IsLeftBitSet() {
+			nodeIndex = node.Left
+		} else {
+			nodeIndex = node.Right
+		}
+	}
+}
+
+func (t *TreeV6[T]) countNodes(nodeIndex uint) int {
+	nodeCount := 1
+
+	node := &t.nodes[nodeIndex]
+	if node.Left != 0 {
+		nodeCount += t.countNodes(node.Left)
+	}
+	if node.Right != 0 {
+		nodeCount += t.countNodes(node.Right)
+	}
+	return nodeCount
+}
+
+func (t *TreeV6[T]) countTags(nodeIndex uint) int {
+	node := &t.nodes[nodeIndex]
+
+	tagCount := node.TagCount
+	if node.Left != 0 {
+		tagCount += t.countTags(node.Left)
+	}
+	if node.Right != 0 {
+		tagCount += t.countTags(node.Right)
+	}
+	return tagCount
+}
@@ -0,0 +1,151 @@
+package generic
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/kentik/patricia"
+)
+
+// SyncTreeV6 is an IPv4 tree that's safe for concurrent use
+// - readers query the currently published tree without locking
+// - writers apply their changes to a clone of the current tree, then publish it atomically
+// - readers never see a partially-applied change
+// - each write clones the whole tree, so batch changes with Update
+type SyncTreeV6[T any] struct {
+	tree      atomic.Pointer[TreeV6[T]]
+	writeLock sync.Mutex // serializes writers
+}
+
+// NewSyncTreeV6 returns a new, empty, concurrency-safe tree
+func NewSyncTreeV6[T any]() *SyncTreeV6[T] {
+	return NewSyncTreeV6From[T](NewTreeV6[T]())
+}
+
+// NewSyncTreeV6From returns a concurrency-safe tree, publishing the input tree
+// - the input tree must not be modified afterwards
+func NewSyncTreeV6From[T any](tree *TreeV6[T]) *SyncTreeV6[T] {
+	ret := &SyncTreeV6[T]{}
+	ret.tree.Store(tree)
+	return ret
+}
+
+// Load returns the currently published tree, for running several queries against the same version
+// - the returned tree must not be modified
+func (t *SyncTreeV6[T]) Load() *TreeV6[T] {
+	return t.tree.Load()
+}
+
+// Update applies updateFunc to a clone of the current tree, then publishes the clone
+// - if updateFunc returns an error, nothing is published, and the error is returned
+// - writers are serialized with each other, but never block readers
+func (t *SyncTreeV6[T]) Update(updateFunc func(tree *TreeV6[T]) error) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+
+	clone := t.tree.Load().Clone()
+	if err := updateFunc(clone); err != nil {
+		return err
+	}
+	t.tree.Store(clone)
+	return nil
+}
+
+// Replace publishes the input tree in place of the current one
+// - the input tree must not be modified afterwards
+func (t *SyncTreeV6[T]) Replace(tree *TreeV6[T]) {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	t.tree.Store(tree)
+}
+
+// Set the single value for a node - overwrites what's there, the same as (*TreeV6[T]).Set
+func (t *SyncTreeV6[T]) Set(address patricia.IPv6Address, tag T) (bool, int, error) {
+	var countIncreased bool
+	var count int
+	err := t.Update(func(tree *TreeV6[T]) error {
+		var err error
+		countIncreased, count, err = tree.Set(address, tag)
+		return err
+	})
+	return countIncreased, count, err
+}
+
+// Add adds a tag to the tree, the same as (*TreeV6[T]).Add
+func (t *SyncTreeV6[T]) Add(address patricia.IPv6Address, tag T, matchFunc MatchesFunc[T]) (bool, int, error) {
+	var countIncreased bool
+	var count int
+	err := t.Update(func(tree *TreeV6[T]) error {
+		var err error
+		countIncreased, count, err = tree.Add(address, tag, matchFunc)
+		return err
+	})
+	return countIncreased, count, err
+}
+
+// Delete a tag from the tree if it matches matchVal, the same as (*TreeV6[T]).Delete
+func (t *SyncTreeV6[T]) Delete(address patricia.IPv6Address, matchFunc MatchesFunc[T], matchVal T) (int, error) {
+	var deleteCount int
+	err := t.Update(func(tree *TreeV6[T]) error {
+		var err error
+		deleteCount, err = tree.Delete(address, matchFunc, matchVal)
+		return err
+	})
+	return deleteCount, err
+}
+
+// Stats returns the size of the currently published tree, the same as (*TreeV6[T]).Stats
+func (t *SyncTreeV6[T]) Stats() TreeStats {
+	return t.tree.Load().Stats()
+}
+
+// DepthStats returns how deep the currently published tree's tagged nodes are, the same as (*TreeV6[T]).DepthStats
+func (t *SyncTreeV6[T]) DepthStats() DepthStats {
+	return t.tree.Load().DepthStats()
+}
+
+// FindTags finds all matching tags, the same as (*TreeV6[T]).FindTags
+func (t *SyncTreeV6[T]) FindTags(address patricia.IPv6Address) ([]T, error) {
+	return t.tree.Load().FindTags(address)
+}
+
+// FindTagsWithFilter finds all matching tags that passes the filter function, the same as (*TreeV6[T]).FindTagsWithFilter
+func (t *SyncTreeV6[T]) FindTagsWithFilter(address patricia.IPv6Address, filterFunc FilterFunc[T]) ([]T, error) {
+	return t.tree.Load().FindTagsWithFilter(address, filterFunc)
+}
+
+// FindTagsAppend appends all matching tags to dst, the same as (*TreeV6[T]).FindTagsAppend
+func (t *SyncTreeV6[T]) FindTagsAppend(dst []T, address patricia.IPv6Address) []T {
+	return t.tree.Load().FindTagsAppend(dst, address)
+}
+
+// FindTagsWithFilterAppend appends all matching tags that pass the filter function to dst, the same as
+// (*TreeV6[T]).FindTagsWithFilterAppend
+func (t *SyncTreeV6[T]) FindTagsWithFilterAppend(dst []T, address patricia.IPv6Address, filterFunc FilterFunc[T]) []T {
+	return t.tree.Load().FindTagsWithFilterAppend(dst, address, filterFunc)
+}
+
+// VisitTags calls visitFunc with each matching tag, the same as (*TreeV6[T]).VisitTags
+func (t *SyncTreeV6[T]) VisitTags(address patricia.IPv6Address, visitFunc func(tag T) bool) {
+	t.tree.Load().VisitTags(address, visitFunc)
+}
+
+// FindDeepestTag finds a tag at the deepest level in the tree, the same as (*TreeV6[T]).FindDeepestTag
+func (t *SyncTreeV6[T]) FindDeepestTag(address patricia.IPv6Address) (bool, T, error) {
+	return t.tree.Load().FindDeepestTag(address)
+}
+
+// FindDeepestMatch finds the deepest tagged prefix that contains the input address, the same as (*TreeV6[T]).FindDeepestMatch
+func (t *SyncTreeV6[T]) FindDeepestMatch(address patricia.IPv6Address) (patricia.IPv6Address, []T, bool) {
+	return t.tree.Load().FindDeepestMatch(address)
+}
+
+// GetExact returns the tags stored at exactly the input address, the same as (*TreeV6[T]).GetExact
+func (t *SyncTreeV6[T]) GetExact(address patricia.IPv6Address) ([]T, bool) {
+	return t.tree.Load().GetExact(address)
+}
+
+// HasExact returns whether the input address itself has tags, the same as (*TreeV6[T]).HasExact
+func (t *SyncTreeV6[T]) HasExact(address patricia.IPv6Address) bool {
+	return t.tree.Load().HasExact(address)
+}
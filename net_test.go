@@ -72,6 +72,15 @@ func TestParseIPFromString(t *testing.T) {
 	v4IP, v6IP, err = ParseIPFromString("2001:0db8:85a3:0000:0000:8a2e:0370:7334/129")
 	assert.Error(t, err)
 
+	// IPv4-mapped prefixes of at least /96 are IPv6, where they used to be IPv4 with their IPv6 length
+	v4IP, v6IP, err = ParseIPFromString("::ffff:1.2.3.4/120")
+	assert.NoError(t, err)
+	assert.Nil(t, v4IP)
+	assert.NotNil(t, v6IP)
+	assert.Equal(t, uint(120), v6IP.Length)
+	assert.Equal(t, uint64(0), v6IP.Left)
+	assert.Equal(t, uint64(0x0000ffff01020300), v6IP.Right)
+
 	v4IP, v6IP, err = ParseIPFromString("2001:0db8:85a3:0000:0000:8a2e:0370:7334/16")
 	assert.NoError(t, err)
 	assert.Nil(t, v4IP)
@@ -0,0 +1,538 @@
+package patricia
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// errors returned by the parser, wrapped in a *ParseError
+var (
+	ErrInvalidAddress      = errors.New("invalid IP address")
+	ErrInvalidPrefixLength = errors.New("invalid prefix length")
+	ErrInvalidNetmask      = errors.New("invalid netmask")
+	ErrInvalidPort         = errors.New("invalid port")
+	ErrHostBitsSet         = errors.New("host bits set beyond the prefix length")
+	ErrInvalidRange        = errors.New("invalid address range")
+)
+
+// ParseError is returned when an address can't be parsed
+// - Err is one of the Err* values, for use with errors.Is
+type ParseError struct {
+	Input string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("couldn't parse %q: %s", e.Input, e.Err)
+}
+
+// Unwrap returns the underlying Err* value
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// MappedPolicy is how a Parser returns IPv4-mapped IPv6 addresses, such as ::ffff:198.51.100.7
+type MappedPolicy uint8
+
+const (
+	// MappedKeep returns them as IPv6 addresses
+	MappedKeep MappedPolicy = iota
+	// MappedUnmap returns them as IPv4 addresses
+	MappedUnmap
+	// MappedBoth returns them as both IPv4 and IPv6 addresses, to be looked up in both trees
+	MappedBoth
+)
+
+// ParsedIP is an IPv4 or IPv6 address parsed by a Parser
+// - IsV4 and IsV6 are both set for IPv4-mapped addresses parsed with MappedBoth
+type ParsedIP struct {
+	V4   IPv4Address
+	V6   IPv6Address
+	IsV4 bool   // whether the address is in V4
+	IsV6 bool   // whether the address is in V6
+	Port uint16 // port from the ip:port and [ip]:port forms - 0 if there wasn't one
+}
+
+// Parser parses IPv4 and IPv6 addresses without allocating
+// - accepts ip, ip/length, ipv4/dotted-netmask, ipv4:port, and [ipv6]:port
+// - a missing length defaults to the full 32 or 128 bits
+// - IPv4-mapped IPv6 addresses such as ::ffff:1.2.3.4 are returned as IPv6, unless Mapped says otherwise
+// - the zero value is ready to use
+type Parser struct {
+	// Strict rejects addresses with host bits set beyond the prefix length, rather than clearing them
+	Strict bool
+
+	// Mapped is how IPv4-mapped addresses and prefixes of at least /96 are returned
+	Mapped MappedPolicy
+
+	// Compatible applies the Mapped policy to the deprecated IPv4-compatible addresses, such as ::198.51.100.7, too
+	Compatible bool
+}
+
+// Parse parses the address
+func (p Parser) Parse(address string) (ParsedIP, error) {
+	return parseIP(address, p)
+}
+
+// ParseBytes parses the address from bytes, such as part of a log line
+func (p Parser) ParseBytes(address []byte) (ParsedIP, error) {
+	return parseIP(address, p)
+}
+
+// ParsePrefix converts the prefix, applying the parser's rules as if it had been parsed from a string
+func (p Parser) ParsePrefix(prefix netip.Prefix) (ParsedIP, error) {
+	var ret ParsedIP
+	if !prefix.IsValid() {
+		return ret, &ParseError{Input: prefix.String(), Err: ErrInvalidAddress}
+	}
+	if prefix.Addr().Is4() {
+		ret.IsV4 = true
+		ret.V4, _ = IPv4AddressFromPrefix(prefix)
+	} else {
+		ret.IsV6 = true
+		ret.V6, _ = IPv6AddressFromPrefix(prefix)
+	}
+	if p.Strict && prefix.Masked() != prefix {
+		return ret, &ParseError{Input: prefix.String(), Err: ErrHostBitsSet}
+	}
+	ret.V4, ret.V6 = ret.V4.masked(), ret.V6.masked()
+	p.applyMapped(&ret)
+	return ret, nil
+}
+
+// ParseAddr converts the address, applying the parser's rules as if it had been parsed from a string
+// - the zone, if any, is dropped
+func (p Parser) ParseAddr(addr netip.Addr) (ParsedIP, error) {
+	return p.ParsePrefix(netip.PrefixFrom(addr.WithZone(""), addr.BitLen()))
+}
+
+// applyMapped applies the mapped policy to an IPv6 address
+func (p Parser) applyMapped(parsed *ParsedIP) {
+	if !parsed.IsV6 || p.Mapped == MappedKeep {
+		return
+	}
+	v4, ok := parsed.V6.Unmap()
+	if !ok && p.Compatible {
+		v4, ok = parsed.V6.UnmapCompatible()
+	}
+	if !ok {
+		return
+	}
+	parsed.V4, parsed.IsV4 = v4, true
+	if p.Mapped == MappedUnmap {
+		parsed.V6, parsed.IsV6 = IPv6Address{}, false
+	}
+}
+
+// ParsedRange is a range of IPv4 or IPv6 addresses parsed by a Parser
+// - IsV4 and IsV6 are both set for ranges of IPv4-mapped addresses parsed with MappedBoth
+type ParsedRange struct {
+	V4   IPv4AddressRange
+	V6   IPv6AddressRange
+	IsV4 bool // whether the range is in V4
+	IsV6 bool // whether the range is in V6
+}
+
+// ParseRange parses an address range
+// - accepts first-last, where each end is any address or prefix the parser accepts, without a port
+// - accepts IPv4 wildcards, such as 10.1.*.*, where only the trailing fields may be *
+// - accepts a single address or prefix, as the range it covers
+// - the range runs from the first address of the first end to the last address of the last end
+func (p Parser) ParseRange(address string) (ParsedRange, error) {
+	var ret ParsedRange
+	first, last := address, address
+	if dash := indexByte(address, 0, len(address), '-'); dash >= 0 {
+		first, last = address[:dash], address[dash+1:]
+	}
+
+	start, err := p.parseRangeEnd(first)
+	if err != nil {
+		return ret, err
+	}
+	end, err := p.parseRangeEnd(last)
+	if err != nil {
+		return ret, err
+	}
+
+	ret.IsV4 = start.IsV4 && end.IsV4
+	ret.IsV6 = start.IsV6 && end.IsV6
+	if ret.IsV4 {
+		if ret.V4, err = NewIPv4AddressRange(start.V4, end.V4); err != nil {
+			return ParsedRange{}, parseError(address, ErrInvalidRange)
+		}
+	}
+	if ret.IsV6 {
+		if ret.V6, err = NewIPv6AddressRange(start.V6, end.V6); err != nil {
+			return ParsedRange{}, parseError(address, ErrInvalidRange)
+		}
+	}
+	if !ret.IsV4 && !ret.IsV6 {
+		// the ends are of different families
+		return ret, parseError(address, ErrInvalidRange)
+	}
+	return ret, nil
+}
+
+// parseRangeEnd parses one end of a range, which may be an IPv4 wildcard
+func (p Parser) parseRangeEnd(address string) (ParsedIP, error) {
+	if indexByte(address, 0, len(address), '*') >= 0 {
+		v4, ok := parseWildcard(address)
+		if !ok {
+			return ParsedIP{}, parseError(address, ErrInvalidAddress)
+		}
+		return ParsedIP{V4: v4, IsV4: true}, nil
+	}
+
+	parsed, err := p.Parse(address)
+	if err != nil {
+		return parsed, err
+	}
+	// ports aren't part of a range - ipv4:port has a single colon, and [ipv6]:port doesn't end with the bracket
+	colon := indexByte(address, 0, len(address), ':')
+	if colon >= 0 && (indexByte(address, colon+1, len(address), ':') < 0 || address[0] == '[' && address[len(address)-1] != ']') {
+		return parsed, parseError(address, ErrInvalidRange)
+	}
+	return parsed, nil
+}
+
+// ParseRange parses the address range with the default Parser
+func ParseRange(address string) (ParsedRange, error) {
+	return Parser{}.ParseRange(address)
+}
+
+// ParseIP parses the address with the default Parser
+func ParseIP(address string) (ParsedIP, error) {
+	return parseIP(address, Parser{})
+}
+
+// ParseIPBytes parses the address from bytes with the default Parser
+func ParseIPBytes(address []byte) (ParsedIP, error) {
+	return parseIP(address, Parser{})
+}
+
+type byteString interface {
+	~string | ~[]byte
+}
+
+func parseIP[T byteString](s T, p Parser) (ParsedIP, error) {
+	ret, err := parseIPUnmasked(s)
+	if err != nil {
+		return ret, err
+	}
+
+	// clear, or reject, the host bits
+	if ret.IsV4 {
+		masked := ret.V4.masked()
+		if p.Strict && masked != ret.V4 {
+			return ret, parseError(s, ErrHostBitsSet)
+		}
+		ret.V4 = masked
+	} else {
+		masked := ret.V6.masked()
+		if p.Strict && masked != ret.V6 {
+			return ret, parseError(s, ErrHostBitsSet)
+		}
+		ret.V6 = masked
+	}
+	p.applyMapped(&ret)
+	return ret, nil
+}
+
+// parseIPUnmasked parses the address, keeping any host bits set beyond the prefix length
+func parseIPUnmasked[T byteString](s T) (ParsedIP, error) {
+	var ret ParsedIP
+	end := len(s)
+	if end == 0 {
+		return ret, parseError(s, ErrInvalidAddress)
+	}
+
+	// find where the address ends, and what follows it
+	start := 0
+	suffix := -1 // index of the prefix length or netmask, after the '/'
+	port := -1   // index of the port, after the ':'
+	if s[0] == '[' {
+		close := indexByte(s, 0, len(s), ']')
+		if close < 0 || indexByte(s, 1, close, ':') < 0 {
+			// brackets are only for IPv6
+			return ret, parseError(s, ErrInvalidAddress)
+		}
+		if close+1 < len(s) {
+			if s[close+1] != ':' {
+				return ret, parseError(s, ErrInvalidAddress)
+			}
+			port = close + 2
+		}
+		start, end = 1, close
+	} else if slash := indexByte(s, 0, len(s), '/'); slash >= 0 {
+		end, suffix = slash, slash+1
+	} else if colon := indexByte(s, 0, len(s), ':'); colon >= 0 && indexByte(s, colon+1, len(s), ':') < 0 {
+		// a single colon - an IPv4 address and port
+		end, port = colon, colon+1
+	}
+
+	if indexByte(s, start, end, ':') >= 0 {
+		var bytes [16]byte
+		if !parseIPv6(s, start, end, &bytes) {
+			return ret, parseError(s, ErrInvalidAddress)
+		}
+		ret.IsV6 = true
+		ret.V6 = NewIPv6Address(bytes[:], 128)
+	} else {
+		var bytes [4]byte
+		if !parseIPv4(s, start, end, bytes[:]) {
+			return ret, parseError(s, ErrInvalidAddress)
+		}
+		ret.IsV4 = true
+		ret.V4 = NewIPv4AddressFromBytes(bytes[:], 32)
+	}
+
+	if port >= 0 {
+		value, ok := parseDecimal(s, port, len(s), 65535)
+		if !ok {
+			return ret, parseError(s, ErrInvalidPort)
+		}
+		ret.Port = uint16(value)
+	}
+
+	if suffix >= 0 {
+		if ret.IsV4 && indexByte(s, suffix, len(s), '.') >= 0 {
+			var mask [4]byte
+			if !parseIPv4(s, suffix, len(s), mask[:]) {
+				return ret, parseError(s, ErrInvalidNetmask)
+			}
+			length, ok := netmaskLength(NewIPv4AddressFromBytes(mask[:], 32).Address)
+			if !ok {
+				return ret, parseError(s, ErrInvalidNetmask)
+			}
+			ret.V4.Length = length
+		} else {
+			maxLength := uint(32)
+			if ret.IsV6 {
+				maxLength = 128
+			}
+			length, ok := parseDecimal(s, suffix, len(s), maxLength)
+			if !ok {
+				return ret, parseError(s, ErrInvalidPrefixLength)
+			}
+			ret.V4.Length = length
+			ret.V6.Length = length
+		}
+	}
+
+	// the length is set on both, but only one family was parsed
+	if ret.IsV4 {
+		ret.V6 = IPv6Address{}
+	} else {
+		ret.V4 = IPv4Address{}
+	}
+	return ret, nil
+}
+
+func parseError[T byteString](s T, err error) error {
+	return &ParseError{Input: string(s), Err: err}
+}
+
+// indexByte returns the index of the first c in s[start:end], or -1
+func indexByte[T byteString](s T, start int, end int, c byte) int {
+	for i := start; i < end; i++ {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseDecimal parses s[start:end] as a decimal number no greater than maxValue
+// - leading zeros are allowed, as they were by ParseIPFromString
+func parseDecimal[T byteString](s T, start int, end int, maxValue uint) (uint, bool) {
+	if start >= end {
+		return 0, false
+	}
+	value := uint(0)
+	for i := start; i < end; i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		value = value*10 + uint(c-'0')
+		if value > maxValue {
+			return 0, false
+		}
+	}
+	return value, true
+}
+
+// parseIPv4 parses s[start:end] as a dotted-decimal IPv4 address into the 4 bytes of ip
+// - follows the rules of netip.ParseAddr: four fields of 0-255, without leading zeros
+func parseIPv4[T byteString](s T, start int, end int, ip []byte) bool {
+	value := 0
+	digits := 0
+	field := 0
+	for i := start; i < end; i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			if digits == 1 && value == 0 {
+				// leading zero
+				return false
+			}
+			value = value*10 + int(c-'0')
+			digits++
+			if value > 255 {
+				return false
+			}
+		} else if c == '.' {
+			if digits == 0 || field == 3 {
+				return false
+			}
+			ip[field] = byte(value)
+			field++
+			value = 0
+			digits = 0
+		} else {
+			return false
+		}
+	}
+	if digits == 0 || field != 3 {
+		return false
+	}
+	ip[3] = byte(value)
+	return true
+}
+
+// parseIPv6 parses s[start:end] as an IPv6 address into ip
+// - follows the rules of netip.ParseAddr, except that zones aren't allowed
+func parseIPv6[T byteString](s T, start int, end int, ip *[16]byte) bool {
+	ellipsis := -1 // position of the ellipsis in ip
+	i := start
+
+	// leading ellipsis
+	if end-i >= 2 && s[i] == ':' && s[i+1] == ':' {
+		ellipsis = 0
+		i += 2
+		if i == end {
+			return true
+		}
+	}
+
+	filled := 0
+	for filled < 16 {
+		// hex group
+		digits := 0
+		value := 0
+		for ; i+digits < end; digits++ {
+			c := s[i+digits]
+			if c >= '0' && c <= '9' {
+				value = value<<4 + int(c-'0')
+			} else if c >= 'a' && c <= 'f' {
+				value = value<<4 + int(c-'a'+10)
+			} else if c >= 'A' && c <= 'F' {
+				value = value<<4 + int(c-'A'+10)
+			} else {
+				break
+			}
+			if digits > 3 {
+				return false
+			}
+		}
+		if digits == 0 {
+			return false
+		}
+
+		// embedded IPv4 in the last 32 bits
+		if i+digits < end && s[i+digits] == '.' {
+			if (ellipsis < 0 && filled != 12) || filled+4 > 16 {
+				return false
+			}
+			if !parseIPv4(s, i, end, ip[filled:filled+4]) {
+				return false
+			}
+			i = end
+			filled += 4
+			break
+		}
+
+		ip[filled] = byte(value >> 8)
+		ip[filled+1] = byte(value)
+		filled += 2
+		i += digits
+		if i == end {
+			break
+		}
+
+		// must be followed by a colon, and more
+		if s[i] != ':' || i+1 == end {
+			return false
+		}
+		i++
+		if s[i] == ':' {
+			if ellipsis >= 0 {
+				return false
+			}
+			ellipsis = filled
+			i++
+			if i == end {
+				break
+			}
+		}
+	}
+	if i != end {
+		return false
+	}
+
+	// expand the ellipsis, which must represent at least one group of zeros
+	if filled < 16 {
+		if ellipsis < 0 {
+			return false
+		}
+		n := 16 - filled
+		for j := filled - 1; j >= ellipsis; j-- {
+			ip[j+n] = ip[j]
+		}
+		clear(ip[ellipsis : ellipsis+n])
+	} else if ellipsis >= 0 {
+		return false
+	}
+	return true
+}
+
+// parseWildcard parses an IPv4 wildcard, such as 10.1.*.*, as the prefix it covers
+// - only the trailing fields may be *
+func parseWildcard(s string) (IPv4Address, bool) {
+	var ip [4]byte
+	length := uint(32)
+	field := 0
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] != '.' {
+			continue
+		}
+		if field == 4 {
+			return IPv4Address{}, false
+		}
+		if i-start == 1 && s[start] == '*' {
+			length = min(length, uint(field)*8)
+		} else {
+			value, ok := parseDecimal(s, start, i, 255)
+			if !ok || length < 32 {
+				return IPv4Address{}, false
+			}
+			ip[field] = byte(value)
+		}
+		field++
+		start = i + 1
+	}
+	if field != 4 {
+		return IPv4Address{}, false
+	}
+	return NewIPv4AddressFromBytes(ip[:], length), true
+}
+
+// netmaskLength returns the prefix length of a contiguous netmask
+func netmaskLength(mask uint32) (uint, bool) {
+	length := uint(0)
+	for length < 32 && mask&(1<<(31-length)) != 0 {
+		length++
+	}
+	return length, mask == _leftMasks32[length]
+}
@@ -0,0 +1,366 @@
+package patricia
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parseIPFromStringNet is the original, net.ParseCIDR-based ParseIPFromString, that ParseIP must agree with
+func parseIPFromStringNet(address string) (*IPv4Address, *IPv6Address, error) {
+	parts := strings.Split(address, "/")
+	cidr := -1
+	if len(parts) == 2 {
+		c, err := strconv.ParseUint(parts[1], 10, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c > 128 {
+			return nil, nil, fmt.Errorf("Invalid CIDR: %d", c)
+		}
+		cidr = int(c)
+	}
+
+	v4AddrStr := address
+	if cidr == -1 {
+		v4AddrStr = fmt.Sprintf("%s/32", address)
+	}
+	_, ipNet, err := net.ParseCIDR(v4AddrStr)
+	if err == nil {
+		if v4Addr := ipNet.IP.To4(); v4Addr != nil {
+			if cidr == -1 {
+				cidr = 32
+			}
+			ret := NewIPv4AddressFromBytes(v4Addr, uint(cidr))
+			return &ret, nil, nil
+		}
+	}
+
+	v6AddrStr := address
+	if cidr == -1 {
+		v6AddrStr = fmt.Sprintf("%s/128", address)
+	}
+	_, ipNet, err = net.ParseCIDR(v6AddrStr)
+	if err == nil {
+		if v6Addr := ipNet.IP.To16(); v6Addr != nil {
+			if cidr == -1 {
+				cidr = 128
+			}
+			ret := NewIPv6Address(v6Addr, uint(cidr))
+			return nil, &ret, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("couldn't parse either v4 or v6 address")
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		input  string
+		result string // formatted address, or error
+		port   uint16
+	}{
+		{"1.2.3.4", "1.2.3.4/32", 0},
+		{"1.2.3.4/24", "1.2.3.0/24", 0},
+		{"1.2.3.4/024", "1.2.3.0/24", 0},
+		{"1.2.3.4/0", "0.0.0.0/0", 0},
+		{"10.1.2.3/255.255.0.0", "10.1.0.0/16", 0},
+		{"10.1.2.3/0.0.0.0", "0.0.0.0/0", 0},
+		{"10.1.2.3/255.255.255.255", "10.1.2.3/32", 0},
+		{"10.1.2.3:8080", "10.1.2.3/32", 8080},
+		{"10.1.2.3:0", "10.1.2.3/32", 0},
+		{"::", "::/128", 0},
+		{"::1", "::1/128", 0},
+		{"2001:DB8::1/32", "2001:db8::/32", 0},
+		{"2001:db8:0:0:0:0:0:1", "2001:db8::1/128", 0},
+		{"::ffff:1.2.3.4", "::ffff:1.2.3.4/128", 0},
+		{"::ffff:1.2.3.4/120", "::ffff:1.2.3.0/120", 0},
+		{"64:ff9b::1.2.3.4", "64:ff9b::102:304/128", 0},
+		{"[2001:db8::1]:443", "2001:db8::1/128", 443},
+		{"[2001:db8::1]", "2001:db8::1/128", 0},
+		{"[::ffff:1.2.3.4]:65535", "::ffff:1.2.3.4/128", 65535},
+
+		{"", "invalid IP address", 0},
+		{"nope", "invalid IP address", 0},
+		{"1.2.3", "invalid IP address", 0},
+		{"1.2.3.4.5", "invalid IP address", 0},
+		{"1.2.3.256", "invalid IP address", 0},
+		{"1.2.3.04", "invalid IP address", 0},
+		{"1.2..4", "invalid IP address", 0},
+		{" 1.2.3.4", "invalid IP address", 0},
+		{"1.2.3.4/", "invalid prefix length", 0},
+		{"1.2.3.4/33", "invalid prefix length", 0},
+		{"1.2.3.4/-1", "invalid prefix length", 0},
+		{"1.2.3.4/8/8", "invalid prefix length", 0},
+		{"2001:db8::/129", "invalid prefix length", 0},
+		{"10.1.2.3/255.0.255.0", "invalid netmask", 0},
+		{"10.1.2.3/255.255.0", "invalid netmask", 0},
+		{"10.1.2.3:", "invalid port", 0},
+		{"10.1.2.3:65536", "invalid port", 0},
+		{"10.1.2.3:http", "invalid port", 0},
+		{"[2001:db8::1]:", "invalid port", 0},
+		{"[2001:db8::1]x", "invalid IP address", 0},
+		{"[2001:db8::1", "invalid IP address", 0},
+		{"[1.2.3.4]:80", "invalid IP address", 0},
+		{"fe80::1%eth0", "invalid IP address", 0},
+		{":::", "invalid IP address", 0},
+		{"1:::2", "invalid IP address", 0},
+		{"1::2::3", "invalid IP address", 0},
+		{"1:2:3:4:5:6:7:8:9", "invalid IP address", 0},
+		{"1:2:3:4:5:6:7::8", "invalid IP address", 0},
+		{"12345::", "invalid IP address", 0},
+		{"1:2:3:4:5:6:7:", "invalid IP address", 0},
+		{"1.2.3.4::", "invalid IP address", 0},
+		{"::1.2.3.4:5", "invalid IP address", 0},
+	}
+
+	for _, test := range tests {
+		for _, parse := range []func(string) (ParsedIP, error){ParseIP, func(s string) (ParsedIP, error) { return ParseIPBytes([]byte(s)) }} {
+			parsed, err := parse(test.input)
+			if err != nil {
+				assert.Equal(t, test.result, errors.Unwrap(err).Error(), test.input)
+				var parseError *ParseError
+				assert.True(t, errors.As(err, &parseError))
+				assert.Equal(t, test.input, parseError.Input)
+				continue
+			}
+			assert.True(t, parsed.IsV4 != parsed.IsV6, test.input)
+			if parsed.IsV4 {
+				assert.Equal(t, test.result, parsed.V4.String(), test.input)
+				assert.Equal(t, IPv6Address{}, parsed.V6)
+			} else {
+				assert.Equal(t, test.result, parsed.V6.String(), test.input)
+				assert.Equal(t, IPv4Address{}, parsed.V4)
+			}
+			assert.Equal(t, test.port, parsed.Port, test.input)
+		}
+	}
+}
+
+func TestParseIPStrict(t *testing.T) {
+	parser := Parser{Strict: true}
+
+	for _, input := range []string{"1.2.3.0/24", "1.2.3.4", "0.0.0.0/0", "2001:db8::/32", "10.1.0.0/255.255.0.0", "[::1]:80"} {
+		_, err := parser.Parse(input)
+		assert.NoError(t, err, input)
+	}
+
+	for _, input := range []string{"1.2.3.4/24", "1.0.0.0/0", "2001:db8::1/64", "2001:db8::1/127", "10.1.2.0/255.255.0.0"} {
+		_, err := parser.Parse(input)
+		assert.True(t, errors.Is(err, ErrHostBitsSet), input)
+		_, err = parser.ParseBytes([]byte(input))
+		assert.True(t, errors.Is(err, ErrHostBitsSet), input)
+	}
+
+	_, err := parser.Parse("1.2.3.4/33")
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	_, err = parser.Parse("1.2.3.4/64")
+	assert.True(t, errors.Is(err, ErrInvalidPrefixLength))
+	assert.Equal(t, `couldn't parse "1.2.3.4/64": invalid prefix length`, err.Error())
+}
+
+func TestParseIPMatchesNet(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	var inputs []string
+	for i := 0; i < 20000; i++ {
+		v4 := fmt.Sprintf("%d.%d.%d.%d", random.Intn(256), random.Intn(256), random.Intn(256), random.Intn(256))
+		groups := make([]string, 8)
+		for g := range groups {
+			if random.Intn(3) == 0 {
+				groups[g] = "0"
+			} else {
+				groups[g] = strconv.FormatUint(uint64(random.Intn(0x10000)), 16)
+			}
+		}
+		v6 := strings.Join(groups, ":")
+		if random.Intn(2) == 0 {
+			v6 = net.ParseIP(v6).String() // compressed
+		}
+		inputs = append(inputs,
+			v4, v6,
+			v4+"/"+strconv.Itoa(random.Intn(40)),
+			v6+"/"+strconv.Itoa(random.Intn(140)),
+			"::ffff:"+v4+"/"+strconv.Itoa(random.Intn(96)),
+			"::"+v4,
+			strings.Join(groups[:6], ":")+":"+v4,
+		)
+	}
+
+	// mutate some of them into mostly invalid input
+	const alphabet = "0123456789abcdefABCDEF:./[]% x-"
+	for i := 0; i < 20000; i++ {
+		input := []byte(inputs[random.Intn(len(inputs))])
+		if len(input) == 0 {
+			continue
+		}
+		switch random.Intn(3) {
+		case 0:
+			input[random.Intn(len(input))] = alphabet[random.Intn(len(alphabet))]
+		case 1:
+			input = input[:random.Intn(len(input))]
+		case 2:
+			at := random.Intn(len(input))
+			input = append(input[:at], append([]byte{alphabet[random.Intn(len(alphabet))]}, input[at:]...)...)
+		}
+		inputs = append(inputs, string(input))
+	}
+
+	for _, input := range inputs {
+		expectedV4, expectedV6, expectedErr := parseIPFromStringNet(input)
+		if expectedErr != nil {
+			// ParseIP accepts the ip:port forms, which were always errors before
+			if parsed, err := ParseIP(input); err == nil {
+				assert.True(t, parsed.IsV4 && strings.Count(input, ":") == 1 || strings.HasPrefix(input, "["), input)
+			}
+			continue
+		}
+
+		v4, v6, err := ParseIPFromString(input)
+		if !assert.NoError(t, err, input) {
+			continue
+		}
+		if expectedV4 != nil && expectedV4.Length > 32 {
+			// an IPv4-mapped prefix of at least /96 used to be returned as IPv4, with its IPv6 length - it's now IPv6
+			if assert.Nil(t, v4, input) && assert.NotNil(t, v6, input) {
+				assert.Equal(t, expectedV4.Length, v6.Length, input)
+				assert.Equal(t, uint64(0xffff), v6.Right>>32, input)
+				assert.Equal(t, expectedV4.Address, uint32(v6.Right), input)
+			}
+			continue
+		}
+		assert.Equal(t, expectedV4, v4, input)
+		assert.Equal(t, expectedV6, v6, input)
+	}
+}
+
+func TestParseIPAllocations(t *testing.T) {
+	inputs := []string{"10.1.2.3/255.255.0.0", "10.1.2.3:80", "2001:db8::ffff:1.2.3.4/100", "[2001:db8::1]:443"}
+	byteInputs := make([][]byte, len(inputs))
+	for i, input := range inputs {
+		byteInputs[i] = []byte(input)
+	}
+
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		for i := range inputs {
+			ParseIP(inputs[i])
+			ParseIPBytes(byteInputs[i])
+		}
+	}))
+}
+
+func BenchmarkParseIP(b *testing.B) {
+	inputs := []string{"10.1.2.3", "10.1.2.3/16", "2001:db8::1", "2001:db8::/32"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		ParseIP(inputs[n%len(inputs)])
+	}
+}
+
+func BenchmarkParseIPFromStringNet(b *testing.B) {
+	inputs := []string{"10.1.2.3", "10.1.2.3/16", "2001:db8::1", "2001:db8::/32"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		parseIPFromStringNet(inputs[n%len(inputs)])
+	}
+}
+
+func TestParseIPMapped(t *testing.T) {
+	tests := []struct {
+		input      string
+		compatible bool
+		v4         string // "" if it's not unmapped
+	}{
+		{"::ffff:198.51.100.7", false, "198.51.100.7/32"},
+		{"::FFFF:c633:6407", false, "198.51.100.7/32"},
+		{"::ffff:198.51.100.0/120", false, "198.51.100.0/24"},
+		{"::ffff:0:0/96", false, "0.0.0.0/0"},
+		{"[::ffff:198.51.100.7]:80", false, "198.51.100.7/32"},
+		{"::ffff:0:0/95", false, ""},
+		{"::ffff:0:0/80", false, ""},
+		{"2001:db8::ffff:198.51.100.7", false, ""},
+		{"::198.51.100.7", false, ""},
+		{"::198.51.100.7", true, "198.51.100.7/32"},
+		{"::/96", true, "0.0.0.0/0"},
+		{"::2", true, "0.0.0.2/32"},
+		{"::1", true, ""},
+		{"::", true, ""},
+	}
+
+	for _, test := range tests {
+		for _, policy := range []MappedPolicy{MappedKeep, MappedUnmap, MappedBoth} {
+			parser := Parser{Mapped: policy, Compatible: test.compatible}
+			parsed, err := parser.Parse(test.input)
+			if !assert.NoError(t, err, test.input) {
+				continue
+			}
+			if test.v4 == "" || policy == MappedKeep {
+				assert.False(t, parsed.IsV4, test.input)
+				assert.True(t, parsed.IsV6, test.input)
+				continue
+			}
+			assert.True(t, parsed.IsV4, test.input)
+			assert.Equal(t, test.v4, parsed.V4.String(), test.input)
+			assert.Equal(t, policy == MappedBoth, parsed.IsV6, test.input)
+			if policy == MappedBoth {
+				_, v6, _ := ParseIPFromString(test.input)
+				assert.Equal(t, *v6, parsed.V6)
+			} else {
+				assert.Equal(t, IPv6Address{}, parsed.V6)
+			}
+		}
+	}
+
+	// IPv4 addresses aren't affected
+	parsed, err := Parser{Mapped: MappedBoth}.Parse("198.51.100.7")
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV4)
+	assert.False(t, parsed.IsV6)
+
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		Parser{Mapped: MappedBoth}.Parse("::ffff:198.51.100.7")
+	}))
+}
+
+func TestParsePrefix(t *testing.T) {
+	parser := Parser{Mapped: MappedUnmap}
+
+	parsed, err := parser.ParsePrefix(netip.MustParsePrefix("10.1.2.3/16"))
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV4)
+	assert.Equal(t, "10.1.0.0/16", parsed.V4.String())
+
+	parsed, err = parser.ParsePrefix(netip.MustParsePrefix("::ffff:10.1.2.3/112"))
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV4)
+	assert.False(t, parsed.IsV6)
+	assert.Equal(t, "10.1.0.0/16", parsed.V4.String())
+
+	parsed, err = parser.ParseAddr(netip.MustParseAddr("2001:db8::1%eth0"))
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV6)
+	assert.Equal(t, "2001:db8::1/128", parsed.V6.String())
+
+	_, err = parser.ParsePrefix(netip.Prefix{})
+	assert.True(t, errors.Is(err, ErrInvalidAddress))
+	_, err = parser.ParseAddr(netip.Addr{})
+	assert.True(t, errors.Is(err, ErrInvalidAddress))
+
+	_, err = Parser{Strict: true}.ParsePrefix(netip.MustParsePrefix("10.1.2.3/16"))
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	_, err = Parser{Strict: true}.ParsePrefix(netip.MustParsePrefix("10.1.0.0/16"))
+	assert.NoError(t, err)
+
+	prefix := netip.MustParsePrefix("::ffff:10.1.2.3/112")
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		parser.ParsePrefix(prefix)
+	}))
+}
@@ -0,0 +1,135 @@
+package patricia
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// IPv4AddressRange is an inclusive range of IPv4 addresses, which needn't line up with a prefix, such as 10.0.0.5-10.0.3.200
+type IPv4AddressRange struct {
+	First IPv4Address // the first address, as a /32
+	Last  IPv4Address // the last address, as a /32
+}
+
+// NewIPv4AddressRange returns the range from the first address of start to the last address of end
+// - returns an error if end is before start
+func NewIPv4AddressRange(start IPv4Address, end IPv4Address) (IPv4AddressRange, error) {
+	if start.Length > 32 || end.Length > 32 {
+		return IPv4AddressRange{}, fmt.Errorf("invalid IPv4 range: %s-%s", start, end)
+	}
+	first := start.masked()
+	last := NewIPv4Address(end.Address|^_leftMasks32[end.Length], 32)
+	if last.Address < first.Address {
+		return IPv4AddressRange{}, fmt.Errorf("IPv4 range ends before it starts: %s-%s", start, end)
+	}
+	first.Length = 32
+	return IPv4AddressRange{First: first, Last: last}, nil
+}
+
+// String returns the range as first-last
+func (r IPv4AddressRange) String() string {
+	return r.First.Addr().String() + "-" + r.Last.Addr().String()
+}
+
+// Prefixes returns the fewest prefixes that cover exactly the range, in order
+func (r IPv4AddressRange) Prefixes() []IPv4Address {
+	return r.AppendPrefixes(make([]IPv4Address, 0))
+}
+
+// AppendPrefixes appends the fewest prefixes that cover exactly the range, in order, to dst, returning the extended slice
+// - a range needs at most 62 prefixes
+func (r IPv4AddressRange) AppendPrefixes(dst []IPv4Address) []IPv4Address {
+	first, last := r.First.Address, r.Last.Address
+	if last < first {
+		return dst
+	}
+	for {
+		// the largest prefix starting at first, that doesn't go past last
+		length := uint(32 - bits.TrailingZeros32(first))
+		for first|^_leftMasks32[length] > last {
+			length++
+		}
+		dst = append(dst, NewIPv4Address(first, length))
+
+		end := first | ^_leftMasks32[length]
+		if end == last {
+			return dst
+		}
+		first = end + 1
+	}
+}
+
+// IPv6AddressRange is an inclusive range of IPv6 addresses, which needn't line up with a prefix
+type IPv6AddressRange struct {
+	First IPv6Address // the first address, as a /128
+	Last  IPv6Address // the last address, as a /128
+}
+
+// NewIPv6AddressRange returns the range from the first address of start to the last address of end
+// - returns an error if end is before start
+func NewIPv6AddressRange(start IPv6Address, end IPv6Address) (IPv6AddressRange, error) {
+	if start.Length > 128 || end.Length > 128 {
+		return IPv6AddressRange{}, fmt.Errorf("invalid IPv6 range: %s-%s", start, end)
+	}
+	first := start.masked()
+	first.Length = 128
+	last := end.lastAddress()
+	if lessIPv6(last, first) {
+		return IPv6AddressRange{}, fmt.Errorf("IPv6 range ends before it starts: %s-%s", start, end)
+	}
+	return IPv6AddressRange{First: first, Last: last}, nil
+}
+
+// String returns the range as first-last
+func (r IPv6AddressRange) String() string {
+	return r.First.Addr().String() + "-" + r.Last.Addr().String()
+}
+
+// Prefixes returns the fewest prefixes that cover exactly the range, in order
+func (r IPv6AddressRange) Prefixes() []IPv6Address {
+	return r.AppendPrefixes(make([]IPv6Address, 0))
+}
+
+// AppendPrefixes appends the fewest prefixes that cover exactly the range, in order, to dst, returning the extended slice
+// - a range needs at most 254 prefixes
+func (r IPv6AddressRange) AppendPrefixes(dst []IPv6Address) []IPv6Address {
+	first, last := r.First, r.Last
+	first.Length, last.Length = 128, 128
+	if lessIPv6(last, first) {
+		return dst
+	}
+	for {
+		// the largest prefix starting at first, that doesn't go past last
+		trailingZeros := uint(bits.TrailingZeros64(first.Right))
+		if first.Right == 0 {
+			trailingZeros += uint(bits.TrailingZeros64(first.Left))
+		}
+		first.Length = 128 - trailingZeros
+		for lessIPv6(last, first.lastAddress()) {
+			first.Length++
+		}
+		dst = append(dst, first)
+
+		end := first.lastAddress()
+		if end == last {
+			return dst
+		}
+		first.Left, first.Right = end.Left, end.Right+1
+		if first.Right == 0 {
+			first.Left++
+		}
+	}
+}
+
+// lastAddress returns the last address of the prefix, as a /128
+func (ip IPv6Address) lastAddress() IPv6Address {
+	if ip.Length <= 64 {
+		return IPv6Address{Left: ip.Left | ^_leftMasks64[ip.Length], Right: ^uint64(0), Length: 128}
+	}
+	return IPv6Address{Left: ip.Left, Right: ip.Right | ^_leftMasks64[ip.Length-64], Length: 128}
+}
+
+// lessIPv6 returns whether a's address is before b's, ignoring their lengths
+func lessIPv6(a IPv6Address, b IPv6Address) bool {
+	return a.Left < b.Left || (a.Left == b.Left && a.Right < b.Right)
+}
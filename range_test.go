@@ -0,0 +1,166 @@
+package patricia
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rangePrefixStrings[T interface{ String() string }](prefixes []T) []string {
+	ret := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		ret = append(ret, prefix.String())
+	}
+	return ret
+}
+
+func TestIPv4AddressRangePrefixes(t *testing.T) {
+	tests := []struct {
+		input    string
+		prefixes []string
+	}{
+		{"10.0.0.5-10.0.3.200", []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/26",
+			"10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/25", "10.0.3.128/26", "10.0.3.192/29", "10.0.3.200/32"}},
+		{"10.0.0.0-10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.7-10.0.0.7", []string{"10.0.0.7/32"}},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+		{"0.0.0.1-255.255.255.255", []string{"0.0.0.1/32", "0.0.0.2/31", "0.0.0.4/30", "0.0.0.8/29", "0.0.0.16/28", "0.0.0.32/27", "0.0.0.64/26",
+			"0.0.0.128/25", "0.0.1.0/24", "0.0.2.0/23", "0.0.4.0/22", "0.0.8.0/21", "0.0.16.0/20", "0.0.32.0/19", "0.0.64.0/18", "0.0.128.0/17",
+			"0.1.0.0/16", "0.2.0.0/15", "0.4.0.0/14", "0.8.0.0/13", "0.16.0.0/12", "0.32.0.0/11", "0.64.0.0/10", "0.128.0.0/9", "1.0.0.0/8",
+			"2.0.0.0/7", "4.0.0.0/6", "8.0.0.0/5", "16.0.0.0/4", "32.0.0.0/3", "64.0.0.0/2", "128.0.0.0/1"}},
+		{"255.255.255.254-255.255.255.255", []string{"255.255.255.254/31"}},
+		{"10.0.0.0/24-10.0.3.0/24", []string{"10.0.0.0/22"}},
+		{"10.1.*.*", []string{"10.1.0.0/16"}},
+		{"10.1.2.*-10.1.5.*", []string{"10.1.2.0/23", "10.1.4.0/23"}},
+		{"*.*.*.*", []string{"0.0.0.0/0"}},
+		{"192.168.1.0/24", []string{"192.168.1.0/24"}},
+	}
+	for _, test := range tests {
+		parsed, err := ParseRange(test.input)
+		if !assert.NoError(t, err, test.input) {
+			continue
+		}
+		assert.True(t, parsed.IsV4, test.input)
+		assert.False(t, parsed.IsV6, test.input)
+		assert.Equal(t, test.prefixes, rangePrefixStrings(parsed.V4.Prefixes()), test.input)
+	}
+}
+
+func TestIPv4AddressRangeRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		first, last := random.Uint32(), random.Uint32()
+		if i%2 == 0 {
+			last = first + uint32(random.Intn(5000))
+		}
+		if last < first {
+			first, last = last, first
+		}
+		addressRange, err := NewIPv4AddressRange(NewIPv4Address(first, 32), NewIPv4Address(last, 32))
+		assert.NoError(t, err)
+		prefixes := addressRange.Prefixes()
+
+		// the prefixes run contiguously from first to last, and no two neighbours could be merged
+		next := uint64(first)
+		for j, prefix := range prefixes {
+			assert.Equal(t, next, uint64(prefix.Address))
+			assert.Equal(t, prefix, prefix.masked())
+			next = uint64(prefix.Address) + uint64(1)<<(32-prefix.Length)
+			if j > 0 && prefixes[j-1].Length == prefix.Length {
+				assert.NotEqual(t, prefix.Length-1, prefixes[j-1].CommonPrefixLength(prefix), "%s %s", prefixes[j-1], prefix)
+			}
+		}
+		assert.Equal(t, uint64(last)+1, next)
+		assert.True(t, len(prefixes) <= 62)
+	}
+}
+
+func TestIPv6AddressRangePrefixes(t *testing.T) {
+	tests := []struct {
+		input    string
+		prefixes []string
+	}{
+		{"2001:db8::-2001:db8::ff", []string{"2001:db8::/120"}},
+		{"2001:db8::5-2001:db8::10", []string{"2001:db8::5/128", "2001:db8::6/127", "2001:db8::8/125", "2001:db8::10/128"}},
+		{"2001:db8::ffff:ffff:ffff:ffff-2001:db8:0:1::", []string{"2001:db8::ffff:ffff:ffff:ffff/128", "2001:db8:0:1::/128"}},
+		{"2001:db8::/48-2001:db8:2::/48", []string{"2001:db8::/47", "2001:db8:2::/48"}},
+		{"::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"}},
+		{"::8000:0:0:0-::ffff:ffff:ffff:ffff", []string{"::8000:0:0:0/65"}},
+		{"[2001:db8::1]-[2001:db8::2]", []string{"2001:db8::1/128", "2001:db8::2/128"}},
+	}
+	for _, test := range tests {
+		parsed, err := ParseRange(test.input)
+		if !assert.NoError(t, err, test.input) {
+			continue
+		}
+		assert.True(t, parsed.IsV6, test.input)
+		assert.False(t, parsed.IsV4, test.input)
+		assert.Equal(t, test.prefixes, rangePrefixStrings(parsed.V6.Prefixes()), test.input)
+	}
+
+	// the same decomposition as IPv4, in the last 32 bits
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		first, last := random.Uint32(), random.Uint32()
+		if last < first {
+			first, last = last, first
+		}
+		v4Range, _ := NewIPv4AddressRange(NewIPv4Address(first, 32), NewIPv4Address(last, 32))
+		v6Range, err := NewIPv6AddressRange(IPv6Address{Left: 1, Right: uint64(first), Length: 128}, IPv6Address{Left: 1, Right: uint64(last), Length: 128})
+		assert.NoError(t, err)
+		v4Prefixes, v6Prefixes := v4Range.Prefixes(), v6Range.Prefixes()
+		if assert.Equal(t, len(v4Prefixes), len(v6Prefixes)) {
+			for j := range v4Prefixes {
+				assert.Equal(t, IPv6Address{Left: 1, Right: uint64(v4Prefixes[j].Address), Length: v4Prefixes[j].Length + 96}, v6Prefixes[j])
+			}
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	parsed, err := ParseRange("10.0.0.5-10.0.3.200")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5-10.0.3.200", parsed.V4.String())
+	assert.Equal(t, NewIPv4Address(0x0a000005, 32), parsed.V4.First)
+	assert.Equal(t, NewIPv4Address(0x0a0003c8, 32), parsed.V4.Last)
+
+	parsed, err = ParseRange("2001:db8::/32")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", parsed.V6.String())
+
+	for _, input := range []string{"10.0.0.5-10.0.0.4", "10.0.0.0/24-10.0.0.128/25-", "10.0.0.1-::1", "::2-::1", "10.0.0.1:80-10.0.0.2",
+		"[::1]:80-[::2]", "10.0.0.1-"} {
+		_, err := ParseRange(input)
+		assert.Error(t, err, input)
+	}
+	for _, input := range []string{"10.0.0.5-10.0.0.4", "10.0.0.1-::1", "10.0.0.1:80-10.0.0.2"} {
+		_, err := ParseRange(input)
+		assert.True(t, errors.Is(err, ErrInvalidRange), input)
+	}
+	for _, input := range []string{"10.*.1.*", "10.1.*", "10.1.*.*.*", "10.1.**.*", "10.1.256.*", "*"} {
+		_, err := ParseRange(input)
+		assert.True(t, errors.Is(err, ErrInvalidAddress), input)
+	}
+
+	// the parser's rules apply to each end
+	_, err = Parser{Strict: true}.ParseRange("10.0.0.1/24-10.0.1.0/24")
+	assert.True(t, errors.Is(err, ErrHostBitsSet))
+	parsed, err = Parser{Mapped: MappedUnmap}.ParseRange("::ffff:10.0.0.0-::ffff:10.0.0.255")
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV4)
+	assert.False(t, parsed.IsV6)
+	assert.Equal(t, []IPv4Address{NewIPv4Address(0x0a000000, 24)}, parsed.V4.Prefixes())
+	parsed, err = Parser{Mapped: MappedBoth}.ParseRange("::ffff:10.0.0.0-::ffff:10.0.0.255")
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsV4)
+	assert.True(t, parsed.IsV6)
+
+	_, err = NewIPv4AddressRange(NewIPv4Address(0, 33), NewIPv4Address(0, 32))
+	assert.Error(t, err)
+	_, err = NewIPv6AddressRange(IPv6Address{Left: 1, Length: 128}, IPv6Address{Right: 1, Length: 128})
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(IPv4AddressRange{First: NewIPv4Address(2, 32), Last: NewIPv4Address(1, 32)}.Prefixes()))
+}
@@ -0,0 +1,89 @@
+package string_tree
+
+import (
+	"fmt"
+	"hash/maphash"
+	"maps"
+	"unsafe"
+)
+
+// this replaces tags.go for string payloads, whose headers the garbage collector would have to scan if they were kept in the tree
+
+// storedTag is how tags are kept in the tree: the ID of the interned string
+type storedTag = uint32
+
+// maxArenaBytes is how long a tree's string arena can grow, as strings are addressed by 32-bit offsets
+// - a variable, so tests can fill an arena without allocating one this big
+var maxArenaBytes = uint64(^uint32(0))
+
+// tagStore interns strings into an append-only byte arena, so the tree holds no pointers but the arena's
+// - each distinct string is stored once, and keeps its ID until the tree is compacted, even once no tags use it
+// - strings returned by load point into the arena, which is never modified in place, so they stay valid
+type tagStore struct {
+	arena   []byte
+	strings []internedString  // by ID
+	ids     map[uint64]uint32 // hash of the string -> its ID, with collisions moving on to the next hash
+	seed    maphash.Seed
+}
+
+// internedString is where a string is in the arena
+type internedString struct {
+	offset uint32
+	length uint32
+}
+
+// store returns the ID of the interned tag, interning it if it's new
+// - returns an error if the arena has no room left for it, until the tree is compacted
+func (s *tagStore) store(tag string) (storedTag, error) {
+	if s.ids == nil {
+		s.ids = make(map[uint64]uint32)
+		s.seed = maphash.MakeSeed()
+	}
+
+	hash := maphash.String(s.seed, tag)
+	for {
+		id, found := s.ids[hash]
+		if !found {
+			break
+		}
+		if s.load(id) == tag {
+			return id, nil
+		}
+		hash++
+	}
+
+	if uint64(len(s.arena))+uint64(len(tag)) > maxArenaBytes || uint64(len(s.strings)) >= uint64(^uint32(0)) {
+		return 0, fmt.Errorf("string tag arena is full: can't add a %d byte string to %d bytes in %d strings", len(tag), len(s.arena), len(s.strings))
+	}
+	id := uint32(len(s.strings))
+	s.strings = append(s.strings, internedString{offset: uint32(len(s.arena)), length: uint32(len(tag))})
+	s.arena = append(s.arena, tag...)
+	s.ids[hash] = id
+	return id, nil
+}
+
+// load returns the interned tag, without copying it
+func (s *tagStore) load(stored storedTag) string {
+	interned := s.strings[stored]
+	if interned.length == 0 {
+		return ""
+	}
+	return unsafe.String(&s.arena[interned.offset], interned.length)
+}
+
+// clone returns a copy of the store, for a cloned tree
+// - the arena and string list are shared, but capped, so appending to either store's copy doesn't overwrite the other's
+func (s *tagStore) clone() tagStore {
+	return tagStore{
+		arena:   s.arena[:len(s.arena):len(s.arena)],
+		strings: s.strings[:len(s.strings):len(s.strings)],
+		ids:     maps.Clone(s.ids),
+		seed:    s.seed,
+	}
+}
+
+// allocatedBytes estimates the memory held by the arena, string list and ID map
+// - the map's own overhead isn't included
+func (s *tagStore) allocatedBytes() int {
+	return cap(s.arena) + cap(s.strings)*int(unsafe.Sizeof(internedString{})) + len(s.ids)*int(unsafe.Sizeof(uint64(0))+unsafe.Sizeof(uint32(0)))
+}
@@ -0,0 +1,210 @@
+package string_tree
+
+import (
+	"fmt"
+	"hash/maphash"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagStore(t *testing.T) {
+	var store tagStore
+	a := mustStore(t, &store, "alpha")
+	b := mustStore(t, &store, "beta")
+	empty := mustStore(t, &store, "")
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, a, mustStore(t, &store, "alpha"))
+	assert.Equal(t, empty, mustStore(t, &store, ""))
+	assert.Equal(t, "alpha", store.load(a))
+	assert.Equal(t, "beta", store.load(b))
+	assert.Equal(t, "", store.load(empty))
+	assert.Equal(t, 3, len(store.strings))
+	assert.Equal(t, "alphabeta", string(store.arena))
+
+	// loaded strings stay valid as the arena grows
+	loaded := store.load(a)
+	for i := 0; i < 1000; i++ {
+		mustStore(t, &store, strconv.Itoa(i))
+	}
+	assert.Equal(t, "alpha", loaded)
+	assert.Equal(t, "999", store.load(mustStore(t, &store, "999")))
+
+	// a hash collision moves on to the next hash
+	collision := tagStore{ids: map[uint64]uint32{}, seed: maphash.MakeSeed()}
+	other := mustStore(t, &collision, "other")
+	hash := maphash.String(collision.seed, "colliding")
+	collision.ids[hash] = other
+	id := mustStore(t, &collision, "colliding")
+	assert.NotEqual(t, other, id)
+	assert.Equal(t, id, collision.ids[hash+1])
+	assert.Equal(t, id, mustStore(t, &collision, "colliding"))
+	assert.Equal(t, "colliding", collision.load(id))
+}
+
+func TestTagStoreClone(t *testing.T) {
+	var store tagStore
+	a := mustStore(t, &store, "alpha")
+	cloned := store.clone()
+
+	b := mustStore(t, &store, "beta")
+	c := mustStore(t, &cloned, "gamma")
+	assert.Equal(t, b, c)
+	assert.Equal(t, "beta", store.load(b))
+	assert.Equal(t, "gamma", cloned.load(c))
+	assert.Equal(t, "alpha", cloned.load(a))
+	assert.Equal(t, a, mustStore(t, &cloned, "alpha"))
+	assert.Equal(t, 2, len(store.strings))
+	assert.Equal(t, 2, len(cloned.strings))
+}
+
+func TestTagStoreFull(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 8), "alpha", nil)
+
+	// pretend the arena is as long as it can be
+	defer func(max uint64) { maxArenaBytes = max }(maxArenaBytes)
+	maxArenaBytes = uint64(len(tree.tagStorage.arena))
+	_, _, err := tree.Add(patricia.NewIPv4Address(0x0b000000, 8), "beta", nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "string tag arena is full")
+	}
+	_, _, err = tree.Set(patricia.NewIPv4Address(0x0a000000, 8), "beta")
+	assert.Error(t, err)
+
+	// strings that are already interned can still be added
+	_, _, err = tree.Add(patricia.NewIPv4Address(0x0b000000, 8), "alpha", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, maxArenaBytes, uint64(len(tree.tagStorage.arena)))
+
+	tags, _ := tree.FindTags(patricia.NewIPv4Address(0x0a000001, 32))
+	assert.Equal(t, []string{"alpha"}, tags)
+	tags, _ = tree.FindTags(patricia.NewIPv4Address(0x0b000001, 32))
+	assert.Equal(t, []string{"alpha"}, tags)
+	assert.Equal(t, 1, len(tree.tagStorage.strings))
+}
+
+func TestTreeInternsTags(t *testing.T) {
+	tree := NewTreeV4()
+	for i := 0; i < 1000; i++ {
+		tree.Add(patricia.NewIPv4Address(uint32(i)<<8, 24), fmt.Sprintf("tag-%d", i%10), nil)
+	}
+	assert.Equal(t, 10, len(tree.tagStorage.strings))
+
+	tags, _ := tree.FindTags(patricia.NewIPv4Address(uint32(123)<<8|7, 32))
+	assert.Equal(t, []string{"tag-3"}, tags)
+
+	// clones and serialized copies read the same
+	cloned := tree.Clone()
+	cloned.Set(patricia.NewIPv4Address(uint32(123)<<8, 24), "changed")
+	tags, _ = tree.FindTags(patricia.NewIPv4Address(uint32(123)<<8, 32))
+	assert.Equal(t, []string{"tag-3"}, tags)
+	tags, _ = cloned.FindTags(patricia.NewIPv4Address(uint32(123)<<8, 32))
+	assert.Equal(t, []string{"changed"}, tags)
+
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+	loaded := NewTreeV4()
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	tags, _ = loaded.FindTags(patricia.NewIPv4Address(uint32(999)<<8, 32))
+	assert.Equal(t, []string{"tag-9"}, tags)
+	assert.Equal(t, 10, len(loaded.tagStorage.strings))
+
+	// the tree's tags and intern table hold no pointers for the garbage collector to scan
+	for _, value := range []any{tree.tags.slots, tree.tags.free[0], tree.tagStorage.ids, tree.tagStorage.strings} {
+		valueType := reflect.TypeOf(value)
+		if valueType.Kind() == reflect.Map {
+			assert.False(t, typeHasPointers(valueType.Key()), valueType.String())
+		}
+		assert.False(t, typeHasPointers(valueType.Elem()), valueType.String())
+	}
+}
+
+func TestCompactReinternsTags(t *testing.T) {
+	matchFunc := func(a string, b string) bool { return a == b }
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "kept", nil)
+
+	// churn through distinct strings, which stay in the arena until compacted
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 1000; i++ {
+			tree.Add(patricia.NewIPv4Address(uint32(i)<<8, 24), fmt.Sprintf("round-%d-%d", round, i), nil)
+		}
+		assert.Equal(t, 1001, len(tree.tagStorage.strings))
+		for i := 0; i < 1000; i++ {
+			tree.Delete(patricia.NewIPv4Address(uint32(i)<<8, 24), matchFunc, fmt.Sprintf("round-%d-%d", round, i))
+		}
+		arenaBytes := tree.tagStorage.allocatedBytes()
+
+		stats := tree.Compact()
+		assert.Equal(t, 1, stats.Tags)
+		assert.True(t, stats.BytesReclaimed >= arenaBytes-tree.tagStorage.allocatedBytes())
+		assert.True(t, tree.tagStorage.allocatedBytes() < arenaBytes)
+
+		// just the string still in use is left, so the arena doesn't grow from round to round
+		assert.Equal(t, 1, len(tree.tagStorage.strings))
+		assert.Equal(t, 1, len(tree.tagStorage.ids))
+		assert.Equal(t, "kept", string(tree.tagStorage.arena))
+	}
+
+	// strings returned before compacting stay valid, and the tree keeps interning
+	tags, _ := tree.FindTags(patricia.NewIPv4Address(0x0a000000, 32))
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 8), "kept", nil)
+	tree.Add(patricia.NewIPv4Address(0x0b000000, 8), "new", nil)
+	tree.Compact()
+	assert.Equal(t, []string{"kept"}, tags)
+	assert.Equal(t, 2, len(tree.tagStorage.strings))
+	tags, _ = tree.FindTags(patricia.NewIPv4Address(0x0a000000, 32))
+	assert.Equal(t, []string{"kept", "kept"}, tags)
+	tags, _ = tree.FindTags(patricia.NewIPv4Address(0x0b000000, 32))
+	assert.Equal(t, []string{"kept", "new"}, tags)
+}
+
+// BenchmarkGCWithTags measures a full garbage collection with 10M tags in memory, kept as the tree used to,
+// in a map[uint64]string, and as the tree does now, interned into its tag slab
+func BenchmarkGCWithTags(b *testing.B) {
+	const tagCount = 10000000
+	tag := func(i int) string {
+		return "customer-" + strconv.Itoa(i%100000)
+	}
+
+	b.Run("map[uint64]string", func(b *testing.B) {
+		tags := make(map[uint64]string, tagCount)
+		for i := 0; i < tagCount; i++ {
+			tags[uint64(i)] = tag(i)
+		}
+		benchmarkGC(b)
+		runtime.KeepAlive(tags)
+	})
+	b.Run("interned", func(b *testing.B) {
+		var store tagStore
+		slab := tagSlab{slots: make([]storedTag, tagCount)}
+		for i := range slab.slots {
+			slab.slots[i] = mustStore(b, &store, tag(i))
+		}
+		benchmarkGC(b)
+		runtime.KeepAlive(&slab)
+		runtime.KeepAlive(&store)
+	})
+}
+
+// mustStore stores the tag, failing the test if there's no room for it
+func mustStore(tb testing.TB, store *tagStore, tag string) storedTag {
+	stored, err := store.store(tag)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return stored
+}
+
+func benchmarkGC(b *testing.B) {
+	runtime.GC()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		runtime.GC()
+	}
+}
@@ -0,0 +1,155 @@
+package template
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagSlab(t *testing.T) {
+	var slab tagSlab
+
+	// blocks are rounded up to a power of two
+	a := mustAlloc(t, &slab, 1)
+	b := mustAlloc(t, &slab, 3)
+	assert.Equal(t, tagBlock{offset: 0, capacity: 1}, a)
+	assert.Equal(t, tagBlock{offset: 1, capacity: 4}, b)
+	assert.Equal(t, 5, len(slab.slots))
+
+	// released blocks are reused by requests of the same size, rather than growing the slab
+	slab.release(b)
+	assert.Equal(t, tagBlock{offset: 1, capacity: 4}, mustAlloc(t, &slab, 4))
+	slab.release(a)
+	assert.Equal(t, tagBlock{offset: 5, capacity: 2}, mustAlloc(t, &slab, 2))
+	assert.Equal(t, a, mustAlloc(t, &slab, 1))
+	assert.Equal(t, 7, len(slab.slots))
+
+	// blocks of other sizes, such as a loaded tree's, are reused by requests they have room for
+	slab.release(tagBlock{offset: 1, capacity: 3})
+	assert.Equal(t, tagBlock{offset: 1, capacity: 3}, mustAlloc(t, &slab, 2))
+
+	// clones don't share free lists
+	slab.release(a)
+	clone := slab.clone()
+	assert.Equal(t, a, mustAlloc(t, &clone, 1))
+	assert.Equal(t, a, mustAlloc(t, &slab, 1))
+}
+
+func TestTagSlabNodes(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	address := ipv4FromBytes([]byte{10, 0, 0, 0}, 8)
+
+	tree := NewTreeV4()
+	for _, tag := range []string{"A", "B", "C", "D", "E"} {
+		tree.Add(address, tag, matchFunc)
+	}
+	tree.Add(address, "C", matchFunc)
+	tags, _ := tree.GetExact(address)
+	assert.Equal(t, []GeneratedType{"A", "B", "C", "D", "E"}, tags)
+	assert.Equal(t, uint32(8), tree.nodes[2].tags.capacity)
+
+	// deleting keeps the order of the rest, in the same block
+	count, err := tree.Delete(address, matchFunc, "B")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	tags, _ = tree.GetExact(address)
+	assert.Equal(t, []GeneratedType{"A", "C", "D", "E"}, tags)
+	assert.Equal(t, uint32(8), tree.nodes[2].tags.capacity)
+
+	// setting replaces the first
+	tree.Set(address, "Z")
+	tags, _ = tree.GetExact(address)
+	assert.Equal(t, []GeneratedType{"Z", "C", "D", "E"}, tags)
+
+	// the node's block is freed once its last tag is deleted, and reused as the node grows again
+	for _, tag := range []string{"Z", "C", "D", "E"} {
+		tree.Delete(address, matchFunc, tag)
+	}
+	slabLength := len(tree.tags.slots)
+	for i := 0; i < 8; i++ {
+		tree.Add(address, i, nil)
+	}
+	assert.Equal(t, slabLength, len(tree.tags.slots))
+
+	// merging a node into its parent moves its block, rather than its tags
+	tree = NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 16), "left", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 128, 0, 0}, 16), "right", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 128, 0, 0}, 16), "right2", nil)
+	slabLength = len(tree.tags.slots)
+	tree.Delete(ipv4FromBytes([]byte{10, 0, 0, 0}, 16), matchFunc, "left")
+	tags, _ = tree.GetExact(ipv4FromBytes([]byte{10, 128, 0, 0}, 16))
+	assert.Equal(t, []GeneratedType{"right", "right2"}, tags)
+	assert.Equal(t, slabLength, len(tree.tags.slots))
+}
+
+func TestTagSlabFull(t *testing.T) {
+	// blocks are addressed by 32-bit offsets, so can't have more than 2^31 tags, once rounded up to a power of two
+	var slab tagSlab
+	if bits.UintSize == 64 {
+		minCapacity := uint64(1<<31 + 1)
+		_, err := slab.alloc(int(minCapacity))
+		assert.Error(t, err)
+	}
+
+	tree := NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 16), "B", nil)
+	expected := tree.Clone()
+	expectedStats := tree.Stats()
+
+	// pretend the slab is as long as it can be
+	defer func(max uint64) { maxTagSlots = max }(maxTagSlots)
+	maxTagSlots = uint64(len(tree.tags.slots))
+	for _, address := range []patricia.IPv4Address{
+		{},                                      // the root, which has no block yet
+		ipv4FromBytes([]byte{10, 0, 0, 0}, 8),   // a node whose block is full
+		ipv4FromBytes([]byte{128, 0, 0, 0}, 8),  // a new child of the root
+		ipv4FromBytes([]byte{10, 128, 0, 0}, 9), // a new child of another node
+		ipv4FromBytes([]byte{10, 0, 0, 0}, 4),   // a new parent
+		ipv4FromBytes([]byte{11, 0, 0, 0}, 8),   // a new node, with a new parent shared with 10.0.0.0/8
+	} {
+		countIncreased, _, err := tree.Add(address, "C", nil)
+		if assert.Error(t, err, address.String()) {
+			assert.Contains(t, err.Error(), "tag slab is full")
+		}
+		assert.False(t, countIncreased)
+	}
+	assert.Equal(t, maxTagSlots, uint64(len(tree.tags.slots)))
+	maxTagSlots = uint64(^uint32(0))
+
+	// the tree is unchanged, but for the nodes that weren't linked in being available - each add reused the last's
+	assert.NoError(t, validateTreeV4Nodes(tree.nodes, tree.availableIndexes))
+	assert.Equal(t, 2, len(tree.availableIndexes))
+	assert.Equal(t, collectTagsV4(expected), collectTagsV4(tree))
+	stats := assertStatsV4(t, tree)
+	assert.Equal(t, expectedStats.Tags, stats.Tags)
+	assert.Equal(t, expectedStats.PrefixLengths, stats.PrefixLengths)
+
+	// and can be added to once there's room, reusing those nodes
+	_, _, err := tree.Add(ipv4FromBytes([]byte{11, 0, 0, 0}, 8), "C", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tree.availableIndexes))
+	tags, _ := tree.FindTags(ipv4FromBytes([]byte{11, 0, 0, 0}, 32))
+	assert.Equal(t, []GeneratedType{"C"}, tags)
+}
+
+// mustAlloc allocates a block, failing the test if there's no room for it
+func mustAlloc(tb testing.TB, slab *tagSlab, minCapacity int) tagBlock {
+	block, err := slab.alloc(minCapacity)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return block
+}
+
+// collectTagsV4 returns the tree's tags, by prefix
+func collectTagsV4(tree *TreeV4) map[patricia.IPv4Address][]GeneratedType {
+	ret := make(map[patricia.IPv4Address][]GeneratedType)
+	for address, tags := range tree.All() {
+		ret[address] = tags
+	}
+	return ret
+}
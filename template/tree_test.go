@@ -0,0 +1,305 @@
+package template
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTreeString(t *testing.T) {
+	tree := NewTree()
+
+	for _, entry := range []struct{ address, tag string }{
+		{"10.0.0.0/8", "v4-8"},
+		{"10.1.0.0/16", "v4-16"},
+		{"10.1.2.3", "v4-32"},
+		{"2001:db8::/32", "v6-32"},
+		{"2001:db8:1::/48", "v6-48"},
+		{"2001:db8:1::1", "v6-128"},
+	} {
+		countIncreased, count, err := tree.AddString(entry.address, entry.tag, nil)
+		assert.NoError(t, err)
+		assert.True(t, countIncreased)
+		assert.Equal(t, 1, count)
+	}
+	assert.Equal(t, 6, tree.CountTags())
+	assert.Equal(t, 3, tree.V4().countTags(1))
+	assert.Equal(t, 3, tree.V6().countTags(1))
+
+	tags, err := tree.FindTagsString("10.1.2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"v4-8", "v4-16", "v4-32"}, tags)
+	tags, err = tree.FindTagsString("2001:db8:1::2")
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"v6-32", "v6-48"}, tags)
+
+	found, tag, err := tree.FindDeepestTagString("10.1.200.1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v4-16", tag)
+	found, tag, err = tree.FindDeepestTagString("2001:db8:1::1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v6-128", tag)
+	found, _, err = tree.FindDeepestTagString("192.168.0.1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	countIncreased, count, err := tree.SetString("10.1.0.0/16", "v4-16-replaced")
+	assert.NoError(t, err)
+	assert.False(t, countIncreased)
+	assert.Equal(t, 1, count)
+	tags, _ = tree.FindTagsString("10.1.0.0/16")
+	assert.Equal(t, []GeneratedType{"v4-8", "v4-16-replaced"}, tags)
+
+	deleted, err := tree.DeleteString("2001:db8:1::/48", func(payload GeneratedType, val GeneratedType) bool { return true }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 5, tree.CountTags())
+
+	_, _, err = tree.AddString("not an address", "x", nil)
+	assert.Error(t, err)
+	_, err = tree.FindTagsString("10.0.0.0/129")
+	assert.Error(t, err)
+	_, err = tree.DeleteString("", nil, nil)
+	assert.Error(t, err)
+	_, _, err = tree.FindDeepestTagString("10.0.0.1/x")
+	assert.Error(t, err)
+}
+
+func TestTreeNetip(t *testing.T) {
+	tree := NewTree()
+
+	_, _, err := tree.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"), "v4-8", nil)
+	assert.NoError(t, err)
+	_, _, err = tree.SetPrefix(netip.MustParsePrefix("10.1.2.3/16"), "v4-16") // host bits are masked
+	assert.NoError(t, err)
+	_, _, err = tree.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), "v6-32", nil)
+	assert.NoError(t, err)
+	_, _, err = tree.AddPrefix(netip.Prefix{}, "invalid", nil)
+	assert.Error(t, err)
+
+	tags, err := tree.FindTagsAddr(netip.MustParseAddr("10.1.9.9"))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"v4-8", "v4-16"}, tags)
+	tags, err = tree.FindTagsPrefix(netip.MustParsePrefix("2001:db8:ffff::/48"))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"v6-32"}, tags)
+	_, err = tree.FindTagsAddr(netip.Addr{})
+	assert.Error(t, err)
+
+	// IPv4-mapped addresses are IPv6
+	tags, err = tree.FindTagsAddr(netip.MustParseAddr("::ffff:10.1.9.9"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tags))
+
+	found, tag, err := tree.FindDeepestTagAddr(netip.MustParseAddr("10.200.0.1"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v4-8", tag)
+	found, tag, err = tree.FindDeepestTagPrefix(netip.MustParsePrefix("2001:db8::/64"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v6-32", tag)
+
+	deleted, err := tree.DeletePrefix(netip.MustParsePrefix("10.1.0.0/16"), func(payload GeneratedType, val GeneratedType) bool { return payload == val }, "v4-16")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 2, tree.CountTags())
+}
+
+func TestTreeWalk(t *testing.T) {
+	tree := NewTree()
+	assert.Equal(t, 0, tree.CountTags())
+	assert.Equal(t, 2, tree.CountNodes())
+
+	tree.AddString("2001:db8::/32", "v6-32", nil)
+	tree.AddString("0.0.0.0/0", "v4-0", nil)
+	tree.AddString("10.1.0.0/16", "v4-16", nil)
+	tree.AddString("10.1.0.0/16", "v4-16-2", nil)
+	tree.AddString("::/0", "v6-0", nil)
+
+	var prefixes []string
+	var tags [][]GeneratedType
+	for prefix, prefixTags := range tree.All() {
+		prefixes = append(prefixes, prefix.String())
+		tags = append(tags, prefixTags)
+	}
+	assert.Equal(t, []string{"0.0.0.0/0", "10.1.0.0/16", "::/0", "2001:db8::/32"}, prefixes)
+	assert.Equal(t, [][]GeneratedType{{"v4-0"}, {"v4-16", "v4-16-2"}, {"v6-0"}, {"v6-32"}}, tags)
+	assert.Equal(t, 5, tree.CountTags())
+	assert.Equal(t, 4, tree.CountNodes())
+
+	// stopping early in either family
+	for _, stopAfter := range []int{1, 3} {
+		visited := 0
+		tree.Walk(func(prefix netip.Prefix, tags []GeneratedType) bool {
+			visited++
+			return visited < stopAfter
+		})
+		assert.Equal(t, stopAfter, visited)
+	}
+}
+
+func TestTreeMappedPolicy(t *testing.T) {
+	for _, policy := range []patricia.MappedPolicy{patricia.MappedKeep, patricia.MappedUnmap, patricia.MappedBoth} {
+		tree := NewTree()
+		tree.SetParser(patricia.Parser{Mapped: policy})
+
+		tree.AddString("198.51.100.0/24", "v4-24", nil)
+		tree.AddString("::ffff:198.51.0.0/112", "mapped-16", nil)
+		tree.AddString("::/0", "v6-0", nil)
+
+		if policy == patricia.MappedKeep {
+			assert.Equal(t, 1, tree.V4().countTags(1))
+		} else {
+			// the mapped CIDR lands in the IPv4 tree
+			assert.Equal(t, 2, tree.V4().countTags(1))
+			tags, _ := tree.V4().FindTags(ipv4FromBytes([]byte{198, 51, 0, 0}, 16))
+			assert.Equal(t, []GeneratedType{"mapped-16"}, tags)
+		}
+
+		tags, err := tree.FindTagsString("::ffff:198.51.100.7")
+		assert.NoError(t, err)
+		found, tag, _ := tree.FindDeepestTagAddr(netip.MustParseAddr("::ffff:198.51.100.7"))
+		assert.True(t, found)
+		switch policy {
+		case patricia.MappedKeep:
+			assert.Equal(t, []GeneratedType{"v6-0", "mapped-16"}, tags)
+			assert.Equal(t, "mapped-16", tag)
+		case patricia.MappedUnmap:
+			assert.Equal(t, []GeneratedType{"mapped-16", "v4-24"}, tags)
+			assert.Equal(t, "v4-24", tag)
+		case patricia.MappedBoth:
+			assert.Equal(t, []GeneratedType{"mapped-16", "v4-24", "v6-0"}, tags)
+			assert.Equal(t, "v4-24", tag)
+		}
+
+		// plain IPv4 and IPv6 lookups aren't affected
+		tags, _ = tree.FindTagsString("198.51.100.7")
+		expected, _ := tree.V4().FindTags(ipv4FromBytes([]byte{198, 51, 100, 7}, 32))
+		assert.Equal(t, expected, tags)
+		found, tag, _ = tree.FindDeepestTagString("2001:db8::1")
+		assert.True(t, found)
+		assert.Equal(t, "v6-0", tag)
+
+		deleted, err := tree.DeletePrefix(netip.MustParsePrefix("::ffff:198.51.0.0/112"), func(payload GeneratedType, val GeneratedType) bool { return true }, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		assert.Equal(t, 2, tree.CountTags())
+	}
+}
+
+func TestTreeMappedBothDeepest(t *testing.T) {
+	tree := NewTree()
+	tree.SetParser(patricia.Parser{Mapped: patricia.MappedBoth})
+	tree.V4().Add(ipv4FromBytes([]byte{198, 51, 0, 0}, 16), "v4-16", nil)
+	tree.V6().Add(ipv6FromString("::ffff:198.51.100.0/120", 120), "v6-24", nil)
+
+	// the IPv6 tag is more specific
+	found, tag, err := tree.FindDeepestTagString("::ffff:198.51.100.7")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v6-24", tag)
+	tags, _ := tree.FindTagsString("::ffff:198.51.100.7")
+	assert.Equal(t, []GeneratedType{"v4-16", "v6-24"}, tags)
+
+	// only the IPv4 tag matches
+	found, tag, _ = tree.FindDeepestTagString("::ffff:198.51.1.1")
+	assert.True(t, found)
+	assert.Equal(t, "v4-16", tag)
+	found, _, _ = tree.FindDeepestTagString("::ffff:10.0.0.1")
+	assert.False(t, found)
+
+	addr := netip.MustParseAddr("::ffff:198.51.100.7")
+	buf := make([]GeneratedType, 0, 10)
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		buf, _ = tree.FindTagsAddrAppend(buf[:0], addr)
+	}))
+	assert.Equal(t, []GeneratedType{"v4-16", "v6-24"}, buf)
+}
+
+func TestTreeEmbeddedIPv4(t *testing.T) {
+	tree := NewTree()
+	tree.AddString("192.0.2.0/24", "v4-24", nil)
+	tree.AddString("2001::/32", "teredo", nil)
+	tree.AddString("::/0", "v6-0", nil)
+
+	teredo := "2001:0000:4136:e378:8000:63bf:3fff:fdd2" // client 192.0.2.45
+
+	tags, err := tree.FindTagsString(teredo)
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"v6-0", "teredo"}, tags)
+
+	tree.SetEmbeddedIPv4(patricia.EmbeddedIPv4{Teredo: true})
+	tags, err = tree.FindTagsString(teredo)
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"v6-0", "teredo", "v4-24"}, tags)
+	found, tag, err := tree.FindDeepestTagAddr(netip.MustParseAddr(teredo))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v4-24", tag)
+
+	// embedded addresses without tags fall back to the IPv6 tags
+	found, tag, err = tree.FindDeepestTagString("2001:0000:4136:e378:8000:63bf:ffff:fffe") // client 0.0.0.1
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "teredo", tag)
+
+	addr := netip.MustParseAddr(teredo)
+	buf := make([]GeneratedType, 0, 10)
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		buf, _ = tree.FindTagsAddrAppend(buf[:0], addr)
+	}))
+	assert.Equal(t, []GeneratedType{"v6-0", "teredo", "v4-24"}, buf)
+
+	tree.SetEmbeddedIPv4(patricia.EmbeddedIPv4{})
+	tags, _ = tree.FindTagsString(teredo)
+	assert.Equal(t, []GeneratedType{"v6-0", "teredo"}, tags)
+}
+
+func TestTreeRange(t *testing.T) {
+	tree := NewTree()
+	count, err := tree.AddRangeString("10.0.0.5-10.0.0.10", "v4", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	count, err = tree.AddRangeString("10.1.*.*", "wildcard", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = tree.SetRangeString("2001:db8::-2001:db8::1:ffff", "v6")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	tags, _ := tree.FindTagsString("10.0.0.8")
+	assert.Equal(t, []GeneratedType{"v4"}, tags)
+	tags, _ = tree.FindTagsString("10.0.0.11")
+	assert.Equal(t, 0, len(tags))
+	tags, _ = tree.FindTagsString("10.1.200.3")
+	assert.Equal(t, []GeneratedType{"wildcard"}, tags)
+	tags, _ = tree.FindTagsString("2001:db8::1:1")
+	assert.Equal(t, []GeneratedType{"v6"}, tags)
+
+	count, err = tree.DeleteRangeString("10.0.0.5-10.0.0.10", func(payload GeneratedType, val GeneratedType) bool {
+		return payload == val
+	}, "v4")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 2, tree.CountTags())
+
+	_, err = tree.AddRangeString("10.0.0.5-::1", "mixed", nil)
+	assert.Error(t, err)
+	_, err = tree.SetRangeString("nope", "nope")
+	assert.Error(t, err)
+	_, err = tree.DeleteRangeString("10.0.0.2-10.0.0.1", nil, nil)
+	assert.Error(t, err)
+
+	// IPv4-mapped ranges follow the parser's policy
+	tree.SetParser(patricia.Parser{Mapped: patricia.MappedUnmap})
+	count, err = tree.AddRangeString("::ffff:192.0.2.0-::ffff:192.0.2.255", "mapped", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	tags, _ = tree.V4().FindTags(patricia.NewIPv4Address(0xc0000201, 32))
+	assert.Equal(t, []GeneratedType{"mapped"}, tags)
+}
@@ -0,0 +1,112 @@
+package template
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+// effectiveTagsV4 is the brute-force reference for aggregation: the tags of the longest prefix containing the address
+func effectiveTagsV4(prefixes map[patricia.IPv4Address][]GeneratedType, address uint32) []GeneratedType {
+	for length := 32; length >= 0; length-- {
+		prefix := patricia.NewIPv4Address(address&^(uint32(0xffffffff)>>uint(length)), uint(length))
+		if length == 0 {
+			prefix.Address = 0
+		}
+		if tags, ok := prefixes[prefix]; ok {
+			return tags
+		}
+	}
+	return nil
+}
+
+func TestAggregate(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	tagSets := [][]GeneratedType{{"a"}, {"b"}, {"a", "b"}, {"b", "a"}}
+
+	for i := 0; i < 50; i++ {
+		// random prefixes within 10.0.0.0/22, many of them siblings, or nested, with the same tags
+		tree := NewTreeV4()
+		prefixes := make(map[patricia.IPv4Address][]GeneratedType)
+		if random.Intn(2) == 0 {
+			tree.Add(patricia.IPv4Address{}, "a", nil)
+			prefixes[patricia.IPv4Address{}] = []GeneratedType{"a"}
+		}
+		for j := 0; j < 5+random.Intn(200); j++ {
+			length := uint(22 + random.Intn(11))
+			address := patricia.NewIPv4Address((0x0a000000|uint32(random.Intn(1<<10)))&^(uint32(0xffffffff)>>length), length)
+			if _, ok := prefixes[address]; ok {
+				continue
+			}
+			tags := tagSets[random.Intn(len(tagSets))]
+			for _, tag := range tags {
+				tree.Add(address, tag, nil)
+			}
+			prefixes[address] = tags
+		}
+
+		aggregated := tree.Aggregate(nil)
+		aggregatedPrefixes := make(map[patricia.IPv4Address][]GeneratedType)
+		for address, tags := range aggregated.All() {
+			aggregatedPrefixes[address] = tags
+		}
+		assert.True(t, len(aggregatedPrefixes) <= len(prefixes))
+
+		for _, address := range []uint32{0, 0x09ffffff, 0x0a000400, 0xffffffff} {
+			assert.Equal(t, effectiveTagsV4(prefixes, address), effectiveTagsV4(aggregatedPrefixes, address))
+		}
+		for address := uint32(0x0a000000); address < 0x0a000400; address++ {
+			expected := effectiveTagsV4(prefixes, address)
+			if !assert.Equal(t, expected, effectiveTagsV4(aggregatedPrefixes, address), "%08x", address) {
+				break
+			}
+			_, tags, _ := aggregated.FindDeepestMatch(patricia.NewIPv4Address(address, 32))
+			if len(expected) > 0 {
+				assert.Equal(t, expected, tags)
+			}
+		}
+
+		// aggregating again changes nothing
+		again := make(map[patricia.IPv4Address][]GeneratedType)
+		for address, tags := range aggregated.Aggregate(nil).All() {
+			again[address] = tags
+		}
+		assert.Equal(t, aggregatedPrefixes, again)
+	}
+}
+
+func TestAggregateExamples(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "a", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), "b", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 1, 0}, 24), "b", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 2, 0}, 23), "b", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 2, 7}, 32), "b", nil) // same as its ancestor
+	tree.Add(ipv4FromBytes([]byte{10, 0, 3, 7}, 32), "c", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 1, 0, 0}, 16), "a", nil) // same as its ancestor
+	tree.Add(ipv4FromBytes([]byte{192, 168, 0, 0}, 24), "X", nil)
+	tree.Add(ipv4FromBytes([]byte{192, 168, 1, 0}, 24), "x", nil)
+
+	prefixes := make([]string, 0)
+	tags := make([][]GeneratedType, 0)
+	for address, addressTags := range tree.Aggregate(nil).All() {
+		prefixes = append(prefixes, address.String())
+		tags = append(tags, addressTags)
+	}
+	assert.Equal(t, []string{"10.0.0.0/8", "10.0.0.0/22", "10.0.3.7/32", "192.168.0.0/24", "192.168.1.0/24"}, prefixes)
+	assert.Equal(t, [][]GeneratedType{{"a"}, {"b"}, {"c"}, {"X"}, {"x"}}, tags)
+
+	// with a custom comparison
+	caseInsensitive := func(payload GeneratedType, val GeneratedType) bool {
+		return payload == val || payload == "X" && val == "x" || payload == "x" && val == "X"
+	}
+	prefixes = prefixes[:0]
+	for address := range tree.Aggregate(caseInsensitive).All() {
+		prefixes = append(prefixes, address.String())
+	}
+	assert.Equal(t, []string{"10.0.0.0/8", "10.0.0.0/22", "10.0.3.7/32", "192.168.0.0/23"}, prefixes)
+
+	assert.Equal(t, 0, NewTreeV4().Aggregate(nil).countTags(1))
+}
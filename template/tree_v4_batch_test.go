@@ -0,0 +1,103 @@
+package template
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func batchTestAddressesV4(tree *TreeV4) []patricia.IPv4Address {
+	random := rand.New(rand.NewSource(1))
+	var addresses []patricia.IPv4Address
+	for address := range tree.All() {
+		// the prefix itself, a host within it, and a shorter prefix covering it
+		addresses = append(addresses, address)
+		host := patricia.NewIPv4Address(address.Address|(random.Uint32()>>address.Length), 32)
+		if address.Length == 0 {
+			host.Address = random.Uint32()
+		}
+		addresses = append(addresses, host)
+		addresses = append(addresses, patricia.NewIPv4Address(host.Address, uint(random.Intn(33))))
+	}
+	for i := 0; i < 1000; i++ {
+		addresses = append(addresses, patricia.NewIPv4Address(random.Uint32(), 32))
+	}
+	return addresses
+}
+
+func BenchmarkFindTagsBatchSorted(b *testing.B) {
+	tree := loadTestTagsV4(b)
+	addresses := batchTestAddressesV4(tree)
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Address < addresses[j].Address })
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		tree.FindTagsBatch(addresses, func(i int, tags []GeneratedType) {})
+	}
+}
+
+func BenchmarkFindTagsSorted(b *testing.B) {
+	tree := loadTestTagsV4(b)
+	addresses := batchTestAddressesV4(tree)
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Address < addresses[j].Address })
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, address := range addresses {
+			tree.FindTags(address)
+		}
+	}
+}
+
+func TestFindTagsBatch(t *testing.T) {
+	tree := loadTestTagsV4(t)
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	addresses := batchTestAddressesV4(tree)
+
+	check := func() {
+		calls := 0
+		tree.FindTagsBatch(addresses, func(i int, tags []GeneratedType) {
+			assert.Equal(t, calls, i)
+			calls++
+			expected, _ := tree.FindTags(addresses[i])
+			assert.Equal(t, expected, tags, "%d", i)
+		})
+		assert.Equal(t, len(addresses), calls)
+
+		calls = 0
+		tree.FindDeepestTagBatch(addresses, func(i int, found bool, tag GeneratedType) {
+			assert.Equal(t, calls, i)
+			calls++
+			expectedFound, expectedTag, _ := tree.FindDeepestTag(addresses[i])
+			assert.Equal(t, expectedFound, found)
+			assert.Equal(t, expectedTag, tag)
+		})
+		assert.Equal(t, len(addresses), calls)
+	}
+
+	// in the order they were generated, sorted, and shuffled
+	check()
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Address < addresses[j].Address })
+	check()
+	rand.New(rand.NewSource(2)).Shuffle(len(addresses), func(i, j int) { addresses[i], addresses[j] = addresses[j], addresses[i] })
+	check()
+}
+
+func TestFindTagsBatchEmpty(t *testing.T) {
+	tree := NewTreeV4()
+	addresses := []patricia.IPv4Address{{}, ipv4FromBytes([]byte{10, 0, 0, 1}, 32), ipv4FromBytes([]byte{10, 0, 0, 2}, 32)}
+
+	tree.FindTagsBatch(addresses, func(i int, tags []GeneratedType) {
+		assert.Equal(t, 0, len(tags))
+	})
+	tree.FindDeepestTagBatch(addresses, func(i int, found bool, tag GeneratedType) {
+		assert.False(t, found)
+		assert.Nil(t, tag)
+	})
+	tree.FindTagsBatch(nil, func(i int, tags []GeneratedType) {
+		t.Error("shouldn't be called")
+	})
+}
@@ -7,10 +7,91 @@ import (
 	"github.com/stretchr/testify/assert"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 )
 
+// readTestTagsV4 returns the IPv4 addresses in test_tags.tsv, and their tags
+func readTestTagsV4(tb testing.TB) ([]patricia.IPv4Address, []string) {
+	file, err := os.Open("./test_tags.tsv")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+
+	var addresses []patricia.IPv4Address
+	var tags []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		v4, _, err := patricia.ParseIPFromString(parts[0])
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if v4 != nil {
+			addresses = append(addresses, *v4)
+			tags = append(tags, parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return addresses, tags
+}
+
+// tags per address in the bulk benchmarks, to show the cost of nodes with several tags
+var bulkTagCounts = []int{1, 8}
+
+func BenchmarkBulkAdd(b *testing.B) {
+	addresses, tags := readTestTagsV4(b)
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	for _, tagCount := range bulkTagCounts {
+		b.Run(strconv.Itoa(tagCount), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				tree := NewTreeV4()
+				for j := 0; j < tagCount; j++ {
+					for i, address := range addresses {
+						tree.Add(address, tags[i]+strconv.Itoa(j), matchFunc)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBulkDelete(b *testing.B) {
+	addresses, tags := readTestTagsV4(b)
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	for _, tagCount := range bulkTagCounts {
+		b.Run(strconv.Itoa(tagCount), func(b *testing.B) {
+			tagged := make([][]GeneratedType, tagCount)
+			tree := NewTreeV4()
+			for j := range tagged {
+				tagged[j] = make([]GeneratedType, len(tags))
+				for i, address := range addresses {
+					tagged[j][i] = tags[i] + strconv.Itoa(j)
+					tree.Add(address, tagged[j][i], nil)
+				}
+			}
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				clone := tree.Clone()
+				b.StartTimer()
+
+				// delete the first tags added, so every delete has to keep the rest of the node's tags
+				for _, nodeTags := range tagged {
+					for i, address := range addresses {
+						clone.Delete(address, matchFunc, nodeTags[i])
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestBulkLoad(t *testing.T) {
 	// Test bulk loading
 	filePath := "./test_tags.tsv"
@@ -114,6 +195,7 @@ func TestBulkLoad(t *testing.T) {
 	evaluate()
 	nodesCapacity := cap(tree.nodes)
 	nodesLength := len(tree.nodes)
+	slabLength := len(tree.tags.slots)
 	fmt.Printf("Finished first pass - node capacity: %d\n", cap(tree.nodes))
 
 	// do it again a few times, and make sure the nodes array hasn't grown
@@ -127,6 +209,7 @@ func TestBulkLoad(t *testing.T) {
 	evaluate()
 	assert.Equal(t, nodesLength, len(tree.nodes))
 	assert.Equal(t, nodesCapacity, cap(tree.nodes))
+	assert.Equal(t, slabLength, len(tree.tags.slots), "tag blocks should be reused")
 	fmt.Printf("Finished looping, finding, deleting - Tree now has %d tags in %d nodes\n", tree.countTags(1), tree.countNodes(1))
 
 	// now try cloning
@@ -0,0 +1,112 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompact(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	addresses, tags := readTestTagsV4(t)
+
+	tree := NewTreeV4()
+	for i, address := range addresses {
+		tree.Add(address, tags[i], nil)
+		tree.Add(address, tags[i]+"-extra", nil)
+	}
+	peakCapacity := cap(tree.nodes)
+
+	// purge most of it
+	for i, address := range addresses {
+		if i%10 != 0 {
+			tree.Delete(address, matchFunc, tags[i])
+			tree.Delete(address, matchFunc, tags[i]+"-extra")
+		}
+	}
+	type entry struct {
+		address patricia.IPv4Address
+		tags    []GeneratedType
+	}
+	var expected []entry
+	for address, tags := range tree.All() {
+		expected = append(expected, entry{address, tags})
+	}
+	nodeCount := tree.countNodes(1)
+	tagCount := tree.countTags(1)
+	freeCount := len(tree.availableIndexes)
+	slabLength := len(tree.tags.slots)
+
+	stats := tree.Compact()
+	assert.Equal(t, nodeCount, stats.Nodes)
+	assert.Equal(t, freeCount, stats.NodesReclaimed)
+	assert.Equal(t, peakCapacity, stats.NodeCapacityBefore)
+	assert.Equal(t, nodeCount+1, stats.NodeCapacityAfter)
+	assert.Equal(t, tagCount, stats.Tags)
+	assert.Equal(t, slabLength-tagCount, stats.TagSlotsReclaimed)
+	assert.True(t, stats.BytesReclaimed > 0)
+
+	// the nodes are dense, in depth-first order, and the tags packed
+	assert.Equal(t, nodeCount+1, len(tree.nodes))
+	assert.Equal(t, 0, len(tree.availableIndexes))
+	assert.Equal(t, tagCount, len(tree.tags.slots))
+	for i, nodeIndex := range tree.nodeOrder() {
+		assert.Equal(t, uint(i+1), nodeIndex)
+	}
+
+	// with the same contents
+	var actual []entry
+	for address, tags := range tree.All() {
+		actual = append(actual, entry{address, tags})
+	}
+	assert.Equal(t, expected, actual)
+	for i, address := range addresses {
+		found, tag, err := tree.FindDeepestTag(address)
+		assert.NoError(t, err)
+		if i%10 == 0 {
+			assert.True(t, found)
+			assert.Equal(t, tags[i], tag)
+		}
+	}
+
+	// compacting again has nothing left to reclaim
+	stats = tree.Compact()
+	assert.Equal(t, 0, stats.NodesReclaimed)
+	assert.Equal(t, 0, stats.TagSlotsReclaimed)
+	assert.Equal(t, 0, stats.BytesReclaimed)
+
+	// and the tree keeps working
+	for i, address := range addresses {
+		if i%10 == 0 {
+			count, err := tree.Delete(address, matchFunc, tags[i])
+			assert.NoError(t, err)
+			assert.Equal(t, 1, count)
+			tree.Add(address, "new", nil)
+		}
+	}
+	for i, address := range addresses {
+		if i%10 == 0 {
+			exact, _ := tree.GetExact(address)
+			assert.Equal(t, []GeneratedType{tags[i] + "-extra", "new"}, exact)
+		}
+	}
+}
+
+func TestCompactEmpty(t *testing.T) {
+	tree := NewTreeV4()
+	stats := tree.Compact()
+	assert.Equal(t, CompactStats{Nodes: 1, NodeCapacityBefore: 2, NodeCapacityAfter: 2}, stats)
+
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A", nil)
+	tree.Delete(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), func(a GeneratedType, b GeneratedType) bool { return true }, nil)
+	stats = tree.Compact()
+	assert.Equal(t, 1, stats.Nodes)
+	assert.Equal(t, 1, stats.NodesReclaimed)
+	assert.Equal(t, 2, len(tree.nodes))
+	assert.Equal(t, 0, len(tree.tags.slots))
+
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	tags, _ := tree.FindTags(ipv4FromBytes([]byte{10, 0, 0, 0}, 8))
+	assert.Equal(t, []GeneratedType{"root"}, tags)
+}
@@ -0,0 +1,144 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func BenchmarkFindTagsFrozen(b *testing.B) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "tagD", nil) // default
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+	frozen := tree.Freeze()
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		address := patricia.NewIPv4Address(uint32(2156823809), 32)
+		frozen.FindTags(address)
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	tree := loadTestTagsV4(t)
+
+	// leave a few free slots behind, which shouldn't be carried over
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	for _, address := range []string{"1.0.0.0/1", "184.0.0.0/8", "48.135.26.0/24"} {
+		v4, _, _ := patricia.ParseIPFromString(address)
+		tags, _ := tree.GetExact(*v4)
+		tree.Delete(*v4, matchFunc, tags[0])
+	}
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "ten", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "TEN", nil)
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+
+	frozen := tree.Freeze()
+	assert.Equal(t, tree.countNodes(1)+1, len(frozen.nodes))
+	assert.Equal(t, tree.countTags(1), len(frozen.tags))
+
+	// every prefix, every lookup
+	var addresses []patricia.IPv4Address
+	var tags [][]GeneratedType
+	for address, nodeTags := range tree.All() {
+		addresses = append(addresses, address)
+		tags = append(tags, nodeTags)
+	}
+	var frozenAddresses []patricia.IPv4Address
+	var frozenTags [][]GeneratedType
+	for address, nodeTags := range frozen.All() {
+		frozenAddresses = append(frozenAddresses, address)
+		frozenTags = append(frozenTags, nodeTags)
+	}
+	assert.Equal(t, addresses, frozenAddresses)
+	assert.Equal(t, tags, frozenTags)
+
+	filterFunc := func(tag GeneratedType) bool { return tag != "root" }
+	for _, address := range append(addresses, ipv4FromBytes([]byte{10, 1, 2, 3}, 32), ipv4FromBytes([]byte{10, 1, 2, 3}, 4)) {
+		expected, _ := tree.FindTags(address)
+		found, err := frozen.FindTags(address)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, found)
+
+		expected, _ = tree.FindTagsWithFilter(address, filterFunc)
+		found, err = frozen.FindTagsWithFilter(address, filterFunc)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, found)
+
+		expectedFound, expectedTag, _ := tree.FindDeepestTag(address)
+		foundDeepest, tag, err := frozen.FindDeepestTag(address)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedFound, foundDeepest)
+		assert.Equal(t, expectedTag, tag)
+
+		expectedAddress, expected, expectedFound := tree.FindDeepestMatch(address)
+		matchAddress, found, foundDeepest := frozen.FindDeepestMatch(address)
+		assert.Equal(t, expectedAddress, matchAddress)
+		assert.Equal(t, expected, found)
+		assert.Equal(t, expectedFound, foundDeepest)
+
+		expected, expectedFound = tree.GetExact(address)
+		found, foundDeepest = frozen.GetExact(address)
+		assert.Equal(t, expected, found)
+		assert.Equal(t, expectedFound, foundDeepest)
+		assert.Equal(t, tree.HasExact(address), frozen.HasExact(address))
+	}
+
+	// subtrees
+	for _, address := range []patricia.IPv4Address{{}, ipv4FromBytes([]byte{10, 0, 0, 0}, 8), ipv4FromBytes([]byte{128, 0, 0, 0}, 3), ipv4FromBytes([]byte{48, 0, 0, 0}, 12)} {
+		expectedAddresses, expectedTags, _ := tree.FindTagsUnder(address)
+		foundAddresses, foundTags, err := frozen.FindTagsUnder(address)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedAddresses, foundAddresses)
+		assert.Equal(t, expectedTags, foundTags)
+	}
+
+	// the frozen tree doesn't change with the original
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "later", nil)
+	found, _ := frozen.GetExact(ipv4FromBytes([]byte{10, 0, 0, 0}, 8))
+	assert.Equal(t, []GeneratedType{"ten", "TEN"}, found)
+}
+
+func TestFreezeEmpty(t *testing.T) {
+	frozen := NewTreeV4().Freeze()
+	tags, err := frozen.FindTags(ipv4FromBytes([]byte{10, 0, 0, 0}, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tags))
+	found, _, err := frozen.FindDeepestTag(ipv4FromBytes([]byte{10, 0, 0, 0}, 8))
+	assert.NoError(t, err)
+	assert.False(t, found)
+	_, _, found = frozen.FindDeepestMatch(patricia.IPv4Address{})
+	assert.False(t, found)
+	assert.False(t, frozen.HasExact(patricia.IPv4Address{}))
+}
+
+func TestFrozenFindTagsAppend(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "tagZ", nil) // default
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+	frozen := tree.Freeze()
+
+	address := ipv4FromBytes([]byte{128, 3, 6, 240}, 32)
+	assert.Equal(t, tree.FindTagsAppend(nil, address), frozen.FindTagsAppend(nil, address))
+
+	filterFunc := func(tag GeneratedType) bool { return tag != "tagB" }
+	assert.Equal(t, tree.FindTagsWithFilterAppend(nil, address, filterFunc), frozen.FindTagsWithFilterAppend(nil, address, filterFunc))
+
+	var visited []GeneratedType
+	frozen.VisitTags(address, func(tag GeneratedType) bool {
+		visited = append(visited, tag)
+		return len(visited) < 3
+	})
+	assert.Equal(t, []GeneratedType{"tagZ", "tagB", "tagA"}, visited)
+
+	buf := make([]GeneratedType, 0, 8)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = frozen.FindTagsAppend(buf[:0], address)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
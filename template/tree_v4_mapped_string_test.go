@@ -0,0 +1,224 @@
+//go:build ignore
+
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappedTreeBulkLoad(t *testing.T) {
+	// this only builds into string_tree, which doesn't have its own copy of the test tags
+	file, err := os.Open("../template/test_tags.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tree := NewTreeV4()
+	var addresses []patricia.IPv4Address
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		v4, _, err := patricia.ParseIPFromString(parts[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Add(*v4, parts[1], nil)
+		addresses = append(addresses, *v4)
+	}
+
+	path := filepath.Join(t.TempDir(), "tree.mapped")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tree.WriteMappedTo(out)
+	assert.NoError(t, err)
+	assert.NoError(t, out.Close())
+
+	mapped, err := OpenMappedTreeV4(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, address := range addresses {
+		expectedTags, _ := tree.FindTags(address)
+		tags, err := mapped.FindTags(address)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedTags, tags)
+
+		expectedFound, expectedTag, _ := tree.FindDeepestTag(address)
+		found, tag, err := mapped.FindDeepestTag(address)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedFound, found)
+		assert.Equal(t, expectedTag, tag)
+	}
+
+	// strings are still usable once the mapping is gone
+	tags, _ := mapped.FindTags(addresses[0])
+	assert.NoError(t, mapped.Close())
+	assert.Equal(t, "11111", tags[0])
+}
+
+func TestMappedTreeV6(t *testing.T) {
+	tree := NewTreeV6()
+	for i := 0; i < 128; i++ {
+		tree.Add(patricia.IPv6Address{Left: 0x20010db800000000, Right: 1, Length: uint(i)}, strconv.Itoa(i), nil)
+	}
+
+	var buf bytes.Buffer
+	_, err := tree.WriteMappedTo(&buf)
+	assert.NoError(t, err)
+	mapped, err := NewMappedTreeV6(buf.Bytes())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	address := patricia.IPv6Address{Left: 0x20010db800000000, Right: 1, Length: 128}
+	expectedTags, _ := tree.FindTags(address)
+	tags, err := mapped.FindTags(address)
+	assert.NoError(t, err)
+	assert.Equal(t, 128, len(tags))
+	assert.Equal(t, expectedTags, tags)
+
+	found, tag, err := mapped.FindDeepestTag(address)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "127", tag)
+
+	// IPv6 data can't be opened as an IPv4 tree
+	_, err = NewMappedTreeV4(buf.Bytes())
+	assert.Error(t, err)
+}
+
+func TestMappedTreeErrors(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 8), "ten", nil)
+	data := mustWriteMappedV4(t, tree)
+
+	// truncated
+	_, err := NewMappedTreeV4(data[:len(data)-1])
+	assert.Error(t, err)
+
+	// not a mapped tree - the serialized form is different
+	serialized, _ := tree.MarshalBinary()
+	_, err = NewMappedTreeV4(serialized)
+	assert.Error(t, err)
+
+	// missing file
+	_, err = OpenMappedTreeV4(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestMappedTreeStringTableFull(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 8), "ten", nil)
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 16), "ten", nil)
+	tree.Add(patricia.NewIPv4Address(0x0b000000, 8), "eleven", nil)
+
+	// repeated strings take no more room, so "ten" fits, but "eleven" doesn't
+	defer func(max uint64) { maxMappedStringBytes = max }(maxMappedStringBytes)
+	maxMappedStringBytes = 8
+	var buf bytes.Buffer
+	_, err := tree.WriteMappedTo(&buf)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "mapped string table is full")
+	}
+	assert.Equal(t, 0, buf.Len())
+
+	maxMappedStringBytes = 9
+	_, err = tree.WriteMappedTo(&buf)
+	assert.NoError(t, err)
+	mapped, err := NewMappedTreeV4(buf.Bytes())
+	if assert.NoError(t, err) {
+		tags, err := mapped.FindTags(patricia.NewIPv4Address(0x0b000001, 32))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"eleven"}, tags)
+	}
+}
+
+func TestMappedTreeStructure(t *testing.T) {
+	// mapped in depth-first order: the root is node 1, 10.0.0.0/8 node 2, 10.0.0.0/9 node 3, and 10.128.0.0/9 node 4
+	tree := NewTreeV4()
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 8), "ten", nil)
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 9), "left", nil)
+	tree.Add(patricia.NewIPv4Address(0x0a800000, 9), "right", nil)
+	data := mustWriteMappedV4(t, tree)
+	_, err := NewMappedTreeV4(data)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		description string
+		nodeIndex   uint
+		change      func(node *treeNodeV4, tagOffset *uint32)
+		expected    string
+	}{
+		{"cycle to the root", 2, func(node *treeNodeV4, tagOffset *uint32) { node.Left = 1 }, "found node 1 where node 3 was expected"},
+		{"node reached twice", 2, func(node *treeNodeV4, tagOffset *uint32) { node.Left = 4 }, "found node 4 where node 3 was expected"},
+		{"child outside of the tree", 2, func(node *treeNodeV4, tagOffset *uint32) { node.Right = 99 }, "found node 99 where node 4 was expected"},
+		{"unreachable node", 2, func(node *treeNodeV4, tagOffset *uint32) { node.Right = 0 }, "3 of the 4 nodes are reachable"},
+		{"prefix on the root", 1, func(node *treeNodeV4, tagOffset *uint32) { node.prefixLength = 1 }, "node 1 has a 1 bit prefix"},
+		{"node without a prefix", 3, func(node *treeNodeV4, tagOffset *uint32) { node.prefixLength = 0 }, "node 3 has a 0 bit prefix"},
+		{"prefix longer than an address", 3, func(node *treeNodeV4, tagOffset *uint32) { node.prefixLength = 32 }, "node 3 has a 40 bit full prefix"},
+		{"tags out of order", 3, func(node *treeNodeV4, tagOffset *uint32) { *tagOffset = 0 }, "node 3's tags start at 0, expected 1"},
+		{"tags outside of the tree", 4, func(node *treeNodeV4, tagOffset *uint32) { node.TagCount = 2 }, "nodes have 4 tags, expected 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			corrupt := bytes.Clone(data)
+			var mapped MappedTreeV4
+			assert.NoError(t, mapped.init(corrupt, mapped.addressFamily(), _treeNodeV4MappedSize))
+			rewriteMappedNodeV4(t, &mapped, tt.nodeIndex, tt.change)
+
+			_, err := NewMappedTreeV4(corrupt)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.expected)
+			}
+		})
+	}
+
+	// data changed once it's open can't make lookups loop forever
+	corrupt := bytes.Clone(data)
+	mapped, err := NewMappedTreeV4(corrupt)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rewriteMappedNodeV4(t, mapped, 3, func(node *treeNodeV4, tagOffset *uint32) {
+		node.Left = 3
+		node.prefixLength = 0
+	})
+	_, err = mapped.FindTags(patricia.NewIPv4Address(0x0a000000, 32))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "more than 32 nodes deep")
+	}
+	_, _, err = mapped.FindDeepestTag(patricia.NewIPv4Address(0x0a000000, 32))
+	assert.Error(t, err)
+}
+
+// rewriteMappedNodeV4 changes a node's record in place
+func rewriteMappedNodeV4(t *testing.T, mapped *MappedTreeV4, nodeIndex uint, change func(node *treeNodeV4, tagOffset *uint32)) {
+	node, tagOffset, err := mapped.node(nodeIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(&node, &tagOffset)
+	record := node.EncodeBinary(mapped.nodes[nodeIndex*_treeNodeV4MappedSize:][:0])
+	binary.LittleEndian.AppendUint32(record, tagOffset)
+}
+
+func mustWriteMappedV4(t *testing.T, tree *TreeV4) []byte {
+	var buf bytes.Buffer
+	if _, err := tree.WriteMappedTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
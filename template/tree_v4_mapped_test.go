@@ -0,0 +1,66 @@
+package template
+
+// the template's placeholder payload type is an interface, which can't be mapped - mapped trees are tested with
+// string and uint32 payloads in tree_v4_mapped_string_test.go and tree_v4_mapped_uint32_test.go, which only build
+// into those trees
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappedTreeV4Payload(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "ten", nil)
+
+	// payload types with pointers can't be mapped
+	var buf bytes.Buffer
+	_, err := tree.WriteMappedTo(&buf)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "pointers")
+	}
+	assert.Equal(t, 0, buf.Len())
+
+	// or opened
+	_, err = NewMappedTreeV4(make([]byte, 64))
+	assert.Error(t, err)
+}
+
+func TestTypeHasPointers(t *testing.T) {
+	type flat struct {
+		A uint32
+		B [2]float64
+		C bool
+	}
+	type nested struct {
+		A flat
+		B [0]*int
+	}
+	for _, value := range []any{true, 1, uint8(1), 1.5, complex64(1), [4]byte{}, flat{}, nested{}} {
+		assert.False(t, typeHasPointers(reflect.TypeOf(value)), "%T", value)
+	}
+
+	type pointer struct {
+		A uint32
+		B *int
+	}
+	type sliced struct {
+		A flat
+		B []byte
+	}
+	for _, value := range []any{"", []byte{}, map[int]int{}, pointer{}, sliced{}, [1]string{}, new(int)} {
+		assert.True(t, typeHasPointers(reflect.TypeOf(value)), "%T", value)
+	}
+	var tag GeneratedType
+	assert.True(t, typeHasPointers(reflect.TypeOf(&tag).Elem()))
+}
+
+func TestMappedPadding(t *testing.T) {
+	assert.Equal(t, int64(0), mappedPadding(0))
+	assert.Equal(t, int64(7), mappedPadding(1))
+	assert.Equal(t, int64(1), mappedPadding(15))
+	assert.Equal(t, int64(0), mappedPadding(16))
+}
@@ -0,0 +1,91 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRange(t *testing.T) {
+	tree := NewTreeV4()
+	start, end := ipv4FromBytes([]byte{10, 0, 0, 5}, 32), ipv4FromBytes([]byte{10, 0, 3, 200}, 32)
+
+	count, err := tree.AddRange(start, end, "pool", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 13, count)
+	assert.Equal(t, 13, tree.countTags(1))
+
+	// every address in the range, and none outside it, is tagged
+	for address := uint32(0x0a000000); address < 0x0a000400; address++ {
+		tags, _ := tree.FindTags(patricia.NewIPv4Address(address, 32))
+		if address >= start.Address && address <= end.Address {
+			assert.Equal(t, []GeneratedType{"pool"}, tags, "%08x", address)
+		} else {
+			assert.Equal(t, 0, len(tags), "%08x", address)
+		}
+	}
+
+	// adding it again, with a match function, changes nothing
+	count, err = tree.AddRange(start, end, "pool", func(payload GeneratedType, val GeneratedType) bool {
+		return payload == val
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	count, err = tree.SetRange(start, end, "dhcp")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	tags, _ := tree.FindTags(ipv4FromBytes([]byte{10, 0, 2, 1}, 32))
+	assert.Equal(t, []GeneratedType{"dhcp"}, tags)
+
+	count, err = tree.DeleteRange(start, end, func(payload GeneratedType, val GeneratedType) bool {
+		return payload == val
+	}, "dhcp")
+	assert.NoError(t, err)
+	assert.Equal(t, 13, count)
+	assert.Equal(t, 0, tree.countTags(1))
+	assert.Equal(t, 1, tree.countNodes(1))
+
+	// the ends can be prefixes
+	count, err = tree.AddRange(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), ipv4FromBytes([]byte{10, 0, 3, 0}, 24), "block", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	tags, _ = tree.FindTags(ipv4FromBytes([]byte{10, 0, 3, 255}, 32))
+	assert.Equal(t, []GeneratedType{"block"}, tags)
+
+	_, err = tree.AddRange(end, start, "backwards", nil)
+	assert.Error(t, err)
+	_, err = tree.DeleteRange(end, start, nil, "backwards")
+	assert.Error(t, err)
+}
+
+func TestRangePartialFailure(t *testing.T) {
+	tree := NewTreeV4()
+	start, end := ipv4FromBytes([]byte{10, 0, 0, 5}, 32), ipv4FromBytes([]byte{10, 0, 3, 200}, 32)
+
+	// leave room for only some of the range's 13 prefixes
+	defer func(max uint64) { maxTagSlots = max }(maxTagSlots)
+	maxTagSlots = uint64(len(tree.tags.slots)) + 5
+	count, err := tree.AddRange(start, end, "pool", nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "tag slab is full")
+	}
+
+	// the prefixes added before the failure are kept, and counted
+	assert.True(t, count > 0 && count < 13, "%d", count)
+	assert.Equal(t, count, tree.countTags(1))
+	tags, _ := tree.FindTags(start)
+	assert.Equal(t, []GeneratedType{"pool"}, tags)
+	tags, _ = tree.FindTags(end)
+	assert.Equal(t, 0, len(tags))
+	maxTagSlots = uint64(^uint32(0))
+
+	// and adding the range again, with a match function, adds the rest
+	rest, err := tree.AddRange(start, end, "pool", func(payload GeneratedType, val GeneratedType) bool {
+		return payload == val
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 13, count+rest)
+	assert.Equal(t, 13, tree.countTags(1))
+}
@@ -0,0 +1,236 @@
+package template
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestTagsV4(t testing.TB) *TreeV4 {
+	file, err := os.Open("./test_tags.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tree := NewTreeV4()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		v4, _, err := patricia.ParseIPFromString(parts[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Add(*v4, parts[1], nil)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	data, err := loadTestTagsV4(b).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		NewTreeV4().UnmarshalBinary(data)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	tree := loadTestTagsV4(t)
+
+	// delete a few, so there are available indexes to carry over
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	for _, address := range []string{"1.0.0.0/1", "184.0.0.0/8", "48.135.26.0/24"} {
+		v4, _, _ := patricia.ParseIPFromString(address)
+		tags, _ := tree.GetExact(*v4)
+		tree.Delete(*v4, matchFunc, tags[0])
+	}
+	assert.True(t, len(tree.availableIndexes) > 0)
+
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+
+	loaded := NewTreeV4()
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	assertSameNodesV4(t, tree, loaded)
+	assert.Equal(t, tree.availableIndexes, loaded.availableIndexes)
+
+	// the loaded tree keeps working
+	v4, _, _ := patricia.ParseIPFromString("140.151.0.0/16")
+	found, tag, err := loaded.FindDeepestTag(*v4)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "44444", tag)
+	loaded.Add(*v4, "more", nil)
+	tags, _ := loaded.GetExact(*v4)
+	assert.Equal(t, []GeneratedType{"44444", "more"}, tags)
+
+	// streaming
+	var buf bytes.Buffer
+	written, err := tree.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), written)
+	assert.Equal(t, data, buf.Bytes())
+
+	loaded = NewTreeV4()
+	read, err := loaded.ReadFrom(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, written, read)
+	assertSameNodesV4(t, tree, loaded)
+}
+
+func TestMarshalBinaryEmpty(t *testing.T) {
+	data, err := NewTreeV4().MarshalBinary()
+	assert.NoError(t, err)
+
+	loaded := NewTreeV4()
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	assert.Equal(t, 2, len(loaded.nodes))
+	assert.Equal(t, 0, len(loaded.tags.slots))
+
+	loaded.Add(ipv4FromBytes([]byte{1, 2, 3, 4}, 32), "A", nil)
+	assert.True(t, loaded.HasExact(ipv4FromBytes([]byte{1, 2, 3, 4}, 32)))
+}
+
+func TestUnmarshalBinaryErrors(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{1, 2, 3, 4}, 32), "A", nil)
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+
+	// different payload type
+	wrongType := bytes.Replace(data, []byte("GeneratedType"), []byte("GeneratedTypo"), 1)
+	err = NewTreeV4().UnmarshalBinary(wrongType)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "payload type")
+	}
+
+	// different address family
+	err = NewTreeV6().UnmarshalBinary(data)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "IPv4")
+	}
+
+	// not a tree at all
+	assert.Error(t, NewTreeV4().UnmarshalBinary([]byte("hello, world")))
+
+	// corrupted
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-10] ^= 0xff
+	err = NewTreeV4().UnmarshalBinary(corrupted)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "checksum")
+	}
+
+	// truncated
+	loaded := NewTreeV4()
+	assert.Error(t, loaded.UnmarshalBinary(data[:len(data)-1]))
+
+	// failed loads leave the tree unchanged
+	assert.Equal(t, 2, len(loaded.nodes))
+}
+
+func TestUnmarshalBinaryStructure(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+
+	// loads the tree after corrupting its nodes, which the checksum can't catch, as it's written after them
+	load := func(corrupt func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint)) error {
+		tree := NewTreeV4()
+		tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "ten", nil)
+		tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 16), "left", nil)
+		tree.Add(ipv4FromBytes([]byte{10, 128, 0, 0}, 16), "right", nil)
+		tree.Add(ipv4FromBytes([]byte{11, 0, 0, 0}, 8), "eleven", nil)
+		tree.Delete(ipv4FromBytes([]byte{11, 0, 0, 0}, 8), matchFunc, "eleven")
+
+		ten := tree.nodes[1].Left
+		corrupt(tree, ten, tree.nodes[ten].Left, tree.nodes[ten].Right)
+		data, err := tree.MarshalBinary()
+		assert.NoError(t, err)
+
+		loaded := NewTreeV4()
+		err = loaded.UnmarshalBinary(data)
+		if err != nil {
+			assert.Equal(t, 2, len(loaded.nodes))
+		}
+		return err
+	}
+
+	assert.NoError(t, load(func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {}))
+
+	for name, corrupt := range map[string]func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint){
+		"reached more than once": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[tenLeft].Left = tenRight
+		},
+		"reached more than once (cycle)": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[tenLeft].Right = ten
+		},
+		"reached more than once (root)": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[tenLeft].Right = 1
+		},
+		"has no prefix": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[tenRight].prefixLength = 0
+		},
+		"bit prefix": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[tenRight].prefixLength = 30
+		},
+		"wrong side": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[ten].Left, tree.nodes[ten].Right = tenRight, tenLeft
+		},
+		"wrong side (root)": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[1].Left, tree.nodes[1].Right = 0, ten
+		},
+		"node 0 is used": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[0].Left = tenLeft
+		},
+		"node 0 is used (tags)": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[0].TagCount = 1
+			tree.nodes[0].tags = tree.nodes[tenLeft].tags
+			tree.nodes[tenLeft].TagCount = 0
+		},
+		"root has": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[1].prefixLength = 1
+		},
+		"neither reachable nor available": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[ten].Right = 0
+		},
+		"already in use": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.availableIndexes[0] = tenRight
+		},
+		"already in use (duplicate)": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.availableIndexes = append(tree.availableIndexes, tree.availableIndexes[0])
+			tree.nodes = append(tree.nodes, treeNodeV4{})
+		},
+		"available index": func(tree *TreeV4, ten uint, tenLeft uint, tenRight uint) {
+			tree.nodes[tree.availableIndexes[0]].TagCount = 1
+			tree.nodes[tenLeft].TagCount = 0
+		},
+	} {
+		err := load(corrupt)
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), strings.Split(name, " (")[0], name)
+		}
+	}
+}
+
+// assertSameNodesV4 asserts that the trees have the same nodes, with the same tags, wherever the tags are kept in their slabs
+func assertSameNodesV4(t *testing.T, expected *TreeV4, actual *TreeV4) {
+	if !assert.Equal(t, len(expected.nodes), len(actual.nodes)) {
+		return
+	}
+	for i := range expected.nodes {
+		expectedNode, actualNode := expected.nodes[i], actual.nodes[i]
+		expectedNode.tags, actualNode.tags = tagBlock{}, tagBlock{}
+		assert.Equal(t, expectedNode, actualNode)
+		assert.Equal(t, expected.tagsForNode(uint(i)), actual.tagsForNode(uint(i)))
+	}
+}
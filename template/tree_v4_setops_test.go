@@ -0,0 +1,106 @@
+package template
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+// randomSetV4 returns a tree of random prefixes within 10.0.0.0/20, with some nested, and the addresses it covers
+func randomSetV4(random *rand.Rand, count int) (*TreeV4, map[uint32]bool) {
+	tree := NewTreeV4()
+	covered := make(map[uint32]bool)
+	for i := 0; i < count; i++ {
+		length := uint(20 + random.Intn(13))
+		address := patricia.NewIPv4Address(0x0a000000|uint32(random.Intn(1<<12)), length)
+		address.Address &= ^uint32(0) << (32 - length)
+		tree.Add(address, "in", nil)
+		for a := address.Address; a <= address.Address|(^uint32(0)>>length); a++ {
+			covered[a] = true
+		}
+	}
+	return tree, covered
+}
+
+// checkSetV4 checks that the tree covers exactly the addresses expected, and has as few prefixes as possible
+func checkSetV4(t *testing.T, tree *TreeV4, expected func(address uint32) bool) {
+	for _, address := range []uint32{0, 0x09ffffff, 0x0a001000, 0xffffffff} {
+		found, _, _ := tree.FindDeepestTag(patricia.NewIPv4Address(address, 32))
+		assert.Equal(t, expected(address), found, "%08x", address)
+	}
+	for address := uint32(0x0a000000); address < 0x0a001000; address++ {
+		found, _, _ := tree.FindDeepestTag(patricia.NewIPv4Address(address, 32))
+		if !assert.Equal(t, expected(address), found, "%08x", address) {
+			return
+		}
+	}
+
+	// no prefix within another, and no siblings that could have been merged
+	var prefixes []patricia.IPv4Address
+	for address, tags := range tree.All() {
+		assert.Equal(t, 1, len(tags))
+		for _, prefix := range prefixes {
+			assert.NotEqual(t, prefix.Length, prefix.CommonPrefixLength(address), "%s within %s", address, prefix)
+			siblings := prefix.Length == address.Length && prefix.CommonPrefixLength(address) == address.Length-1
+			assert.False(t, siblings, "%s and %s", prefix, address)
+		}
+		prefixes = append(prefixes, address)
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		a, inA := randomSetV4(random, 1+random.Intn(30))
+		b, inB := randomSetV4(random, 1+random.Intn(30))
+		outside := func(address uint32) bool { return address < 0x0a000000 || address >= 0x0a001000 }
+
+		checkSetV4(t, a.Union(b, "in"), func(address uint32) bool { return inA[address] || inB[address] })
+		checkSetV4(t, a.Intersect(b, "in"), func(address uint32) bool { return inA[address] && inB[address] })
+		checkSetV4(t, a.Difference(b, "in"), func(address uint32) bool { return inA[address] && !inB[address] })
+		checkSetV4(t, b.Difference(a, "in"), func(address uint32) bool { return inB[address] && !inA[address] })
+		checkSetV4(t, a.Complement("in"), func(address uint32) bool { return outside(address) || !inA[address] })
+		checkSetV4(t, a.Complement("in").Complement("in"), func(address uint32) bool { return inA[address] })
+	}
+}
+
+func TestSetOperationsExamples(t *testing.T) {
+	customers := NewTreeV4()
+	customers.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "customer", nil)
+	customers.Add(ipv4FromBytes([]byte{192, 168, 0, 0}, 24), "customer", nil)
+	customers.Add(ipv4FromBytes([]byte{192, 168, 1, 0}, 24), "customer", nil)
+	announced := NewTreeV4()
+	announced.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 9), "announced", nil)
+	announced.Add(ipv4FromBytes([]byte{10, 128, 0, 0}, 10), "announced", nil)
+	announced.Add(ipv4FromBytes([]byte{172, 16, 0, 0}, 12), "announced", nil)
+
+	prefixes := func(tree *TreeV4) []string {
+		ret := make([]string, 0)
+		for address := range tree.All() {
+			ret = append(ret, address.String())
+		}
+		return ret
+	}
+
+	assert.Equal(t, []string{"10.192.0.0/10", "192.168.0.0/23"}, prefixes(customers.Difference(announced, "unannounced")))
+	assert.Equal(t, []string{"10.0.0.0/9", "10.128.0.0/10"}, prefixes(customers.Intersect(announced, "both")))
+	assert.Equal(t, []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/23"}, prefixes(customers.Union(announced, "either")))
+	assert.Equal(t, []string{"0.0.0.0/0"}, prefixes(NewTreeV4().Complement("all")))
+	assert.Equal(t, []string{}, prefixes(NewTreeV4().Complement("all").Complement("none")))
+	assert.Equal(t, []string{"0.0.0.0/5", "8.0.0.0/7", "11.0.0.0/8", "12.0.0.0/6", "16.0.0.0/4", "32.0.0.0/3", "64.0.0.0/2", "128.0.0.0/1"},
+		prefixes(announced.Union(customers, "x").Intersect(ipv4Tree("10.0.0.0/8"), "x").Complement("x")))
+
+	tags, _ := customers.Difference(announced, "unannounced").FindTags(ipv4FromBytes([]byte{192, 168, 1, 1}, 32))
+	assert.Equal(t, []GeneratedType{"unannounced"}, tags)
+}
+
+func ipv4Tree(prefixes ...string) *TreeV4 {
+	tree := NewTreeV4()
+	for _, prefix := range prefixes {
+		v4, _, _ := patricia.ParseIPFromString(prefix)
+		tree.Add(*v4, "x", nil)
+	}
+	return tree
+}
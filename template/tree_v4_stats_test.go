@@ -0,0 +1,146 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertStatsV4 asserts that the tree's counters match a walk of the tree
+func assertStatsV4(t *testing.T, tree *TreeV4) TreeStats {
+	stats := tree.Stats()
+	prefixLengths := make([]int, 33)
+	taggedNodes := 0
+	for address, tags := range tree.All() {
+		prefixLengths[address.Length]++
+		taggedNodes++
+		assert.True(t, len(tags) > 0)
+	}
+	assert.Equal(t, tree.countNodes(1), stats.Nodes)
+	assert.Equal(t, tree.countTags(1), stats.Tags)
+	assert.Equal(t, taggedNodes, stats.TaggedNodes)
+	assert.Equal(t, prefixLengths, stats.PrefixLengths)
+	assert.Equal(t, len(tree.availableIndexes), stats.FreeNodes)
+	assert.Equal(t, len(tree.nodes), stats.NodeArrayLength)
+	assert.Equal(t, cap(tree.nodes), stats.NodeArrayCapacity)
+	assert.Equal(t, stats.NodeArrayLength, stats.Nodes+stats.FreeNodes+1)
+	assert.True(t, stats.Bytes >= stats.NodeArrayCapacity)
+	return stats
+}
+
+func TestStats(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+
+	tree := NewTreeV4()
+	stats := assertStatsV4(t, tree)
+	assert.Equal(t, 1, stats.Nodes)
+	assert.Equal(t, DepthStats{}, tree.DepthStats())
+
+	// 10.0.0.0/8 -> 10.0.0.0/16 -> 10.0.0.0/24, with 10.128.0.0/16 beside the /16
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 16), "B", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), "C", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), "D", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 128, 0, 0}, 16), "E", nil)
+
+	// neither of these add a tag
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), "D", matchFunc)
+	tree.Set(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A2")
+
+	stats = assertStatsV4(t, tree)
+	assert.Equal(t, 5, stats.Nodes)
+	assert.Equal(t, 5, stats.TaggedNodes)
+	assert.Equal(t, 6, stats.Tags)
+	assert.Equal(t, 1, stats.PrefixLengths[0])
+	assert.Equal(t, 1, stats.PrefixLengths[8])
+	assert.Equal(t, 2, stats.PrefixLengths[16])
+	assert.Equal(t, 1, stats.PrefixLengths[24])
+	assert.Equal(t, DepthStats{MaxDepth: 3, AverageDepth: float64(0+1+2+3+2) / 5}, tree.DepthStats())
+
+	// deleting the /8 keeps its node, as it has two children
+	count, _ := tree.Delete(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), matchFunc, "A2")
+	assert.Equal(t, 1, count)
+	count, _ = tree.Delete(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), matchFunc, "C")
+	assert.Equal(t, 1, count)
+	stats = assertStatsV4(t, tree)
+	assert.Equal(t, 5, stats.Nodes)
+	assert.Equal(t, 4, stats.TaggedNodes)
+	assert.Equal(t, 4, stats.Tags)
+	assert.Equal(t, 0, stats.PrefixLengths[8])
+
+	// deleting the /16 beside merges the /8 with the other /16
+	tree.Delete(ipv4FromBytes([]byte{10, 128, 0, 0}, 16), matchFunc, "E")
+	stats = assertStatsV4(t, tree)
+	assert.Equal(t, 3, stats.Nodes)
+	assert.Equal(t, 2, stats.FreeNodes)
+	assert.Equal(t, 3, stats.TaggedNodes)
+	assert.Equal(t, 2, tree.DepthStats().MaxDepth)
+	assert.True(t, stats.FreeTagSlots > 0)
+
+	// deleting a tag that isn't there changes nothing
+	count, _ = tree.Delete(ipv4FromBytes([]byte{10, 0, 0, 0}, 24), matchFunc, "nope")
+	assert.Equal(t, 0, count)
+	assert.Equal(t, stats, assertStatsV4(t, tree))
+}
+
+func TestStatsBulk(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	addresses, tags := readTestTagsV4(t)
+
+	tree := NewTreeV4()
+	for i, address := range addresses {
+		tree.Add(address, tags[i], nil)
+		if i%3 == 0 {
+			tree.Add(address, tags[i]+"-extra", nil)
+		}
+	}
+	stats := assertStatsV4(t, tree)
+	assert.Equal(t, len(addresses)+len(addresses)/3+1, stats.Tags)
+	assert.True(t, tree.DepthStats().MaxDepth > 0)
+
+	// counters survive cloning, serialization and compacting
+	cloneStats := tree.Clone().Stats()
+	cloneStats.Bytes = stats.Bytes // the slices are cloned, but may be allocated with more capacity
+	assert.Equal(t, stats, cloneStats)
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+	loaded := NewTreeV4()
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	loadedStats := assertStatsV4(t, loaded)
+	assert.Equal(t, stats.PrefixLengths, loadedStats.PrefixLengths)
+	assert.Equal(t, stats.Tags, loadedStats.Tags)
+	assert.Equal(t, tree.DepthStats(), loaded.DepthStats())
+
+	for i, address := range addresses {
+		if i%2 == 0 {
+			tree.Delete(address, matchFunc, tags[i])
+		}
+	}
+	stats = assertStatsV4(t, tree)
+	tree.Compact()
+	compacted := assertStatsV4(t, tree)
+	assert.Equal(t, stats.Tags, compacted.Tags)
+	assert.Equal(t, stats.PrefixLengths, compacted.PrefixLengths)
+	assert.Equal(t, 0, compacted.FreeNodes)
+	assert.Equal(t, 0, compacted.FreeTagSlots)
+	assert.True(t, compacted.Bytes < stats.Bytes)
+}
+
+func TestStatsDeep(t *testing.T) {
+	// each prefix within the last, as deep as the tree can go
+	tree := NewTreeV4()
+	for length := 0; length <= 32; length++ {
+		tree.Add(ipv4FromBytes([]byte{255, 255, 255, 255}, length), length, nil)
+	}
+	stats := assertStatsV4(t, tree)
+	assert.Equal(t, DepthStats{MaxDepth: 32, AverageDepth: 16.0}, tree.DepthStats())
+	for length := 0; length <= 32; length++ {
+		assert.Equal(t, 1, stats.PrefixLengths[length])
+	}
+
+	sync := NewSyncTreeV4From(tree)
+	assert.Equal(t, stats, sync.Stats())
+	assert.Equal(t, tree.DepthStats(), sync.DepthStats())
+}
@@ -0,0 +1,157 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func BenchmarkFindTagsSync(b *testing.B) {
+	tree := NewSyncTreeV4()
+	tree.Update(func(tree *TreeV4) error {
+		tree.Add(patricia.IPv4Address{}, "tagD", nil) // default
+		tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+		tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+		tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+		return nil
+	})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		address := patricia.NewIPv4Address(uint32(2156823809), 32)
+		for pb.Next() {
+			tree.FindTags(address)
+		}
+	})
+}
+
+func TestSyncTree(t *testing.T) {
+	tree := NewSyncTreeV4()
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+
+	countIncreased, count, err := tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A", matchFunc)
+	assert.NoError(t, err)
+	assert.True(t, countIncreased)
+	assert.Equal(t, 1, count)
+
+	countIncreased, count, err = tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A", matchFunc)
+	assert.NoError(t, err)
+	assert.False(t, countIncreased)
+	assert.Equal(t, 1, count)
+
+	countIncreased, count, err = tree.Set(ipv4FromBytes([]byte{10, 1, 0, 0}, 16), "B")
+	assert.NoError(t, err)
+	assert.True(t, countIncreased)
+	assert.Equal(t, 1, count)
+
+	tags, err := tree.FindTags(ipv4FromBytes([]byte{10, 1, 2, 3}, 32))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"A", "B"}, tags)
+
+	tags, err = tree.FindTagsWithFilter(ipv4FromBytes([]byte{10, 1, 2, 3}, 32), func(tag GeneratedType) bool { return tag == "B" })
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"B"}, tags)
+
+	found, tag, err := tree.FindDeepestTag(ipv4FromBytes([]byte{10, 1, 2, 3}, 32))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "B", tag)
+
+	address, tags, found := tree.FindDeepestMatch(ipv4FromBytes([]byte{10, 2, 2, 3}, 32))
+	assert.True(t, found)
+	assert.Equal(t, ipv4FromBytes([]byte{10, 0, 0, 0}, 8), address)
+	assert.Equal(t, []GeneratedType{"A"}, tags)
+
+	tags, found = tree.GetExact(ipv4FromBytes([]byte{10, 1, 0, 0}, 16))
+	assert.True(t, found)
+	assert.Equal(t, []GeneratedType{"B"}, tags)
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{10, 1, 0, 0}, 24)))
+
+	// readers holding on to a version don't see later changes
+	snapshot := tree.Load()
+	deleteCount, err := tree.Delete(ipv4FromBytes([]byte{10, 1, 0, 0}, 16), matchFunc, "B")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleteCount)
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{10, 1, 0, 0}, 16)))
+	assert.True(t, snapshot.HasExact(ipv4FromBytes([]byte{10, 1, 0, 0}, 16)))
+
+	// failed updates aren't published
+	err = tree.Update(func(tree *TreeV4) error {
+		tree.Add(ipv4FromBytes([]byte{11, 0, 0, 0}, 8), "C", nil)
+		return errors.New("nope")
+	})
+	assert.EqualError(t, err, "nope")
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{11, 0, 0, 0}, 8)))
+
+	// replacing
+	replacement := NewTreeV4()
+	replacement.Add(ipv4FromBytes([]byte{12, 0, 0, 0}, 8), "D", nil)
+	tree.Replace(replacement)
+	assert.True(t, tree.HasExact(ipv4FromBytes([]byte{12, 0, 0, 0}, 8)))
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{10, 0, 0, 0}, 8)))
+}
+
+// run with -race: readers and writers working at the same time
+func TestSyncTreeConcurrency(t *testing.T) {
+	tree := NewSyncTreeV4()
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+
+	const writers = 4
+	const batches = 25
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	// readers always see the root tag, and whole batches - every /24 in a batch gets its tag in the same update
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot := tree.Load()
+				for writer := 0; writer < writers; writer++ {
+					first, _ := snapshot.FindTags(ipv4FromBytes([]byte{10, byte(writer), 0, 1}, 32))
+					last, _ := snapshot.FindTags(ipv4FromBytes([]byte{10, byte(writer), 9, 1}, 32))
+					if !assert.Equal(t, len(first), len(last)) || !assert.Equal(t, "root", first[0]) {
+						return
+					}
+				}
+				found, _, _ := tree.FindDeepestTag(ipv4FromBytes([]byte{10, 0, 0, 1}, 32))
+				assert.True(t, found)
+			}
+		}()
+	}
+
+	var writersDone sync.WaitGroup
+	for writer := 0; writer < writers; writer++ {
+		writersDone.Add(1)
+		go func(writer int) {
+			defer writersDone.Done()
+			for batch := 0; batch < batches; batch++ {
+				tree.Update(func(tree *TreeV4) error {
+					for i := 0; i < 10; i++ {
+						tree.Add(ipv4FromBytes([]byte{10, byte(writer), byte(i), 0}, 24), fmt.Sprintf("%d-%d", writer, batch), nil)
+					}
+					return nil
+				})
+			}
+		}(writer)
+	}
+	writersDone.Wait()
+	close(done)
+	wg.Wait()
+
+	for writer := 0; writer < writers; writer++ {
+		tags, found := tree.GetExact(ipv4FromBytes([]byte{10, byte(writer), 5, 0}, 24))
+		assert.True(t, found)
+		assert.Equal(t, batches, len(tags))
+	}
+}
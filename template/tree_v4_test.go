@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/rand"
+	"net/netip"
 	"testing"
 
 	"github.com/kentik/patricia"
@@ -37,6 +38,58 @@ func BenchmarkFindTags(b *testing.B) {
 	}
 }
 
+func BenchmarkFindTagsAppend(b *testing.B) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "tagD", nil) // default
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+
+	buf := make([]GeneratedType, 0, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		address := patricia.NewIPv4Address(uint32(2156823809), 32)
+		buf = tree.FindTagsAppend(buf[:0], address)
+	}
+}
+
+func BenchmarkFindTagsWithFilterAppend(b *testing.B) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "tagD", nil) // default
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+	filterFunc := func(tag GeneratedType) bool { return tag != "tagD" }
+
+	buf := make([]GeneratedType, 0, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		address := patricia.NewIPv4Address(uint32(2156823809), 32)
+		buf = tree.FindTagsWithFilterAppend(buf[:0], address, filterFunc)
+	}
+}
+
+func BenchmarkVisitTags(b *testing.B) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "tagD", nil) // default
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+
+	count := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		address := patricia.NewIPv4Address(uint32(2156823809), 32)
+		tree.VisitTags(address, func(tag GeneratedType) bool {
+			count++
+			return true
+		})
+	}
+}
+
 func BenchmarkFindDeepestTag(b *testing.B) {
 	tree := NewTreeV4()
 	for i := 32; i > 0; i-- {
@@ -859,3 +912,203 @@ func payloadToByteArrays(tags []GeneratedType) [][]byte {
 	}
 	return ret
 }
+
+func TestGetExact(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{192, 0, 0, 0}, 8), "A", nil)
+	tree.Add(ipv4FromBytes([]byte{192, 0, 2, 0}, 24), "B", nil)
+	tree.Add(ipv4FromBytes([]byte{192, 0, 2, 0}, 24), "C", nil)
+	tree.Add(ipv4FromBytes([]byte{192, 0, 2, 1}, 32), "D", nil)
+	tree.Add(ipv4FromBytes([]byte{192, 0, 3, 1}, 32), "E", nil) // creates an untagged /22 node
+
+	tags, found := tree.GetExact(ipv4FromBytes([]byte{192, 0, 2, 0}, 24))
+	assert.True(t, found)
+	assert.Equal(t, []GeneratedType{"B", "C"}, tags)
+	assert.True(t, tree.HasExact(ipv4FromBytes([]byte{192, 0, 2, 0}, 24)))
+
+	// host bits beyond the prefix length are ignored
+	tags, found = tree.GetExact(ipv4FromBytes([]byte{192, 0, 2, 99}, 24))
+	assert.True(t, found)
+	assert.Equal(t, []GeneratedType{"B", "C"}, tags)
+
+	// covered by a tagged prefix, but not tagged itself
+	tags, found = tree.GetExact(ipv4FromBytes([]byte{192, 0, 2, 2}, 32))
+	assert.False(t, found)
+	assert.Nil(t, tags)
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{192, 0, 2, 0}, 25)))
+
+	// untagged intermediate node
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{192, 0, 2, 0}, 23)))
+
+	// root has no tags until it's given one
+	assert.False(t, tree.HasExact(patricia.IPv4Address{}))
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	tags, found = tree.GetExact(patricia.IPv4Address{})
+	assert.True(t, found)
+	assert.Equal(t, []GeneratedType{"root"}, tags)
+
+	// deleted tags are gone
+	tree.Delete(ipv4FromBytes([]byte{192, 0, 2, 1}, 32), func(a GeneratedType, b GeneratedType) bool { return a == b }, "D")
+	assert.False(t, tree.HasExact(ipv4FromBytes([]byte{192, 0, 2, 1}, 32)))
+}
+
+func TestFindDeepestMatch(t *testing.T) {
+	tree := NewTreeV4()
+
+	// nothing to match yet
+	address, tags, found := tree.FindDeepestMatch(ipv4FromBytes([]byte{203, 0, 113, 7}, 32))
+	assert.False(t, found)
+	assert.Nil(t, tags)
+	assert.Equal(t, patricia.IPv4Address{}, address)
+
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	tree.Add(ipv4FromBytes([]byte{203, 0, 0, 0}, 8), "A", nil)
+	tree.Add(ipv4FromBytes([]byte{203, 0, 113, 0}, 24), "B", nil)
+	tree.Add(ipv4FromBytes([]byte{203, 0, 113, 0}, 24), "C", nil)
+	tree.Add(ipv4FromBytes([]byte{203, 0, 113, 128}, 25), "D", nil)
+
+	address, tags, found = tree.FindDeepestMatch(ipv4FromBytes([]byte{203, 0, 113, 7}, 32))
+	assert.True(t, found)
+	assert.Equal(t, ipv4FromBytes([]byte{203, 0, 113, 0}, 24), address)
+	assert.Equal(t, []GeneratedType{"B", "C"}, tags)
+
+	address, tags, found = tree.FindDeepestMatch(ipv4FromBytes([]byte{203, 0, 113, 200}, 32))
+	assert.True(t, found)
+	assert.Equal(t, ipv4FromBytes([]byte{203, 0, 113, 128}, 25), address)
+	assert.Equal(t, []GeneratedType{"D"}, tags)
+
+	address, tags, found = tree.FindDeepestMatch(ipv4FromBytes([]byte{203, 5, 0, 1}, 32))
+	assert.True(t, found)
+	assert.Equal(t, ipv4FromBytes([]byte{203, 0, 0, 0}, 8), address)
+	assert.Equal(t, []GeneratedType{"A"}, tags)
+
+	// only the root matches
+	address, tags, found = tree.FindDeepestMatch(ipv4FromBytes([]byte{1, 2, 3, 4}, 32))
+	assert.True(t, found)
+	assert.Equal(t, patricia.IPv4Address{}, address)
+	assert.Equal(t, []GeneratedType{"root"}, tags)
+
+	// a shorter query doesn't match longer prefixes
+	address, tags, found = tree.FindDeepestMatch(ipv4FromBytes([]byte{203, 0, 113, 0}, 23))
+	assert.True(t, found)
+	assert.Equal(t, ipv4FromBytes([]byte{203, 0, 0, 0}, 8), address)
+	assert.Equal(t, []GeneratedType{"A"}, tags)
+}
+
+func TestFindTagsAppend(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(ipv4FromBytes([]byte{1, 2, 3, 4}, 0), "tagZ", nil) // default
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "tagA", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "tagB", nil) // 160 -> 128
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "tagC", nil)
+
+	address := ipv4FromBytes([]byte{128, 3, 6, 240}, 32)
+	expected, _ := tree.FindTags(address)
+
+	// appends after what's already there, reusing the buffer
+	buf := make([]GeneratedType, 1, 8)
+	buf[0] = "existing"
+	found := tree.FindTagsAppend(buf, address)
+	assert.Equal(t, append([]GeneratedType{"existing"}, expected...), found)
+	assert.Equal(t, &buf[:1][0], &found[0])
+
+	// nil is fine
+	assert.Equal(t, expected, tree.FindTagsAppend(nil, address))
+
+	// filtered
+	filterFunc := func(tag GeneratedType) bool { return tag == "tagA" || tag == "tagC" }
+	expected, _ = tree.FindTagsWithFilter(address, filterFunc)
+	assert.Equal(t, []GeneratedType{"tagA", "tagC"}, expected)
+	assert.Equal(t, expected, tree.FindTagsWithFilterAppend(buf[:0], address, filterFunc))
+	assert.Equal(t, []GeneratedType{"tagZ", "tagB", "tagA", "tagC"}, tree.FindTagsWithFilterAppend(nil, address, nil))
+
+	// visiting, and stopping early
+	var visited []GeneratedType
+	tree.VisitTags(address, func(tag GeneratedType) bool {
+		visited = append(visited, tag)
+		return true
+	})
+	assert.Equal(t, []GeneratedType{"tagZ", "tagB", "tagA", "tagC"}, visited)
+
+	visited = visited[:0]
+	tree.VisitTags(address, func(tag GeneratedType) bool {
+		visited = append(visited, tag)
+		return len(visited) < 2
+	})
+	assert.Equal(t, []GeneratedType{"tagZ", "tagB"}, visited)
+
+	// no allocations
+	buf = make([]GeneratedType, 0, 8)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = tree.FindTagsAppend(buf[:0], address)
+		buf = tree.FindTagsWithFilterAppend(buf[:0], address, filterFunc)
+		tree.VisitTags(address, func(tag GeneratedType) bool { return true })
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func TestNetipV4(t *testing.T) {
+	tree := NewTreeV4()
+	matchAll := func(payload GeneratedType, val GeneratedType) bool { return true }
+
+	_, _, err := tree.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"), "10/8", nil)
+	assert.NoError(t, err)
+	_, _, err = tree.SetPrefix(netip.MustParsePrefix("10.1.2.3/16"), "10.1/16") // host bits are ignored
+	assert.NoError(t, err)
+	_, _, err = tree.AddPrefix(netip.MustParsePrefix("::ffff:10.1.2.0/120"), "10.1.2/24", nil) // mapped prefixes are unmapped
+	assert.NoError(t, err)
+	_, _, err = tree.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), "v6", nil)
+	assert.Error(t, err)
+
+	tags, err := tree.FindTagsAddr(netip.MustParseAddr("10.1.2.3"))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"10/8", "10.1/16", "10.1.2/24"}, tags)
+	tags, err = tree.FindTagsPrefix(netip.MustParsePrefix("10.1.0.0/16"))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"10/8", "10.1/16"}, tags)
+	found, tag, err := tree.FindDeepestTagAddr(netip.MustParseAddr("::ffff:10.1.3.3"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10.1/16", tag)
+	found, tag, err = tree.FindDeepestTagPrefix(netip.MustParsePrefix("10.0.0.0/8"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "10/8", tag)
+
+	_, err = tree.FindTagsAddr(netip.MustParseAddr("2001:db8::1"))
+	assert.Error(t, err)
+	_, err = tree.FindTagsPrefix(netip.Prefix{})
+	assert.Error(t, err)
+	_, _, err = tree.FindDeepestTagAddr(netip.Addr{})
+	assert.Error(t, err)
+	_, err = tree.DeletePrefix(netip.MustParsePrefix("::/0"), matchAll, nil)
+	assert.Error(t, err)
+
+	deleted, err := tree.DeletePrefix(netip.MustParsePrefix("10.1.0.0/16"), matchAll, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	// no allocations converting the address
+	addr := netip.MustParseAddr("10.1.2.3")
+	buf := make([]GeneratedType, 0, 10)
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		buf, _ = tree.FindTagsAddrAppend(buf[:0], addr)
+		tree.FindDeepestTagAddr(addr)
+	}))
+	assert.Equal(t, []GeneratedType{"10/8", "10.1.2/24"}, buf)
+}
+
+func BenchmarkFindTagsAddrAppend(b *testing.B) {
+	tree := NewTreeV4()
+	tree.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"), "10/8", nil)
+	tree.AddPrefix(netip.MustParsePrefix("10.1.0.0/16"), "10.1/16", nil)
+	tree.AddPrefix(netip.MustParsePrefix("10.1.2.0/24"), "10.1.2/24", nil)
+	addr := netip.MustParseAddr("10.1.2.3")
+	buf := make([]GeneratedType, 0, 10)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buf, _ = tree.FindTagsAddrAppend(buf[:0], addr)
+	}
+}
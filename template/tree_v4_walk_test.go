@@ -0,0 +1,159 @@
+package template
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalk(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	tree.Add(ipv4FromBytes([]byte{128, 3, 6, 240}, 32), "C", nil)
+	tree.Add(ipv4FromBytes([]byte{160, 0, 0, 0}, 2), "B", nil)
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "A", nil) // host bits get dropped from the walked prefix
+	tree.Add(ipv4FromBytes([]byte{129, 0, 0, 1}, 7), "A2", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "D", nil)
+
+	var addresses []patricia.IPv4Address
+	var tags [][]GeneratedType
+	tree.Walk(func(address patricia.IPv4Address, nodeTags []GeneratedType) bool {
+		addresses = append(addresses, address)
+		tags = append(tags, nodeTags)
+		return true
+	})
+
+	assert.Equal(t, []patricia.IPv4Address{
+		{},
+		ipv4FromBytes([]byte{10, 0, 0, 0}, 8),
+		ipv4FromBytes([]byte{128, 0, 0, 0}, 2),
+		ipv4FromBytes([]byte{128, 0, 0, 0}, 7),
+		ipv4FromBytes([]byte{128, 3, 6, 240}, 32),
+	}, addresses)
+	assert.Equal(t, [][]GeneratedType{{"root"}, {"D"}, {"B"}, {"A", "A2"}, {"C"}}, tags)
+
+	// stop early
+	count := 0
+	tree.Walk(func(address patricia.IPv4Address, nodeTags []GeneratedType) bool {
+		count++
+		return count < 2
+	})
+	assert.Equal(t, 2, count)
+
+	// iterator
+	addresses = addresses[:0]
+	for address, nodeTags := range tree.All() {
+		addresses = append(addresses, address)
+		if nodeTags[0] == "B" {
+			break
+		}
+	}
+	assert.Equal(t, 3, len(addresses))
+	assert.Equal(t, ipv4FromBytes([]byte{128, 0, 0, 0}, 2), addresses[2])
+}
+
+func TestWalkEmptyTree(t *testing.T) {
+	tree := NewTreeV4()
+	count := 0
+	for range tree.All() {
+		count++
+	}
+	assert.Equal(t, 0, count)
+}
+
+func TestWalkBulkLoad(t *testing.T) {
+	file, err := os.Open("./test_tags.tsv")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer file.Close()
+
+	tree := NewTreeV4()
+	expected := make(map[patricia.IPv4Address][]GeneratedType)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		v4, _, err := patricia.ParseIPFromString(parts[0])
+		if !assert.NoError(t, err) {
+			return
+		}
+		tree.Add(*v4, parts[1], nil)
+		expected[*v4] = append(expected[*v4], parts[1])
+	}
+	assert.NoError(t, scanner.Err())
+
+	var previous *patricia.IPv4Address
+	found := make(map[patricia.IPv4Address][]GeneratedType)
+	for address, tags := range tree.All() {
+		if previous != nil {
+			assert.True(t, previous.Address < address.Address || (previous.Address == address.Address && previous.Length < address.Length), "prefixes should be walked in order")
+		}
+		previous = &address
+		found[address] = tags
+	}
+	assert.Equal(t, expected, found)
+}
+
+func TestFindTagsUnder(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, "root", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), "A", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 1, 0, 0}, 16), "B", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 1, 2, 0}, 24), "C", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 1, 2, 3}, 32), "D", nil)
+	tree.Add(ipv4FromBytes([]byte{10, 200, 0, 0}, 16), "E", nil)
+	tree.Add(ipv4FromBytes([]byte{11, 0, 0, 0}, 8), "F", nil)
+
+	// the query prefix itself, and everything under it
+	addresses, tags, err := tree.FindTagsUnder(ipv4FromBytes([]byte{10, 0, 0, 0}, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, []patricia.IPv4Address{
+		ipv4FromBytes([]byte{10, 0, 0, 0}, 8),
+		ipv4FromBytes([]byte{10, 1, 0, 0}, 16),
+		ipv4FromBytes([]byte{10, 1, 2, 0}, 24),
+		ipv4FromBytes([]byte{10, 1, 2, 3}, 32),
+		ipv4FromBytes([]byte{10, 200, 0, 0}, 16),
+	}, addresses)
+	assert.Equal(t, [][]GeneratedType{{"A"}, {"B"}, {"C"}, {"D"}, {"E"}}, tags)
+
+	// query prefix isn't in the tree, but is covered by a shorter one, and covers longer ones
+	addresses, tags, err = tree.FindTagsUnder(ipv4FromBytes([]byte{10, 1, 2, 0}, 23))
+	assert.NoError(t, err)
+	assert.Equal(t, []patricia.IPv4Address{
+		ipv4FromBytes([]byte{10, 1, 2, 0}, 24),
+		ipv4FromBytes([]byte{10, 1, 2, 3}, 32),
+	}, addresses)
+	assert.Equal(t, [][]GeneratedType{{"C"}, {"D"}}, tags)
+
+	// query prefix falls between a parent and a child with a longer compressed prefix
+	addresses, _, err = tree.FindTagsUnder(ipv4FromBytes([]byte{10, 128, 0, 0}, 9))
+	assert.NoError(t, err)
+	assert.Equal(t, []patricia.IPv4Address{ipv4FromBytes([]byte{10, 200, 0, 0}, 16)}, addresses)
+
+	// nothing under the query prefix
+	addresses, tags, err = tree.FindTagsUnder(ipv4FromBytes([]byte{10, 2, 0, 0}, 16))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(addresses))
+	assert.Equal(t, 0, len(tags))
+
+	addresses, _, err = tree.FindTagsUnder(ipv4FromBytes([]byte{12, 0, 0, 0}, 8))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(addresses))
+
+	// /0 is everything
+	addresses, _, err = tree.FindTagsUnder(patricia.IPv4Address{})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, len(addresses))
+
+	// stop early
+	count := 0
+	tree.WalkSubtree(ipv4FromBytes([]byte{10, 0, 0, 0}, 8), func(address patricia.IPv4Address, tags []GeneratedType) bool {
+		count++
+		return count < 3
+	})
+	assert.Equal(t, 3, count)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"net/netip"
 	"testing"
 
 	"github.com/kentik/patricia"
@@ -442,3 +443,340 @@ func TestDuplicateTagsWithMatchFuncV6(t *testing.T) {
 	assert.Equal(t, 2, count)
 	assert.NoError(t, err)
 }
+
+func TestGetExactV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/128", 32), "A", nil)
+	tree.Add(ipv6FromString("2001:db8::1/128", 128), "B", nil)
+
+	tags, found := tree.GetExact(ipv6FromString("2001:db8::/128", 32))
+	assert.True(t, found)
+	assert.Equal(t, []GeneratedType{"A"}, tags)
+
+	assert.True(t, tree.HasExact(ipv6FromString("2001:db8::1/128", 128)))
+	assert.False(t, tree.HasExact(ipv6FromString("2001:db8::2/128", 128)))
+	assert.False(t, tree.HasExact(ipv6FromString("2001:db8::/128", 64)))
+}
+
+func TestFindDeepestMatchV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/128", 32), "A", nil)
+	tree.Add(ipv6FromString("2001:db8:0:1::/128", 64), "B", nil)
+	tree.Add(ipv6FromString("2001:db8:0:1::/128", 64), "C", nil)
+
+	address, tags, found := tree.FindDeepestMatch(ipv6FromString("2001:db8:0:1::5/128", 128))
+	assert.True(t, found)
+	assert.Equal(t, ipv6FromString("2001:db8:0:1::/128", 64), address)
+	assert.Equal(t, []GeneratedType{"B", "C"}, tags)
+
+	address, tags, found = tree.FindDeepestMatch(ipv6FromString("2001:db8:0:2::5/128", 128))
+	assert.True(t, found)
+	assert.Equal(t, ipv6FromString("2001:db8::/128", 32), address)
+	assert.Equal(t, []GeneratedType{"A"}, tags)
+
+	_, _, found = tree.FindDeepestMatch(ipv6FromString("2001:db9::/128", 128))
+	assert.False(t, found)
+}
+
+func TestMarshalBinaryV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/128", 32), "A", nil)
+	tree.Add(ipv6FromString("2001:db8::1/128", 128), "B", nil)
+	tree.Add(ipv6FromString("2001:db8::1/128", 128), "C", nil)
+	tree.Add(ipv6FromString("2001:db9::1/128", 128), "D", nil)
+
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+
+	loaded := NewTreeV6()
+	assert.NoError(t, loaded.UnmarshalBinary(data))
+	assert.Equal(t, len(tree.nodes), len(loaded.nodes))
+	for i := range tree.nodes {
+		treeNode, loadedNode := tree.nodes[i], loaded.nodes[i]
+		treeNode.tags, loadedNode.tags = tagBlock{}, tagBlock{}
+		assert.Equal(t, treeNode, loadedNode)
+		assert.Equal(t, tree.tagsForNode(uint(i)), loaded.tagsForNode(uint(i)))
+	}
+
+	tags, err := loaded.FindTags(ipv6FromString("2001:db8::1/128", 128))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"A", "B", "C"}, tags)
+
+	// an IPv6 tree can't be loaded into an IPv4 one
+	assert.Error(t, NewTreeV4().UnmarshalBinary(data))
+}
+
+func TestFreezeV6(t *testing.T) {
+	tree := NewTreeV6()
+	for i := 128; i > 0; i -= 3 {
+		tree.Add(ipv6FromString("2001:db8:0:0:0:0:2:1/128", i), fmt.Sprintf("Tag-%d", i), nil)
+	}
+	frozen := tree.Freeze()
+
+	for i := 0; i <= 128; i++ {
+		address := ipv6FromString("2001:db8:0:0:0:0:2:1/128", i)
+		expected, _ := tree.FindTags(address)
+		found, err := frozen.FindTags(address)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, found)
+
+		expectedAddress, expected, expectedFound := tree.FindDeepestMatch(address)
+		matchAddress, found, foundDeepest := frozen.FindDeepestMatch(address)
+		assert.Equal(t, expectedAddress, matchAddress)
+		assert.Equal(t, expected, found)
+		assert.Equal(t, expectedFound, foundDeepest)
+	}
+}
+
+func TestSyncTreeV6(t *testing.T) {
+	tree := NewSyncTreeV6()
+	tree.Update(func(tree *TreeV6) error {
+		tree.Add(ipv6FromString("2001:db8::/128", 32), "A", nil)
+		tree.Add(ipv6FromString("2001:db8::1/128", 128), "B", nil)
+		return nil
+	})
+
+	tags, err := tree.FindTags(ipv6FromString("2001:db8::1/128", 128))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"A", "B"}, tags)
+}
+
+func TestFindTagsBatchV6(t *testing.T) {
+	tree := NewTreeV6()
+	for i := 128; i > 0; i -= 5 {
+		tree.Add(ipv6FromString("2001:db8:0:0:0:0:2:1/128", i), fmt.Sprintf("Tag-%d", i), nil)
+	}
+	tree.Add(ipv6FromString("2001:db8:0:0:0:0:2:2/128", 128), "other", nil)
+
+	var addresses []patricia.IPv6Address
+	for i := 0; i <= 128; i++ {
+		addresses = append(addresses, ipv6FromString("2001:db8:0:0:0:0:2:1/128", i), ipv6FromString("2001:db8:0:0:0:0:2:2/128", 128-i))
+	}
+
+	tree.FindTagsBatch(addresses, func(i int, tags []GeneratedType) {
+		expected, _ := tree.FindTags(addresses[i])
+		assert.Equal(t, len(expected), len(tags))
+		for j := range tags {
+			assert.Equal(t, expected[j], tags[j])
+		}
+	})
+	tree.FindDeepestTagBatch(addresses, func(i int, found bool, tag GeneratedType) {
+		expectedFound, expectedTag, _ := tree.FindDeepestTag(addresses[i])
+		assert.Equal(t, expectedFound, found)
+		assert.Equal(t, expectedTag, tag)
+	})
+}
+
+func TestNetipV6(t *testing.T) {
+	tree := NewTreeV6()
+
+	_, _, err := tree.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), "32", nil)
+	assert.NoError(t, err)
+	_, _, err = tree.SetPrefix(netip.MustParsePrefix("2001:db8:1::1/48"), "48")
+	assert.NoError(t, err)
+	_, _, err = tree.AddPrefix(netip.MustParsePrefix("10.0.0.0/8"), "mapped", nil) // IPv4 is mapped
+	assert.NoError(t, err)
+	_, _, err = tree.AddPrefix(netip.Prefix{}, "invalid", nil)
+	assert.Error(t, err)
+
+	tags, err := tree.FindTagsAddr(netip.MustParseAddr("2001:db8:1::5"))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"32", "48"}, tags)
+	tags, err = tree.FindTagsPrefix(netip.MustParsePrefix("::ffff:10.9.0.0/112"))
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"mapped"}, tags)
+	found, tag, err := tree.FindDeepestTagAddr(netip.MustParseAddr("10.1.1.1"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "mapped", tag)
+	found, tag, err = tree.FindDeepestTagPrefix(netip.MustParsePrefix("2001:db8:2::/48"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "32", tag)
+
+	deleted, err := tree.DeletePrefix(netip.MustParsePrefix("2001:db8:1::/48"), func(payload GeneratedType, val GeneratedType) bool { return payload == val }, "48")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	addr := netip.MustParseAddr("2001:db8:1::5")
+	buf := make([]GeneratedType, 0, 10)
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		buf, _ = tree.FindTagsAddrAppend(buf[:0], addr)
+		tree.FindDeepestTagAddr(addr)
+	}))
+	assert.Equal(t, []GeneratedType{"32"}, buf)
+}
+
+func TestFindTagsEmbedded(t *testing.T) {
+	v4Tree := NewTreeV4()
+	v4Tree.Add(ipv4FromBytes([]byte{192, 0, 2, 0}, 24), "v4-24", nil)
+	v4Tree.Add(ipv4FromBytes([]byte{192, 0, 2, 33}, 32), "v4-32", nil)
+
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2002::/16", 16), "6to4", nil)
+	tree.Add(ipv6FromString("64:ff9b::/96", 96), "nat64", nil)
+
+	embedded := patricia.EmbeddedIPv4{SixToFour: true, NAT64Prefixes: []patricia.IPv6Address{patricia.NAT64WellKnownPrefix}}
+
+	tags, err := tree.FindTagsEmbedded(ipv6FromString("2002:c000:221::1/128", 128), embedded, v4Tree)
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"6to4", "v4-24", "v4-32"}, tags)
+	tags, err = tree.FindTagsEmbedded(ipv6FromString("64:ff9b::c000:201/128", 128), embedded, v4Tree)
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"nat64", "v4-24"}, tags)
+
+	// off
+	tags, err = tree.FindTagsEmbedded(ipv6FromString("2002:c000:221::1/128", 128), patricia.EmbeddedIPv4{}, v4Tree)
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"6to4"}, tags)
+
+	found, tag, err := tree.FindDeepestTagEmbedded(ipv6FromString("2002:c000:221::1/128", 128), embedded, v4Tree)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "v4-32", tag)
+
+	// falls back to the IPv6 tags when the embedded address has none
+	found, tag, err = tree.FindDeepestTagEmbedded(ipv6FromString("64:ff9b::a00:1/128", 128), embedded, v4Tree)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "nat64", tag)
+}
+
+func TestSetOperationsV6(t *testing.T) {
+	a := NewTreeV6()
+	a.Add(ipv6FromString("2001:db8::/32", 32), "a", nil)
+	b := NewTreeV6()
+	b.Add(ipv6FromString("2001:db8::/33", 33), "b", nil)
+	b.Add(ipv6FromString("2001:db8:8000::/34", 34), "b", nil)
+	b.Add(ipv6FromString("2001:db8:c000::1/128", 128), "b", nil)
+
+	prefixes := func(tree *TreeV6) []string {
+		ret := make([]string, 0)
+		for address := range tree.All() {
+			ret = append(ret, address.String())
+		}
+		return ret
+	}
+
+	difference := a.Difference(b, "x")
+	assert.Equal(t, 94, len(prefixes(difference))) // the rest of 2001:db8:c000::/34, around a single address
+	assert.Equal(t, "2001:db8:c000::/128", prefixes(difference)[0])
+	assert.Equal(t, "2001:db8:e000::/35", prefixes(difference)[93])
+	assert.Equal(t, []string{"2001:db8::/32"}, prefixes(a.Union(b, "x")))
+	assert.Equal(t, []string{"2001:db8::/33", "2001:db8:8000::/34", "2001:db8:c000::1/128"}, prefixes(a.Intersect(b, "x")))
+	assert.Equal(t, []string{"2001:db8::/32"}, prefixes(difference.Union(b, "x")))
+	assert.Equal(t, []string{"::/0"}, prefixes(a.Union(a.Complement("x"), "x")))
+}
+
+func TestAggregateV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/33", 33), "a", nil)
+	tree.Add(ipv6FromString("2001:db8:8000::/33", 33), "a", nil)
+	tree.Add(ipv6FromString("2001:db8:8000::1/128", 128), "a", nil)
+	tree.Add(ipv6FromString("2001:db8:8000::2/128", 128), "b", nil)
+
+	prefixes := make([]string, 0)
+	for address := range tree.Aggregate(nil).All() {
+		prefixes = append(prefixes, address.String())
+	}
+	assert.Equal(t, []string{"2001:db8::/32", "2001:db8:8000::2/128"}, prefixes)
+}
+
+func TestRangeV6(t *testing.T) {
+	tree := NewTreeV6()
+	count, err := tree.AddRange(ipv6FromString("2001:db8::5/128", 128), ipv6FromString("2001:db8::10/128", 128), "pool", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	for i := byte(0); i < 0x20; i++ {
+		tags, _ := tree.FindTags(patricia.NewIPv6Address([]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, i}, 128))
+		if i >= 5 && i <= 0x10 {
+			assert.Equal(t, []GeneratedType{"pool"}, tags)
+		} else {
+			assert.Equal(t, 0, len(tags))
+		}
+	}
+
+	count, err = tree.DeleteRange(ipv6FromString("2001:db8::5/128", 128), ipv6FromString("2001:db8::10/128", 128), func(payload GeneratedType, val GeneratedType) bool {
+		return payload == val
+	}, "pool")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 0, tree.countTags(1))
+}
+
+func TestCompactV6(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	tree := NewTreeV6()
+	for i := 0; i < 100; i++ {
+		address := patricia.IPv6Address{Left: 0x20010db800000000, Right: uint64(i), Length: 128}
+		tree.Add(address, i, nil)
+	}
+	tree.Add(ipv6FromString("2001:db8::/32", 32), "covering", nil)
+	for i := 0; i < 100; i++ {
+		if i != 42 {
+			address := patricia.IPv6Address{Left: 0x20010db800000000, Right: uint64(i), Length: 128}
+			tree.Delete(address, matchFunc, i)
+		}
+	}
+
+	stats := tree.Compact()
+	assert.Equal(t, 3, stats.Nodes)
+	assert.Equal(t, 2, stats.Tags)
+	assert.True(t, stats.NodesReclaimed > 0)
+	assert.True(t, stats.BytesReclaimed > 0)
+	assert.Equal(t, 4, len(tree.nodes))
+	assert.Equal(t, 0, len(tree.availableIndexes))
+
+	tags, err := tree.FindTags(patricia.IPv6Address{Left: 0x20010db800000000, Right: 42, Length: 128})
+	assert.NoError(t, err)
+	assert.Equal(t, []GeneratedType{"covering", 42}, tags)
+}
+
+func TestStatsV6(t *testing.T) {
+	matchFunc := func(a GeneratedType, b GeneratedType) bool { return a == b }
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/32", 32), "A", nil)
+	tree.Add(ipv6FromString("2001:db8::1/128", 128), "B", nil)
+	tree.Add(ipv6FromString("2001:db8::1/128", 128), "C", nil)
+	tree.Add(ipv6FromString("2001:db9::/48", 48), "D", nil)
+	tree.Delete(ipv6FromString("2001:db9::/48", 48), matchFunc, "D")
+
+	stats := tree.Stats()
+	assert.Equal(t, tree.countNodes(1), stats.Nodes)
+	assert.Equal(t, 3, stats.Tags)
+	assert.Equal(t, 2, stats.TaggedNodes)
+	assert.Equal(t, 129, len(stats.PrefixLengths))
+	assert.Equal(t, 1, stats.PrefixLengths[32])
+	assert.Equal(t, 1, stats.PrefixLengths[128])
+	assert.Equal(t, 0, stats.PrefixLengths[48])
+	assert.Equal(t, DepthStats{MaxDepth: 2, AverageDepth: 1.5}, tree.DepthStats())
+	assert.Equal(t, len(tree.availableIndexes), stats.FreeNodes)
+}
+
+func TestUnmarshalBinaryStructureV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/32", 32), "A", nil)
+	tree.Add(ipv6FromString("2001:db8::1/128", 128), "B", nil)
+
+	// a cycle back to the root, which lookups would follow forever
+	parent := tree.nodes[1].Left
+	child := tree.nodes[parent].Left
+	tree.nodes[child].Left = 1
+	data, err := tree.MarshalBinary()
+	assert.NoError(t, err)
+	err = NewTreeV6().UnmarshalBinary(data)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "reached more than once")
+	}
+
+	// a child on the wrong side of its parent, which adds would panic on
+	tree.nodes[child].Left = 0
+	tree.nodes[parent].Left, tree.nodes[parent].Right = 0, child
+	data, err = tree.MarshalBinary()
+	assert.NoError(t, err)
+	err = NewTreeV6().UnmarshalBinary(data)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "wrong side")
+	}
+}
@@ -0,0 +1,60 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalkV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8:0:0:0:0:2:1/128", 128), "A", nil)
+	tree.Add(ipv6FromString("2001:db8:0:0:0:0:2:1/128", 64), "B", nil)
+	tree.Add(ipv6FromString("2001:db8:0:0:0:0:2:1/128", 100), "C", nil)
+	tree.Add(ipv6FromString("2001:db7:0:0:0:0:2:1/128", 77), "D", nil)
+	tree.Add(ipv6FromString("2001:db7:0:0:0:0:2:1/128", 77), "E", nil)
+
+	var addresses []patricia.IPv6Address
+	var tags [][]GeneratedType
+	for address, nodeTags := range tree.All() {
+		addresses = append(addresses, address)
+		tags = append(tags, nodeTags)
+	}
+
+	assert.Equal(t, []patricia.IPv6Address{
+		ipv6FromString("2001:db7::/128", 77),
+		ipv6FromString("2001:db8::/128", 64),
+		ipv6FromString("2001:db8::/128", 100),
+		ipv6FromString("2001:db8::2:1/128", 128),
+	}, addresses)
+	assert.Equal(t, [][]GeneratedType{{"D", "E"}, {"B"}, {"C"}, {"A"}}, tags)
+
+	// stop early
+	count := 0
+	tree.Walk(func(address patricia.IPv6Address, nodeTags []GeneratedType) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, 1, count)
+}
+
+func TestFindTagsUnderV6(t *testing.T) {
+	tree := NewTreeV6()
+	tree.Add(ipv6FromString("2001:db8::/128", 32), "A", nil)
+	tree.Add(ipv6FromString("2001:db8:1::/128", 48), "B", nil)
+	tree.Add(ipv6FromString("2001:db8:1::1/128", 128), "C", nil)
+	tree.Add(ipv6FromString("2001:db9::/128", 32), "D", nil)
+
+	addresses, tags, err := tree.FindTagsUnder(ipv6FromString("2001:db8:1::/128", 40))
+	assert.NoError(t, err)
+	assert.Equal(t, []patricia.IPv6Address{
+		ipv6FromString("2001:db8:1::/128", 48),
+		ipv6FromString("2001:db8:1::1/128", 128),
+	}, addresses)
+	assert.Equal(t, [][]GeneratedType{{"B"}, {"C"}}, tags)
+
+	addresses, _, err = tree.FindTagsUnder(ipv6FromString("2001:db8:2::/128", 48))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(addresses))
+}
@@ -0,0 +1,64 @@
+package uint32_tree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kentik/patricia"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappedTreeNumbers(t *testing.T) {
+	tree := NewTreeV4()
+	tree.Add(patricia.IPv4Address{}, 1, nil)
+	tree.Add(patricia.NewIPv4Address(0x0a000000, 8), 10, nil)
+	tree.Add(patricia.NewIPv4Address(0x0a010000, 16), 100000, nil)
+	tree.Add(patricia.NewIPv4Address(0x0a010000, 16), 100001, nil)
+	tree.Add(patricia.NewIPv4Address(0x0a010203, 32), 4000000000, nil)
+
+	// leave some free slots behind, which shouldn't be carried over
+	tree.Add(patricia.NewIPv4Address(0x0b000000, 8), 11, nil)
+	tree.Delete(patricia.NewIPv4Address(0x0b000000, 8), func(a uint32, b uint32) bool { return a == b }, 11)
+
+	var buf bytes.Buffer
+	_, err := tree.WriteMappedTo(&buf)
+	assert.NoError(t, err)
+
+	mapped, err := NewMappedTreeV4(buf.Bytes())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer mapped.Close()
+
+	tags, err := mapped.FindTags(patricia.NewIPv4Address(0x0a010203, 32))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1, 10, 100000, 100001, 4000000000}, tags)
+
+	tags, err = mapped.FindTags(patricia.NewIPv4Address(0x0b000001, 32))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1}, tags)
+
+	found, tag, err := mapped.FindDeepestTag(patricia.NewIPv4Address(0x0a0100ff, 32))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, uint32(100000), tag)
+
+	// no root tags
+	var empty bytes.Buffer
+	_, err = NewTreeV4().WriteMappedTo(&empty)
+	assert.NoError(t, err)
+	mapped, err = NewMappedTreeV4(empty.Bytes())
+	assert.NoError(t, err)
+	found, _, err = mapped.FindDeepestTag(patricia.NewIPv4Address(0x0a0100ff, 32))
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// data written for another payload type can't be opened
+	var other bytes.Buffer
+	_, err = writeMapped(&other, mapped.addressFamily(), 2, make([]byte, 2*_treeNodeV4MappedSize), &mappedTagWriter{layout: _tagLayoutString, size: 8})
+	assert.NoError(t, err)
+	_, err = NewMappedTreeV4(other.Bytes())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "tag layout")
+	}
+}